@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// expandAlias replaces the command in args with the command its alias stands for, if it is an alias.
+// Aliases may stand for a command with arguments, which are put before the remaining arguments, and for
+// other aliases, which are expanded in turn.
+func expandAlias(aliases map[string]string, args []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	for len(args) > 0 {
+		target, ok := aliases[args[0]]
+		if !ok {
+			return args, nil
+		}
+		if _, ok := seen[args[0]]; ok {
+			return nil, fmt.Errorf("alias %q expands to itself", args[0])
+		}
+		seen[args[0]] = struct{}{}
+
+		expanded := strings.Fields(target)
+		if len(expanded) == 0 {
+			return nil, fmt.Errorf("alias %q has no command", args[0])
+		}
+		args = append(expanded, args[1:]...)
+	}
+	return args, nil
+}
+
+// aliasesReferring returns the sorted names of the aliases whose command has word as one of its arguments.
+func aliasesReferring(aliases map[string]string, word string) []string {
+	var names []string
+	for alias, target := range aliases {
+		if fields := strings.Fields(target); len(fields) > 1 && slices.Contains(fields[1:], word) {
+			names = append(names, alias)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// validateAliases checks that every alias expands to a command without running into a cycle.
+func validateAliases(aliases map[string]string) error {
+	for _, alias := range slices.Sorted(maps.Keys(aliases)) {
+		if strings.ContainsFunc(alias, func(r rune) bool { return r == ' ' || r == '\t' }) {
+			return fmt.Errorf("alias %q contains whitespace", alias)
+		}
+		if _, err := expandAlias(aliases, []string{alias}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
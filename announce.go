@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+const (
+	// AnnounceScopeNone disables transfer announcements.
+	AnnounceScopeNone = "none"
+	// AnnounceScopeAll announces transfers to every player on the proxy.
+	AnnounceScopeAll = "all"
+	// AnnounceScopeTarget announces transfers to the players on the target server only.
+	AnnounceScopeTarget = "target"
+)
+
+// transferAnnouncer broadcasts transfer announcements, limited by a token bucket so that mass transfers
+// don't flood chat.
+type transferAnnouncer struct {
+	conf    TransferAnnouncement
+	limiter *TokenBucket
+}
+
+// newTransferAnnouncer creates a transferAnnouncer for the given configuration.
+func newTransferAnnouncer(conf TransferAnnouncement) *transferAnnouncer {
+	a := &transferAnnouncer{conf: conf}
+	if conf.PerSecond > 0 {
+		a.limiter = NewTokenBucket(conf.PerSecond, conf.Burst)
+	}
+	return a
+}
+
+// Announce announces that the session s transferred to the server with the given name and address.
+// Recipients are selected from the sessions in registry according to the configured scope, never
+// including s itself.
+func (a *transferAnnouncer) Announce(s *session.Session, registry *session.Registry, name, addr string) {
+	var online []string
+	for _, other := range registry.GetSessions() {
+		online = append(online, other.Client().IdentityData().XUID)
+	}
+	var recipients []*session.Session
+	for _, xuid := range announcementRecipients(a.conf.Scope, s.Client().IdentityData().XUID, online, addr) {
+		if other := registry.GetSession(xuid); other != nil {
+			recipients = append(recipients, other)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	if a.limiter != nil {
+		if _, ok := a.limiter.Reserve(0); !ok {
+			return
+		}
+	}
+	broadcastMessage(recipients, formatTransferAnnouncement(a.conf.Template, s.Client().IdentityData().DisplayName, name))
+}
+
+// announcementRecipients returns the XUIDs of the players that should receive an announcement about the
+// player with the given XUID transferring to addr, out of the online players, based on scope.
+func announcementRecipients(scope, xuid string, online []string, addr string) []string {
+	var recipients []string
+	for _, other := range online {
+		if other == xuid {
+			continue
+		}
+		switch scope {
+		case AnnounceScopeAll:
+			recipients = append(recipients, other)
+		case AnnounceScopeTarget:
+			if current, ok := serverTracker.Server(other); ok && current == addr {
+				recipients = append(recipients, other)
+			}
+		}
+	}
+	return recipients
+}
+
+// formatTransferAnnouncement expands the {player} and {server} placeholders in template.
+func formatTransferAnnouncement(template, player, server string) string {
+	return strings.NewReplacer("{player}", player, "{server}", server).Replace(template)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAnnouncementRecipients(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+	serverTracker.Set("1", "127.0.0.1:19134")
+	serverTracker.Set("2", "127.0.0.1:19134")
+	serverTracker.Set("3", "127.0.0.1:19133")
+	online := []string{"1", "2", "3", "4"}
+
+	tests := []struct {
+		name  string
+		scope string
+		want  []string
+	}{
+		{name: "all players but the transferred one", scope: AnnounceScopeAll, want: []string{"2", "3", "4"}},
+		{name: "players on the target server", scope: AnnounceScopeTarget, want: []string{"2"}},
+		{name: "disabled", scope: AnnounceScopeNone, want: nil},
+		{name: "unknown scope", scope: "server", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := announcementRecipients(tt.scope, "1", online, "127.0.0.1:19134"); !slices.Equal(got, tt.want) {
+				t.Fatalf("announcementRecipients(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTransferAnnouncement(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "placeholders", template: "{player} joined {server}", want: "Steve joined island"},
+		{name: "repeated placeholders", template: "{player} {player} {server}", want: "Steve Steve island"},
+		{name: "no placeholders", template: "Someone moved", want: "Someone moved"},
+		{name: "unknown placeholder", template: "{player} joined {world}", want: "Steve joined {world}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatTransferAnnouncement(tt.template, "Steve", "island"); got != tt.want {
+				t.Fatalf("formatTransferAnnouncement(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/api"
+)
+
+// apiServer is the running spectrum API service, or nil if it failed to start.
+var apiServer *api.API
+
+// serveAPI accepts API connections until the API is closed. Transient accept errors are retried with
+// a growing delay and logged at most once per apiErrorLogInterval, so a persistent failure doesn't spin.
+func serveAPI(a *api.API, logger *slog.Logger) {
+	const (
+		minDelay            = 50 * time.Millisecond
+		maxDelay            = 2 * time.Second
+		apiErrorLogInterval = 10 * time.Second
+	)
+
+	var (
+		delay   time.Duration
+		lastLog time.Time
+		dropped int
+	)
+	for {
+		err := a.Accept()
+		if err == nil {
+			delay = 0
+			continue
+		}
+		if errors.Is(err, net.ErrClosed) {
+			logger.Info("API server closed")
+			return
+		}
+
+		if time.Since(lastLog) >= apiErrorLogInterval {
+			logger.Error("Failed to accept API connection", "err", err, "suppressed", dropped)
+			lastLog = time.Now()
+			dropped = 0
+		} else {
+			dropped++
+		}
+
+		if delay == 0 {
+			delay = minDelay
+		} else {
+			delay = min(delay*2, maxDelay)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// newHTTPAPI creates the HTTP server of the API, serving the event stream at /events, the online players
+// at /players and player transfers at /transfer. Every request must carry the API token, as a bearer token in the Authorization header or,
+// for browsers that can't set headers on WebSocket requests, in the token query parameter.
+func newHTTPAPI(conf *ServerConfig, proxy *spectrum.Spectrum, logger *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/events", eventStreamHandler(proxy, logger))
+	mux.Handle("GET /players", playersHandler(proxy))
+	mux.Handle("POST /transfer", transferHandler(conf, proxy, logger))
+	// There is no write timeout, as event streams stay open and transfers are answered once they completed.
+	// The event stream is hijacked from the server, which clears the read deadline.
+	return &http.Server{
+		Addr:              conf.APIServer.HTTPAddr,
+		Handler:           requireToken(conf.APIServer.Token, mux),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+}
+
+// requireToken wraps next so that it only handles requests carrying token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			provided = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// playersHandler returns the handler listing the online players, sorted by name. The server query
+// parameter limits the list to the players on the named server.
+func playersHandler(proxy *spectrum.Spectrum) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		players := collectPlayers(proxy)
+		if server := r.URL.Query().Get("server"); server != "" {
+			players = slices.DeleteFunc(players, func(p PlayerInfo) bool { return p.Server != server })
+		}
+		writeJSON(w, http.StatusOK, players)
+	})
+}
+
+// transferRequest is the body of a request to /transfer. Server may name a server group prefixed with
+// "group:", like the transfer command.
+type transferRequest struct {
+	Player string `json:"player"`
+	Server string `json:"server"`
+}
+
+// transferResponse is the body of the response to a request to /transfer.
+type transferResponse struct {
+	Success bool   `json:"success"`
+	Player  string `json:"player,omitempty"`
+	Server  string `json:"server,omitempty"`
+	// Queued is the position of the player in the join queue if the server was full.
+	Queued int    `json:"queued,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// transferHandler returns the handler transferring players on behalf of external services. It performs
+// the same checks as the transfer command: players that may not join the server are refused and players
+// transferred to a full server are queued. Other requests are answered once the player spawned on the
+// server or the transfer failed, which takes at most the transfer timeout once a transfer slot is free.
+func transferHandler(conf *ServerConfig, proxy *spectrum.Spectrum, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req transferRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, transferResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+		if req.Player == "" || req.Server == "" {
+			writeJSON(w, http.StatusBadRequest, transferResponse{Error: "player and server are required"})
+			return
+		}
+
+		s := findSession(proxy, req.Player)
+		if s == nil {
+			writeJSON(w, http.StatusNotFound, transferResponse{Player: req.Player, Error: "player not found"})
+			return
+		}
+		name, addr, err := resolveTarget(req.Server)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, transferResponse{Player: req.Player, Server: req.Server, Error: err.Error()})
+			return
+		}
+		resp := transferResponse{Player: req.Player, Server: name}
+		if denyIfNotAllowed(s, name) {
+			resp.Error = "player is not allowed to join the server"
+			writeJSON(w, http.StatusForbidden, resp)
+			return
+		}
+		if serverFullFor(s, name, addr) {
+			resp.Queued = joinQueue.Enqueue(name, s)
+			_ = sendMessage(s, queuedMessage(s, name, resp.Queued))
+			resp.Error = "server is full, the player was queued"
+			writeJSON(w, http.StatusAccepted, resp)
+			return
+		}
+
+		if err := transferSession(s, name, addr); err != nil {
+			logger.Error("Failed to transfer player requested through the HTTP API", "player", req.Player, "server", name, "error", err)
+			resp.Error = err.Error()
+			status := http.StatusBadGateway
+			switch {
+			case errors.Is(err, errTransferDenied), errors.Is(err, errTransferVetoed):
+				status = http.StatusForbidden
+			case errors.Is(err, errTransferInProgress):
+				status = http.StatusConflict
+			case errors.Is(err, context.DeadlineExceeded):
+				status = http.StatusGatewayTimeout
+			}
+			writeJSON(w, status, resp)
+			return
+		}
+		logger.Info(fmt.Sprintf("Transferred %s to %s through the HTTP API", req.Player, name))
+		resp.Success = true
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// writeJSON writes v as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum/api"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+func TestServeAPIStopsWhenClosed(t *testing.T) {
+	tests := []struct {
+		name        string
+		connections int
+	}{
+		{name: "idle"},
+		{name: "after accepting connections", connections: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.DiscardHandler)
+			a := api.NewAPI(session.NewRegistry(), logger, api.NewSecretBasedAuthentication("secret"))
+			addr := freeAddr(t)
+			if err := a.Listen(addr); err != nil {
+				t.Fatal(err)
+			}
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				serveAPI(a, logger)
+			}()
+
+			for range tt.connections {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = conn.Close()
+			}
+			_ = a.Close()
+
+			select {
+			case <-stopped:
+			case <-time.After(time.Second):
+				t.Fatal("serveAPI kept running after the API was closed")
+			}
+		})
+	}
+}
+
+// freeAddr returns a local TCP address that is free to listen on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// BansConfig configures the ban list managed with the ban and unban commands.
+type BansConfig struct {
+	// File is the JSON file the bans are stored in. Bans are disabled if it is empty.
+	File string `toml:"file"`
+	// Message is the disconnect message shown to banned players. {reason} is replaced with the reason of
+	// the ban and {expires} with the time remaining, or "never" for permanent bans.
+	Message string `toml:"message"`
+}
+
+// bans holds the banned players. It is nil if bans are disabled.
+var bans *BanManager
+
+// Ban is a banned player. Players are matched by XUID, or by name for players banned while offline by
+// name only.
+type Ban struct {
+	XUID    string    `json:"xuid,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+	// Expires is the time the ban ends, or the zero time for permanent bans.
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// Expired reports if the ban has ended at now.
+func (b Ban) Expired(now time.Time) bool {
+	return !b.Expires.IsZero() && !now.Before(b.Expires)
+}
+
+// matches reports if the ban applies to the player with the given XUID and name.
+func (b Ban) matches(xuid, name string) bool {
+	return (b.XUID != "" && b.XUID == xuid) || (b.XUID == "" && b.Name != "" && strings.EqualFold(b.Name, name))
+}
+
+// BanManager is a list of bans stored in a JSON file. The file is read when the BanManager is created and
+// written after every change. Expired bans are removed when they are looked up.
+type BanManager struct {
+	filePath string
+
+	mu   sync.Mutex
+	bans []Ban
+}
+
+// NewBanManager creates a BanManager stored in the file at path, loading the bans in it if it exists.
+func NewBanManager(path string) (*BanManager, error) {
+	m := &BanManager{filePath: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m.bans); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// save writes the bans to the file. m.mu must be held.
+func (m *BanManager) save() error {
+	b, err := json.MarshalIndent(m.bans, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.filePath, append(b, '\n'), 0644)
+}
+
+// purge removes the bans that expired at now and saves the file if any were removed. m.mu must be held.
+func (m *BanManager) purge(now time.Time) error {
+	before := len(m.bans)
+	m.bans = slices.DeleteFunc(m.bans, func(b Ban) bool { return b.Expired(now) })
+	if len(m.bans) == before {
+		return nil
+	}
+	return m.save()
+}
+
+// Add bans a player, replacing an earlier ban of the same player, and saves the file.
+func (m *BanManager) Add(ban Ban) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bans = slices.DeleteFunc(m.bans, func(b Ban) bool { return b.matches(ban.XUID, ban.Name) })
+	m.bans = append(m.bans, ban)
+	return m.save()
+}
+
+// Remove lifts the bans of the player with the given XUID or name and saves the file. It returns the
+// number of bans lifted.
+func (m *BanManager) Remove(player string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.bans)
+	m.bans = slices.DeleteFunc(m.bans, func(b Ban) bool {
+		return b.XUID == player || strings.EqualFold(b.Name, player)
+	})
+	removed := before - len(m.bans)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, m.save()
+}
+
+// Lookup returns the ban of the player with the given XUID and name that is active at now.
+func (m *BanManager) Lookup(xuid, name string, now time.Time) (Ban, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.purge(now)
+	i := slices.IndexFunc(m.bans, func(b Ban) bool { return b.matches(xuid, name) })
+	if i == -1 {
+		return Ban{}, false, err
+	}
+	return m.bans[i], true, err
+}
+
+// Bans returns the bans active at now.
+func (m *BanManager) Bans(now time.Time) ([]Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.purge(now)
+	return slices.Clone(m.bans), err
+}
+
+// banMessage returns the disconnect message shown to the player of s for the given ban.
+func banMessage(s *session.Session, conf BansConfig, ban Ban, now time.Time) string {
+	expires := "never"
+	if !ban.Expires.IsZero() {
+		expires = ban.Expires.Sub(now).Round(time.Second).String()
+	}
+	return localize(s, "banned", conf.Message, "{reason}", ban.Reason, "{expires}", expires)
+}
+
+// parseBanDuration parses the duration of a ban, a number followed by s, m, h, d (days) or w (weeks).
+func parseBanDuration(s string) (time.Duration, bool) {
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if len(s) < 2 {
+		return 0, false
+	}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// handleBanCommand bans a player, permanently or for a duration, and disconnects them if they are online.
+// Players that are offline are banned by XUID if the argument is numeric and by name otherwise.
+func handleBanCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if bans == nil {
+		logger.Info("Bans are disabled, set bans.file to enable them")
+		return
+	}
+	if len(args) == 0 {
+		logger.Info("Usage: ban <player|xuid> [duration] [reason...]")
+		return
+	}
+
+	now := time.Now()
+	ban := Ban{Name: args[0], Created: now}
+	s := findSession(proxy, args[0])
+	if s != nil {
+		ban.XUID = s.Client().IdentityData().XUID
+	} else if _, err := strconv.ParseUint(args[0], 10, 64); err == nil {
+		ban = Ban{XUID: args[0], Created: now}
+	}
+	reason := args[1:]
+	if len(reason) > 0 {
+		if d, ok := parseBanDuration(reason[0]); ok {
+			ban.Expires = now.Add(d)
+			reason = reason[1:]
+		}
+	}
+	ban.Reason = strings.Join(reason, " ")
+
+	if err := bans.Add(ban); err != nil {
+		logger.Error("Failed to save bans", "error", err)
+		return
+	}
+	duration := "permanently"
+	if !ban.Expires.IsZero() {
+		duration = fmt.Sprintf("for %s", ban.Expires.Sub(now))
+	}
+	logger.Info(fmt.Sprintf("Banned %s %s", args[0], duration))
+	if s != nil {
+		s.Disconnect(banMessage(s, conf.Bans, ban, now))
+	}
+}
+
+// handleUnbanCommand lifts the ban of a player.
+func handleUnbanCommand(args []string) {
+	logger := slog.Default()
+	if bans == nil {
+		logger.Info("Bans are disabled, set bans.file to enable them")
+		return
+	}
+	if len(args) == 0 {
+		logger.Info("Usage: unban <player|xuid>")
+		return
+	}
+
+	removed, err := bans.Remove(args[0])
+	if err != nil {
+		logger.Error("Failed to save bans", "error", err)
+		return
+	}
+	if removed == 0 {
+		logger.Info(fmt.Sprintf("%s is not banned", args[0]))
+		return
+	}
+	logger.Info(fmt.Sprintf("Unbanned %s", args[0]))
+}
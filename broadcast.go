@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// sendMessage sends a raw chat message to the client of the session.
+func sendMessage(s *session.Session, message string) error {
+	return s.Client().WritePacket(&packet.Text{
+		TextType: packet.TextTypeRaw,
+		Message:  message,
+	})
+}
+
+// connectMessage returns the connect message of the server with the given address, or an empty string if
+// the server has none.
+func connectMessage(addr string) string {
+	name, ok := serverRegistry.Name(addr)
+	if !ok {
+		return ""
+	}
+	srv, _ := serverRegistry.Get(name)
+	return srv.ConnectMessage
+}
+
+// sendConnectMessage sends the connect message of the server the session is on, if it has one.
+func sendConnectMessage(s *session.Session) {
+	identity := s.Client().IdentityData()
+	addr, ok := serverTracker.Server(identity.XUID)
+	if !ok {
+		return
+	}
+	name, _ := serverRegistry.Name(addr)
+	if message := localize(s, "connect."+name, connectMessage(addr), "{player}", identity.DisplayName); message != "" {
+		_ = sendMessage(s, message)
+	}
+}
+
+// broadcastActionBar shows a message in the action bar of all given sessions.
+func broadcastActionBar(sessions []*session.Session, message string) {
+	for _, s := range sessions {
+		_ = s.Client().WritePacket(&packet.SetTitle{
+			ActionType: packet.TitleActionSetActionBar,
+			Text:       message,
+		})
+	}
+}
+
+// broadcastMessage sends a raw chat message to all given sessions and returns how many received it.
+func broadcastMessage(sessions []*session.Session, message string) int {
+	sent := 0
+	for _, s := range sessions {
+		if err := sendMessage(s, message); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// broadcastToast shows a toast notification with the given title and message to all given sessions and
+// returns how many received it.
+func broadcastToast(sessions []*session.Session, title, message string) int {
+	sent := 0
+	for _, s := range sessions {
+		if err := s.Client().WritePacket(&packet.ToastRequest{Title: title, Message: message}); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestSendConnectMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		server string
+		want   string
+	}{
+		{name: "placeholder", server: "lobby", want: "§aWelcome to the lobby, Steve!"},
+		{name: "plain", server: "island", want: "Welcome to the Skyblock island!"},
+		{name: "no message", server: "quiet"},
+		{name: "unknown server"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t,
+				Server{Name: "lobby", Addr: "127.0.0.1:19133", ConnectMessage: "§aWelcome to the lobby, {player}!"},
+				Server{Name: "island", Addr: "127.0.0.1:19134", ConnectMessage: "Welcome to the Skyblock island!"},
+				Server{Name: "quiet", Addr: "127.0.0.1:19135"},
+			)
+			s, client := newTestSession(t, "1", "Steve", &fakeTransport{})
+			if addr, ok := serverRegistry.Lookup(tt.server); ok {
+				serverTracker.Set("1", addr)
+			}
+
+			sendConnectMessage(s)
+			// The next message marks the end of the messages sent by sendConnectMessage.
+			_ = sendMessage(s, "end")
+			want := tt.want
+			if want == "" {
+				want = "end"
+			}
+			if message, _ := nextMessage(t, client); message != want {
+				t.Fatalf("player got %q, want %q", message, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// validateCDNTLS checks that the TLS options of the CDN are complete and consistent.
+func validateCDNTLS(conf CdnConfig) error {
+	if (conf.TLSCert == "") != (conf.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	if !conf.AutoCert {
+		return nil
+	}
+	if conf.TLSCert != "" {
+		return fmt.Errorf("auto_cert can't be used together with tls_cert and tls_key")
+	}
+	if conf.Ip == "" || net.ParseIP(conf.Ip) != nil {
+		return fmt.Errorf("auto_cert requires a domain name as ip, got %q", conf.Ip)
+	}
+	if conf.AutoCertCacheDir == "" {
+		return fmt.Errorf("auto_cert requires auto_cert_cache_dir")
+	}
+	return nil
+}
+
+// certReloader holds the TLS certificate of the CDN and reloads it from disk on request. It is used as
+// the GetCertificate callback of the server, so a reloaded certificate is used from the next handshake.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader creates a certReloader and loads the certificate from certFile and keyFile.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate from disk again. If it can't be loaded, the current certificate is kept.
+func (r *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
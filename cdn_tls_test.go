@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate with the given common name and its key to certFile and
+// keyFile.
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	s, _ := newTestPackServer(t, 1000)
+	if err := s.ReloadCertificate(); err == nil {
+		t.Error("reloading the certificate succeeded without TLS enabled")
+	}
+	if err := s.EnableTLS(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	s.server.Addr = "127.0.0.1:0"
+	l, err := s.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.server.ServeTLS(l, "", "") }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	// served returns the common name of the certificate presented in a new handshake.
+	served := func() string {
+		t.Helper()
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if got := served(); got != "first" {
+		t.Fatalf("served certificate %q, want first", got)
+	}
+
+	writeTestCert(t, certFile, keyFile, "second")
+	if got := served(); got != "first" {
+		t.Fatalf("served certificate %q before the reload, want first", got)
+	}
+	if err := s.ReloadCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := served(); got != "second" {
+		t.Fatalf("served certificate %q after the reload, want second", got)
+	}
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadCertificate(); err == nil {
+		t.Error("reloading an invalid certificate succeeded")
+	}
+	if got := served(); got != "second" {
+		t.Fatalf("served certificate %q after a failed reload, want second to be kept", got)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ChatRate limits how fast a single player may send chat messages and commands.
+type ChatRate struct {
+	// PerSecond is the number of messages allowed per second. Zero disables the limit.
+	PerSecond float64 `toml:"per_second"`
+	// Burst is the number of messages allowed at once before the rate applies.
+	Burst int `toml:"burst"`
+	// Message is sent to players whose messages were dropped by the limit.
+	Message string `toml:"message"`
+}
+
+// chatCooldownInterval is the minimum interval between two cooldown messages sent to the same player.
+const chatCooldownInterval = 2 * time.Second
+
+// ChatLimitProcessor implements session.Processor by dropping chat messages and commands sent by the
+// client faster than allowed, before they reach the backend.
+type ChatLimitProcessor struct {
+	session.NopProcessor
+	s        *session.Session
+	conf     ChatRate
+	limiter  *TokenBucket
+	lastWarn time.Time
+}
+
+// NewChatLimitProcessor creates a ChatLimitProcessor for the session s.
+func NewChatLimitProcessor(s *session.Session, conf ChatRate) *ChatLimitProcessor {
+	return &ChatLimitProcessor{s: s, conf: conf, limiter: NewTokenBucket(conf.PerSecond, conf.Burst)}
+}
+
+// ProcessClient is called before forwarding the client-sent packets to the server.
+func (p *ChatLimitProcessor) ProcessClient(ctx *session.Context, pk *packet.Packet) {
+	switch (*pk).(type) {
+	case *packet.Text, *packet.CommandRequest:
+	default:
+		return
+	}
+	if _, ok := p.limiter.Reserve(0); ok {
+		return
+	}
+
+	ctx.Cancel()
+	if time.Since(p.lastWarn) >= chatCooldownInterval {
+		p.lastWarn = time.Now()
+		_ = sendMessage(p.s, localize(p.s, "chat_rate", p.conf.Message))
+	}
+}
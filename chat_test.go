@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestChatLimitProcessorDrops(t *testing.T) {
+	s, client := newTestSession(t, "1", "Steve", &fakeTransport{})
+	p := NewChatLimitProcessor(s, ChatRate{PerSecond: 0.001, Burst: 3, Message: "Slow down"})
+	process := func(pk packet.Packet) bool {
+		ctx := session.NewContext()
+		p.ProcessClient(ctx, &pk)
+		return ctx.Cancelled()
+	}
+
+	var dropped []bool
+	for range 3 {
+		dropped = append(dropped, process(&packet.Text{TextType: packet.TextTypeChat, Message: "hi"}))
+	}
+	dropped = append(dropped, process(&packet.CommandRequest{CommandLine: "/spawn"}))
+	dropped = append(dropped, process(&packet.Text{TextType: packet.TextTypeChat, Message: "hi"}))
+	want := []bool{false, false, false, true, true}
+	for i := range want {
+		if dropped[i] != want[i] {
+			t.Fatalf("dropped %v, want %v", dropped, want)
+		}
+	}
+	if process(&packet.Animate{}) {
+		t.Error("dropped a packet that is not a chat message or command over the limit")
+	}
+
+	// Players are told once that their messages were dropped, not for every dropped message.
+	if message, _ := nextMessage(t, client); message != "Slow down" {
+		t.Fatalf("player got %q, want the cooldown message", message)
+	}
+	_ = sendMessage(s, "next")
+	if message, _ := nextMessage(t, client); message != "next" {
+		t.Fatalf("player got %q after the cooldown message, want no second cooldown message", message)
+	}
+}
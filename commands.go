@@ -0,0 +1,500 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/elk-language/go-prompt"
+)
+
+// Command is a console command. New commands only need to implement Command and be registered in
+// newConsoleCommands to be dispatched, listed by help and completed in the console.
+type Command interface {
+	// Name returns the name the command is run with.
+	Name() string
+	// Aliases returns other names the command may be run with.
+	Aliases() []string
+	// Usage returns the arguments of the command, such as "<player> <server>".
+	Usage() string
+	// Description returns a short description of the command, shown in the help and in suggestions.
+	Description() string
+	// Execute runs the command with the arguments following its name.
+	Execute(args []string, proxy *spectrum.Spectrum, conf *ServerConfig)
+	// Complete returns suggestions for the last of args, the arguments typed after the name of the command
+	// so far. It returns nil if it has no suggestions.
+	Complete(c *Completer, args []string) []prompt.Suggest
+}
+
+// funcCommand is a Command running a function. Its arguments are completed by complete, if set.
+type funcCommand struct {
+	name        string
+	aliases     []string
+	usage       string
+	description string
+	run         func(args []string, proxy *spectrum.Spectrum, conf *ServerConfig)
+	complete    func(c *Completer, args []string) []prompt.Suggest
+}
+
+func (f funcCommand) Name() string        { return f.name }
+func (f funcCommand) Aliases() []string   { return f.aliases }
+func (f funcCommand) Usage() string       { return f.usage }
+func (f funcCommand) Description() string { return f.description }
+
+func (f funcCommand) Execute(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	f.run(args, proxy, conf)
+}
+
+func (f funcCommand) Complete(c *Completer, args []string) []prompt.Suggest {
+	if f.complete == nil {
+		return nil
+	}
+	return f.complete(c, args)
+}
+
+// CommandRegistry holds the console commands. handleCommand dispatches through it and the completer
+// suggests its commands, so that both always list the same commands.
+type CommandRegistry struct {
+	commands []Command
+	byName   map[string]int
+}
+
+// NewCommandRegistry creates an empty CommandRegistry.
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{byName: make(map[string]int)}
+}
+
+// Register adds a command to the registry. It panics if the name or one of the aliases of the command is
+// already taken, as that is a programming error.
+func (r *CommandRegistry) Register(cmd Command) {
+	for _, name := range append([]string{cmd.Name()}, cmd.Aliases()...) {
+		if _, ok := r.byName[name]; ok {
+			panic(fmt.Sprintf("command %q registered twice", name))
+		}
+		r.byName[name] = len(r.commands)
+	}
+	r.commands = append(r.commands, cmd)
+}
+
+// Lookup returns the command with the given name or alias.
+func (r *CommandRegistry) Lookup(name string) (Command, bool) {
+	i, ok := r.byName[name]
+	if !ok {
+		return nil, false
+	}
+	return r.commands[i], true
+}
+
+// Commands returns all commands in the order they were registered.
+func (r *CommandRegistry) Commands() []Command {
+	return slices.Clone(r.commands)
+}
+
+// consoleCommands holds the commands of the console. It is set in main, as commands such as countdown
+// run other commands through handleCommand.
+var consoleCommands *CommandRegistry
+
+// newConsoleCommands creates the registry of the console commands.
+func newConsoleCommands() *CommandRegistry {
+	r := NewCommandRegistry()
+	for _, cmd := range []Command{
+		funcCommand{name: "help", usage: "[command]", description: "List all commands or show the usage of one",
+			run:      func(args []string, _ *spectrum.Spectrum, conf *ServerConfig) { handleHelpCommand(args, r, conf) },
+			complete: completeFirst((*Completer).completeCommand)},
+		playersCommand{},
+		funcCommand{name: "find", usage: "<player>", description: "Show which server a player is on",
+			run:      func(args []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleFindCommand(args, proxy) },
+			complete: completeFirst((*Completer).completePlayerNames)},
+		transferCommand{},
+		infoCommand{},
+		funcCommand{name: "servers", description: "List configured servers",
+			run: func(_ []string, _ *spectrum.Spectrum, conf *ServerConfig) { handleServersCommand(conf) }},
+		funcCommand{name: "health", description: "Show the last known state of all servers",
+			run: func([]string, *spectrum.Spectrum, *ServerConfig) { handleHealthCommand() }},
+		funcCommand{name: "healthcheck", description: "Probe all configured servers",
+			run: func([]string, *spectrum.Spectrum, *ServerConfig) { handleHealthCheckCommand() }},
+		funcCommand{name: "latency", description: "Show the round-trip time and average player ping of every server",
+			run: func(_ []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleLatencyCommand(proxy) }},
+		funcCommand{name: "protocol", description: "Show the supported protocol version",
+			run: func([]string, *spectrum.Spectrum, *ServerConfig) { handleProtocolCommand() }},
+		funcCommand{name: "json", usage: "<players|servers|info>", description: "Run a command with JSON output",
+			run: handleJSONCommand, complete: completeFirst((*Completer).completeJSONCommand)},
+		funcCommand{name: "migrate", usage: "<from-server> <to-server>", description: "Transfer all players on a server to another server",
+			run:      func(args []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleMigrateCommand(args, proxy) },
+			complete: completeMigrateArgs},
+		funcCommand{name: "broadcast", usage: "<message...>", description: "Send a chat message to all players",
+			run: func(args []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleBroadcastCommand(args, proxy) }},
+		funcCommand{name: "broadcast-server", usage: "<server> <message...>", description: "Send a chat message to players on a server",
+			run: func(args []string, proxy *spectrum.Spectrum, _ *ServerConfig) {
+				handleBroadcastServerCommand(args, proxy)
+			},
+			complete: completeFirst((*Completer).completeServerNames)},
+		funcCommand{name: "say", usage: "[--title <title> [--]] <message...>", description: "Show a toast notification to all players",
+			run:      func(args []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleSayCommand(args, proxy) },
+			complete: completeFirst(choices(prompt.Suggest{Text: "--title", Description: "Give the toast a title, ending at --"}))},
+		funcCommand{name: "countdown", usage: "<seconds> [then:stop|then:lobby] <message...> | cancel", description: "Show a countdown in the action bar of all players",
+			run: handleCountdownCommand},
+		funcCommand{name: "drain", usage: "[seconds] | cancel", description: "Stop accepting players and stop the proxy after a countdown",
+			run:      handleDrainCommand,
+			complete: completeFirst(choices(prompt.Suggest{Text: "cancel", Description: "Cancel draining and accept players again"}))},
+		funcCommand{name: "maintenance", usage: "[on|off]", description: "Turn maintenance mode on or off",
+			run: func(args []string, _ *spectrum.Spectrum, conf *ServerConfig) { handleMaintenanceCommand(args, conf) },
+			complete: completeFirst(choices(
+				prompt.Suggest{Text: "on", Description: "Only let whitelisted players join"},
+				prompt.Suggest{Text: "off", Description: "Let all players join"},
+			))},
+		funcCommand{name: "preview-disconnect", usage: "<type> [language]", description: "Show a disconnect message as players would see it",
+			run: func(args []string, _ *spectrum.Spectrum, conf *ServerConfig) {
+				handlePreviewDisconnectCommand(args, conf)
+			},
+			complete: completeFirst(completeDisconnectMessages)},
+		funcCommand{name: "packs", usage: "<urls|reload [server]|notify> ...", description: "Inspect resource packs",
+			run: handlePacksCommand, complete: completePacksArgs},
+		funcCommand{name: "cdn", usage: "<stats|warm|recache|flush-all|reload-cert> ...", description: "Manage the resource pack CDN",
+			run: handleCDNCommand, complete: completeFirst((*Completer).completeCDNSubcommand)},
+		funcCommand{name: "queue", usage: "<list|kick|clear> ...", description: "Manage server queues",
+			run:      func(args []string, _ *spectrum.Spectrum, _ *ServerConfig) { handleQueueCommand(args) },
+			complete: completeQueueArgs},
+		funcCommand{name: "server", usage: "<add|remove|set-addr|rename> ...", description: "Manage configured servers",
+			run: handleServerCommand, complete: completeServerArgs},
+		funcCommand{name: "status", usage: "reload", description: "Manage the server list status",
+			run:      func(args []string, _ *spectrum.Spectrum, _ *ServerConfig) { handleStatusCommand(args) },
+			complete: completeFirst(choices(prompt.Suggest{Text: "reload", Description: "Reload the status from the config file"}))},
+		funcCommand{name: "reload", description: "Reload servers, observers, maintenance and other runtime settings from the config file",
+			run: func(_ []string, _ *spectrum.Spectrum, conf *ServerConfig) { handleReloadCommand(conf) }},
+		funcCommand{name: "oomph", usage: "reload", description: "Reload the Oomph Anticheat settings",
+			run:      func(args []string, _ *spectrum.Spectrum, conf *ServerConfig) { handleOomphCommand(args, conf) },
+			complete: completeFirst(choices(prompt.Suggest{Text: "reload", Description: "Reload the Oomph settings from the config file"}))},
+		funcCommand{name: "hooks", usage: "[test <event>]", description: "List or test event commands",
+			run:      func(args []string, _ *spectrum.Spectrum, _ *ServerConfig) { handleHooksCommand(args) },
+			complete: completeHooksArgs},
+		funcCommand{name: "save-config", description: "Write the current configuration to the config file",
+			run: func(_ []string, _ *spectrum.Spectrum, conf *ServerConfig) { handleSaveConfigCommand(conf) }},
+		funcCommand{name: "metrics", description: "Print proxy metrics as JSON",
+			run: func(_ []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleMetricsCommand(proxy) }},
+		funcCommand{name: "joinstats", description: "Show how long recent joins took",
+			run: func([]string, *spectrum.Spectrum, *ServerConfig) { handleJoinStatsCommand() }},
+		funcCommand{name: "history", usage: "[filter]", description: "List past commands, run one again with !<n>",
+			run: func(args []string, _ *spectrum.Spectrum, _ *ServerConfig) { handleHistoryCommand(args) }},
+		funcCommand{name: "recent", description: "List recently disconnected players",
+			run: func([]string, *spectrum.Spectrum, *ServerConfig) { handleRecentCommand() }},
+		funcCommand{name: "whitelist", usage: "<add|remove|list> [player|xuid]", description: "Manage whitelisted players",
+			run: handleWhitelistCommand, complete: completeWhitelistArgs},
+		funcCommand{name: "ban", usage: "<player|xuid> [duration] [reason...]", description: "Ban a player, optionally for a duration",
+			run: handleBanCommand, complete: completeFirst((*Completer).completePlayerNames)},
+		funcCommand{name: "unban", usage: "<player|xuid>", description: "Lift the ban of a player",
+			run:      func(args []string, _ *spectrum.Spectrum, _ *ServerConfig) { handleUnbanCommand(args) },
+			complete: completeFirst((*Completer).completeBannedPlayers)},
+		funcCommand{name: "ipban", usage: "<add|remove|list> [ip|cidr]", description: "Manage banned IP addresses",
+			run: func(args []string, _ *spectrum.Spectrum, _ *ServerConfig) { handleIPBanCommand(args) },
+			complete: completeFirst(choices(
+				prompt.Suggest{Text: "add", Description: "Ban an IP or CIDR range"},
+				prompt.Suggest{Text: "remove", Description: "Unban an IP or CIDR range"},
+				prompt.Suggest{Text: "list", Description: "List banned IPs"},
+			))},
+		funcCommand{name: "debug", usage: "[on|off]", description: "Toggle debug logging",
+			run: func(args []string, _ *spectrum.Spectrum, conf *ServerConfig) { handleDebugCommand(args, conf) },
+			complete: completeFirst(choices(
+				prompt.Suggest{Text: "on", Description: "Enable debug logging"},
+				prompt.Suggest{Text: "off", Description: "Disable debug logging"},
+			))},
+		funcCommand{name: "goroutines", description: "Dump all goroutine stacks to a file",
+			run: func([]string, *spectrum.Spectrum, *ServerConfig) { handleGoroutinesCommand() }},
+		funcCommand{name: "session", usage: "processors <player>", description: "Inspect a player's session",
+			run:      func(args []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleSessionCommand(args, proxy) },
+			complete: completePlayerSubcommand(prompt.Suggest{Text: "processors", Description: "Show the processors attached to a session"})},
+		funcCommand{name: "simulate", usage: "disconnect <player>", description: "Simulate failures (testing only)",
+			run:      func(args []string, proxy *spectrum.Spectrum, _ *ServerConfig) { handleSimulateCommand(args, proxy) },
+			complete: completePlayerSubcommand(prompt.Suggest{Text: "disconnect", Description: "Close a player's backend connection (testing only)"})},
+		stopCommand{},
+	} {
+		r.Register(cmd)
+	}
+	return r
+}
+
+// commandUsage returns the usage line of cmd.
+func commandUsage(cmd Command) string {
+	if cmd.Usage() == "" {
+		return cmd.Name()
+	}
+	return cmd.Name() + " " + cmd.Usage()
+}
+
+// handleHelpCommand lists the commands in r, or shows the usage of a single command or alias.
+func handleHelpCommand(args []string, r *CommandRegistry, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		logger.Info("Available commands:")
+		for _, cmd := range r.Commands() {
+			logger.Info(fmt.Sprintf("- %-60s %s", commandUsage(cmd), cmd.Description()))
+		}
+		logger.Info("Run 'help <command>' for details about a command")
+		return
+	}
+
+	if target, ok := conf.Aliases[args[0]]; ok {
+		logger.Info(fmt.Sprintf("%s is an alias for '%s'", args[0], target))
+		return
+	}
+	cmd, ok := r.Lookup(args[0])
+	if !ok {
+		logger.Info(fmt.Sprintf("Unknown command: %s", args[0]))
+		return
+	}
+	logger.Info(fmt.Sprintf("Usage: %s", commandUsage(cmd)))
+	logger.Info(cmd.Description())
+	if aliases := cmd.Aliases(); len(aliases) > 0 {
+		logger.Info(fmt.Sprintf("Aliases: %s", strings.Join(aliases, ", ")))
+	}
+}
+
+// playersCommand lists the players online.
+type playersCommand struct{}
+
+func (playersCommand) Name() string        { return "players" }
+func (playersCommand) Aliases() []string   { return nil }
+func (playersCommand) Usage() string       { return "" }
+func (playersCommand) Description() string { return "List all connected players" }
+
+func (playersCommand) Complete(*Completer, []string) []prompt.Suggest { return nil }
+
+func (playersCommand) Execute(_ []string, proxy *spectrum.Spectrum, _ *ServerConfig) {
+	logger := slog.Default()
+	sessions := proxy.Registry().GetSessions()
+	if len(sessions) == 0 {
+		logger.Info("No players online")
+		return
+	}
+
+	logger.Info(fmt.Sprintf("Players online (%d)", len(sessions)))
+	for _, s := range sessions {
+		playerName := s.Client().IdentityData().DisplayName
+		logger.Info(fmt.Sprintf("- %s", playerName))
+	}
+}
+
+// handleFindCommand shows the server a player is on and their ping.
+func handleFindCommand(args []string, proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	if len(args) < 1 {
+		logger.Info("Usage: find <player>")
+		return
+	}
+
+	s := findSession(proxy, args[0])
+	if s == nil {
+		logger.Info(fmt.Sprintf("Player '%s' not found", args[0]))
+		return
+	}
+	// Spectrum doesn't expose the address of the server connection, but the tracker is updated
+	// with it on every login and transfer.
+	addr, ok := serverTracker.Server(s.Client().IdentityData().XUID)
+	if !ok || s.Server() == nil {
+		logger.Info(fmt.Sprintf("%s is not connected to a server", args[0]))
+		return
+	}
+	name, ok := serverRegistry.Name(addr)
+	if !ok {
+		name = "(unknown)"
+	}
+	logger.Info(fmt.Sprintf("%s is on %s (%s), ping %dms", args[0], name, addr, s.Latency()))
+}
+
+// transferCommand transfers a player to a server or server group, queueing them if it is full.
+type transferCommand struct{}
+
+func (transferCommand) Name() string        { return "transfer" }
+func (transferCommand) Aliases() []string   { return nil }
+func (transferCommand) Usage() string       { return "<player> <server|group:name>" }
+func (transferCommand) Description() string { return "Transfer a player to another server" }
+
+func (transferCommand) Complete(c *Completer, args []string) []prompt.Suggest {
+	switch len(args) {
+	case 1:
+		return c.completePlayerNames(args[0])
+	case 2:
+		return c.completeTransferTargets(args[1])
+	}
+	return nil
+}
+
+func (t transferCommand) Execute(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) < 2 {
+		logger.Info(fmt.Sprintf("Usage: %s", commandUsage(t)))
+		return
+	}
+
+	playerName := args[0]
+	serverName := args[1]
+
+	targetSession := findSession(proxy, playerName)
+	if targetSession == nil {
+		logger.Info(fmt.Sprintf("Player '%s' not found", playerName))
+		return
+	}
+
+	serverName, serverAddr, err := resolveTarget(serverName)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Cannot transfer %s: %v", playerName, err))
+		return
+	}
+
+	if denyIfNotAllowed(targetSession, serverName) {
+		logger.Info(fmt.Sprintf("%s is not allowed to join %s", playerName, serverName))
+		return
+	}
+
+	if serverFullFor(targetSession, serverName, serverAddr) {
+		pos := joinQueue.Enqueue(serverName, targetSession)
+		_ = sendMessage(targetSession, queuedMessage(targetSession, serverName, pos))
+		logger.Info(fmt.Sprintf("%s is full, queued %s at position %d", serverName, playerName, pos))
+		return
+	}
+
+	if err := transferSession(targetSession, serverName, serverAddr); err != nil {
+		logger.Error("Failed to transfer player", "player", playerName, "server", serverName, "error", err)
+		return
+	}
+
+	logger.Info(fmt.Sprintf("Transferred %s to %s", playerName, serverName))
+}
+
+// infoCommand shows information about the proxy and the process.
+type infoCommand struct{}
+
+func (infoCommand) Name() string        { return "info" }
+func (infoCommand) Aliases() []string   { return nil }
+func (infoCommand) Usage() string       { return "" }
+func (infoCommand) Description() string { return "Show server information" }
+
+func (infoCommand) Complete(*Completer, []string) []prompt.Suggest { return nil }
+
+func (infoCommand) Execute(_ []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	logger.Info("Spectrum Proxy Information")
+	logger.Info(fmt.Sprintf("- Bind Address: %s", proxy.Opts().Addr))
+	logger.Info(fmt.Sprintf("- Default Server: %s", conf.DefaultServer))
+	logger.Info(fmt.Sprintf("- Connected Players: %d", len(proxy.Registry().GetSessions())))
+	logger.Info("Available Servers:")
+
+	for name, addr := range serverRegistry.All() {
+		logger.Info(fmt.Sprintf("- %s (%s)", name, addr))
+	}
+	logger.Info(fmt.Sprintf("Goroutines: %d", runtime.NumGoroutine()))
+	logger.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	logger.Info(fmt.Sprintf("Total Allocated Memory: %.2f MB", float64(memStats.TotalAlloc)/1024/1024))
+}
+
+// handleServersCommand lists the configured servers and the players on them.
+func handleServersCommand(conf *ServerConfig) {
+	logger := slog.Default()
+	for _, srv := range collectServers(conf) {
+		line := fmt.Sprintf("- %s (%s): %d player(s)", srv.Name, srv.Address, srv.Players)
+		if srv.Queued > 0 {
+			line += fmt.Sprintf(", %d queued", srv.Queued)
+		}
+		if srv.Default {
+			line += " [default]"
+		}
+		logger.Info(line)
+	}
+}
+
+// handleBroadcastCommand sends a chat message to all players.
+func handleBroadcastCommand(args []string, proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	if len(args) < 1 {
+		logger.Info("Usage: broadcast <message...>")
+		return
+	}
+
+	message := strings.Join(args, " ")
+	sent := broadcastMessage(proxy.Registry().GetSessions(), message)
+	logger.Info(fmt.Sprintf("Broadcast message to %d player(s)", sent))
+}
+
+// handleBroadcastServerCommand sends a chat message to the players on a server.
+func handleBroadcastServerCommand(args []string, proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	if len(args) < 2 {
+		logger.Info("Usage: broadcast-server <server> <message...>")
+		return
+	}
+
+	serverName := args[0]
+	serverAddr, ok := serverRegistry.Lookup(serverName)
+
+	if !ok {
+		logger.Info(fmt.Sprintf("Server '%s' not found", serverName))
+		return
+	}
+
+	message := strings.Join(args[1:], " ")
+	sent := broadcastMessage(sessionsOnServer(proxy, serverAddr), message)
+	logger.Info(fmt.Sprintf("Broadcast message to %d player(s) on %s", sent, serverName))
+}
+
+// handleSayCommand shows a toast notification to all players.
+func handleSayCommand(args []string, proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	// The title ends at "--", so that it may contain spaces. Without "--" it is a single word.
+	title, message := "", args
+	if len(message) > 0 && message[0] == "--title" {
+		message = message[1:]
+		if i := slices.Index(message, "--"); i != -1 {
+			title, message = strings.Join(message[:i], " "), message[i+1:]
+		} else if len(message) > 0 {
+			title, message = message[0], message[1:]
+		}
+	}
+	if len(message) == 0 {
+		logger.Info("Usage: say [--title <title> [--]] <message...>")
+		return
+	}
+
+	sent := broadcastToast(proxy.Registry().GetSessions(), title, strings.Join(message, " "))
+	logger.Info(fmt.Sprintf("Showed a toast to %d player(s)", sent))
+}
+
+// handleSaveConfigCommand writes the current configuration to the config file.
+func handleSaveConfigCommand(conf *ServerConfig) {
+	logger := slog.Default()
+	if err := writeConfig(conf); err != nil {
+		logger.Error("Failed to save config", "error", err)
+		return
+	}
+	logger.Info(fmt.Sprintf("Saved config to %s", configFile))
+}
+
+// stopCommand closes the API and resource pack servers, stops the proxy and exits.
+type stopCommand struct{}
+
+func (stopCommand) Name() string        { return "stop" }
+func (stopCommand) Aliases() []string   { return []string{"end", "exit"} }
+func (stopCommand) Usage() string       { return "" }
+func (stopCommand) Description() string { return "Stop the server" }
+
+func (stopCommand) Complete(*Completer, []string) []prompt.Suggest { return nil }
+
+func (stopCommand) Execute(_ []string, proxy *spectrum.Spectrum, _ *ServerConfig) {
+	logger := slog.Default()
+	if apiServer != nil {
+		_ = apiServer.Close()
+	}
+	if resourcePackServer != nil {
+		if err := resourcePackServer.Close(); err != nil {
+			logger.Error("Failed to close resource pack HTTP server", "error", err)
+		}
+	}
+	shutdownProxy(proxy)
+	logger.Info("Stopped proxy")
+	os.Exit(0)
+}
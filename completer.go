@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/cooldogedev/spectrum"
 	"github.com/elk-language/go-prompt"
@@ -24,32 +28,149 @@ func (c *Completer) Complete(in prompt.Document) ([]prompt.Suggest, istrings.Run
 	if len(args) <= 1 {
 		return c.completeCommand(args[0]), startIndex, endIndex
 	}
+	// Arguments of aliases are completed like those of the command they stand for.
+	if expanded, err := expandAlias(currentConfig().Aliases, args); err == nil {
+		args = expanded
+	}
 
-	// Handle command-specific completions
-	switch args[0] {
-	case "transfer":
-		if len(args) == 2 {
-			return c.completePlayerNames(args[1]), startIndex, endIndex
-		} else if len(args) == 3 {
-			return c.completeServerNames(args[2]), startIndex, endIndex
+	if cmd, ok := consoleCommands.Lookup(args[0]); ok {
+		if suggestions := cmd.Complete(c, args[1:]); suggestions != nil {
+			return suggestions, startIndex, endIndex
 		}
-	case "players":
-		return []prompt.Suggest{}, 0, 0
-	case "info":
-		return []prompt.Suggest{}, 0, 0
 	}
-
 	return []prompt.Suggest{}, 0, 0
 }
 
+// completeFirst returns a completion for commands taking a single argument, completed by complete.
+func completeFirst(complete func(c *Completer, input string) []prompt.Suggest) func(*Completer, []string) []prompt.Suggest {
+	return func(c *Completer, args []string) []prompt.Suggest {
+		if len(args) != 1 {
+			return nil
+		}
+		return complete(c, args[0])
+	}
+}
+
+// choices returns a completion of an argument with fixed options, such as subcommands.
+func choices(options ...prompt.Suggest) func(*Completer, string) []prompt.Suggest {
+	return func(_ *Completer, input string) []prompt.Suggest {
+		return prompt.FilterHasPrefix(options, input, true)
+	}
+}
+
+// completeMigrateArgs completes the source and target servers of the migrate command.
+func completeMigrateArgs(c *Completer, args []string) []prompt.Suggest {
+	if len(args) > 2 {
+		return nil
+	}
+	return c.completeServerNames(args[len(args)-1])
+}
+
+// completeWhitelistArgs completes the subcommands of the whitelist command and the player of whitelist add.
+func completeWhitelistArgs(c *Completer, args []string) []prompt.Suggest {
+	switch {
+	case len(args) == 1:
+		return choices(
+			prompt.Suggest{Text: "add", Description: "Add a player to the whitelist"},
+			prompt.Suggest{Text: "remove", Description: "Remove a player from the whitelist"},
+			prompt.Suggest{Text: "list", Description: "List whitelisted players"},
+		)(c, args[0])
+	case len(args) == 2 && args[0] == "add":
+		return c.completePlayerNames(args[1])
+	}
+	return nil
+}
+
+// completeQueueArgs completes the subcommands of the queue command, the player of queue kick and the
+// server of the other subcommands.
+func completeQueueArgs(c *Completer, args []string) []prompt.Suggest {
+	switch {
+	case len(args) == 1:
+		return c.completeQueueSubcommand(args[0])
+	case len(args) == 2 && args[0] == "kick":
+		return c.completePlayerNames(args[1])
+	case len(args) == 2:
+		return c.completeServerNames(args[1])
+	}
+	return nil
+}
+
+// completePacksArgs completes the subcommands of the packs command and the server of packs reload.
+func completePacksArgs(c *Completer, args []string) []prompt.Suggest {
+	switch {
+	case len(args) == 1:
+		return c.completePacksSubcommand(args[0])
+	case len(args) == 2 && args[0] == "reload":
+		return c.completeServerNames(args[1])
+	}
+	return nil
+}
+
+// completeServerArgs completes the subcommands of the server command and the server they change.
+func completeServerArgs(c *Completer, args []string) []prompt.Suggest {
+	switch {
+	case len(args) == 1:
+		return c.completeServerSubcommand(args[0])
+	case len(args) == 2 && args[0] != "add":
+		return c.completeServerNames(args[1])
+	case len(args) == 3 && args[0] == "remove":
+		return choices(prompt.Suggest{Text: "move", Description: "Move the players on the server to the lobby or another server"})(c, args[2])
+	case len(args) == 4 && args[0] == "remove" && args[2] == "move":
+		return c.completeServerNames(args[3])
+	}
+	return nil
+}
+
+// completeHooksArgs completes the test subcommand of the hooks command and the event it runs.
+func completeHooksArgs(c *Completer, args []string) []prompt.Suggest {
+	switch {
+	case len(args) == 1:
+		return choices(prompt.Suggest{Text: "test", Description: "Run the command of an event with example data"})(c, args[0])
+	case len(args) == 2 && args[0] == "test":
+		var suggestions []prompt.Suggest
+		for _, event := range eventNames {
+			suggestions = append(suggestions, prompt.Suggest{Text: event, Description: "Event"})
+		}
+		return prompt.FilterHasPrefix(suggestions, args[1], true)
+	}
+	return nil
+}
+
+// completeDisconnectMessages completes the disconnect message types of the preview-disconnect command.
+func completeDisconnectMessages(c *Completer, input string) []prompt.Suggest {
+	var suggestions []prompt.Suggest
+	for name := range disconnectMessages(currentConfig()) {
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: "Disconnect message"})
+	}
+	return prompt.FilterHasPrefix(suggestions, input, true)
+}
+
+// completePlayerSubcommand returns a completion for commands taking a subcommand followed by a player, such
+// as session and simulate.
+func completePlayerSubcommand(subcommands ...prompt.Suggest) func(*Completer, []string) []prompt.Suggest {
+	return func(c *Completer, args []string) []prompt.Suggest {
+		switch len(args) {
+		case 1:
+			return choices(subcommands...)(c, args[0])
+		case 2:
+			return c.completePlayerNames(args[1])
+		}
+		return nil
+	}
+}
+
 // completeCommand provides suggestions for the main commands
 func (c *Completer) completeCommand(input string) []prompt.Suggest {
-	commands := []prompt.Suggest{
-		{Text: "players", Description: "List all connected players"},
-		{Text: "transfer", Description: "Transfer a player to another server"},
-		{Text: "info", Description: "Show server information"},
-		{Text: "stop", Description: "Stop the server"},
-		{Text: "exit", Description: "Stop the server"},
+	var commands []prompt.Suggest
+	for _, cmd := range consoleCommands.Commands() {
+		commands = append(commands, prompt.Suggest{Text: cmd.Name(), Description: cmd.Description()})
+		for _, alias := range cmd.Aliases() {
+			commands = append(commands, prompt.Suggest{Text: alias, Description: cmd.Description()})
+		}
+	}
+	aliases := currentConfig().Aliases
+	for _, alias := range slices.Sorted(maps.Keys(aliases)) {
+		commands = append(commands, prompt.Suggest{Text: alias, Description: fmt.Sprintf("Alias for %s", aliases[alias])})
 	}
 
 	return prompt.FilterHasPrefix(commands, input, true)
@@ -58,6 +179,9 @@ func (c *Completer) completeCommand(input string) []prompt.Suggest {
 // completePlayerNames provides suggestions for player names
 func (c *Completer) completePlayerNames(input string) []prompt.Suggest {
 	var suggestions []prompt.Suggest
+	if proxyUnavailable(c.p) {
+		return suggestions
+	}
 
 	for _, session := range c.p.Registry().GetSessions() {
 		playerName := session.Client().IdentityData().DisplayName
@@ -70,11 +194,33 @@ func (c *Completer) completePlayerNames(input string) []prompt.Suggest {
 	return prompt.FilterHasPrefix(suggestions, input, true)
 }
 
+// completeBannedPlayers provides suggestions for banned players
+func (c *Completer) completeBannedPlayers(input string) []prompt.Suggest {
+	var suggestions []prompt.Suggest
+	if bans == nil {
+		return suggestions
+	}
+
+	active, _ := bans.Bans(time.Now())
+	for _, ban := range active {
+		text := ban.Name
+		if text == "" {
+			text = ban.XUID
+		}
+		suggestions = append(suggestions, prompt.Suggest{
+			Text:        text,
+			Description: "Banned player",
+		})
+	}
+
+	return prompt.FilterHasPrefix(suggestions, input, true)
+}
+
 // completeServerNames provides suggestions for server names
 func (c *Completer) completeServerNames(input string) []prompt.Suggest {
 	var suggestions []prompt.Suggest
 
-	for serverName, _ := range serverMap {
+	for serverName := range serverRegistry.All() {
 		suggestions = append(suggestions, prompt.Suggest{
 			Text:        serverName,
 			Description: "Available server",
@@ -84,6 +230,79 @@ func (c *Completer) completeServerNames(input string) []prompt.Suggest {
 	return prompt.FilterHasPrefix(suggestions, input, true)
 }
 
+// completeTransferTargets provides suggestions for server names and server groups
+func (c *Completer) completeTransferTargets(input string) []prompt.Suggest {
+	suggestions := c.completeServerNames(input)
+
+	var groups []prompt.Suggest
+	for group := range currentConfig().ServerGroups {
+		groups = append(groups, prompt.Suggest{
+			Text:        groupPrefix + group,
+			Description: "Least-loaded server of the group",
+		})
+	}
+
+	return append(suggestions, prompt.FilterHasPrefix(groups, input, true)...)
+}
+
+// completeServerSubcommand provides suggestions for the subcommands of the server command
+func (c *Completer) completeServerSubcommand(input string) []prompt.Suggest {
+	subcommands := []prompt.Suggest{
+		{Text: "add", Description: "Add a new server"},
+		{Text: "remove", Description: "Remove a server"},
+		{Text: "set-addr", Description: "Change the address of a server"},
+		{Text: "rename", Description: "Rename a server"},
+	}
+
+	return prompt.FilterHasPrefix(subcommands, input, true)
+}
+
+// completeQueueSubcommand provides suggestions for the subcommands of the queue command
+func (c *Completer) completeQueueSubcommand(input string) []prompt.Suggest {
+	subcommands := []prompt.Suggest{
+		{Text: "list", Description: "List queued players"},
+		{Text: "kick", Description: "Remove a player from the queue"},
+		{Text: "clear", Description: "Clear the queue of a server"},
+	}
+
+	return prompt.FilterHasPrefix(subcommands, input, true)
+}
+
+// completeJSONCommand provides suggestions for the commands supporting JSON output
+func (c *Completer) completeJSONCommand(input string) []prompt.Suggest {
+	commands := []prompt.Suggest{
+		{Text: "players", Description: "List all connected players"},
+		{Text: "servers", Description: "List configured servers"},
+		{Text: "info", Description: "Show server information"},
+	}
+
+	return prompt.FilterHasPrefix(commands, input, true)
+}
+
+// completePacksSubcommand provides suggestions for the subcommands of the packs command
+func (c *Completer) completePacksSubcommand(input string) []prompt.Suggest {
+	subcommands := []prompt.Suggest{
+		{Text: "urls", Description: "Show the download URL of each pack"},
+		{Text: "reload", Description: "Reload resource packs from disk"},
+		{Text: "notify", Description: "Ask online players to reconnect for updated packs"},
+	}
+
+	return prompt.FilterHasPrefix(subcommands, input, true)
+}
+
+// completeCDNSubcommand provides suggestions for the subcommands of the cdn command
+func (c *Completer) completeCDNSubcommand(input string) []prompt.Suggest {
+	subcommands := []prompt.Suggest{
+		{Text: "stats", Description: "Show CDN statistics"},
+		{Text: "warm", Description: "Load all packs into the cache"},
+		{Text: "recache", Description: "Re-read a resource pack, or all packs, from disk into the cache"},
+		{Text: "flush-all", Description: "Clear the cache and reload all packs from disk"},
+		{Text: "reload-cert", Description: "Reload the CDN TLS certificate from disk"},
+	}
+
+	return prompt.FilterHasPrefix(subcommands, input, true)
+}
+
 // NewCompleter creates a new Completer instance
 func NewCompleter(p *spectrum.Spectrum) *Completer {
 	return &Completer{p: p}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/pelletier/go-toml"
+)
+
+// configFile is the config file read at startup and written by save-config. With layered config files,
+// it is the base file.
+var configFile = "config.toml"
+
+// errLayeredConfig is returned when writing the configuration while layered config files are used.
+// Writing the merged configuration would flatten the override files into the base file.
+var errLayeredConfig = errors.New("the configuration can't be saved while layered config files are used, edit the config files instead")
+
+// configPaths holds the config files passed with -config.
+var configPaths configLayers
+
+// configLayers is the list of config files passed with -config.
+type configLayers []string
+
+func (l *configLayers) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *configLayers) Set(path string) error {
+	*l = append(*l, path)
+	return nil
+}
+
+// loadConfig reads the configuration from the config files passed with -config, or from the default
+// config file if none or one was passed.
+func loadConfig(regenerateBroken bool) (*ServerConfig, error) {
+	if len(configPaths) > 1 {
+		return readLayeredConfig(configPaths, regenerateBroken)
+	}
+	return readConfig(regenerateBroken)
+}
+
+// readLayeredConfig reads the config files at paths in order and merges them over the default
+// configuration, later files overriding earlier ones. Tables (including maps such as tags) are merged
+// key by key, while any other value, including arrays such as servers, is replaced as a whole by the
+// last file setting it. All files must exist. If a file can't be parsed and regenerateBroken is true, it
+// is moved to <file>.bak and replaced with an empty file, so the proxy starts without that layer.
+func readLayeredConfig(paths []string, regenerateBroken bool) (*ServerConfig, error) {
+	merged, _ := toml.TreeFromMap(map[string]any{})
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := toml.LoadBytes(data)
+		if err != nil {
+			if !regenerateBroken {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if err := regenerateConfigLayer(path, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		mergeTrees(merged, tree)
+	}
+
+	conf := defaultConfig()
+	if err := merged.Unmarshal(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// regenerateConfigLayer backs up the unparsable config file at path to <file>.bak and writes an empty
+// file in its place.
+func regenerateConfigLayer(path string, parseErr error) error {
+	backup := path + ".bak"
+	if err := os.Rename(path, backup); err != nil {
+		return fmt.Errorf("back up broken config: %w", err)
+	}
+	logger := slog.Default()
+	logger.Error(fmt.Sprintf("Failed to parse %s, it was moved to %s", path, backup), "error", parseErr)
+	logger.Error(fmt.Sprintf("The proxy is starting WITHOUT the settings of %s, fix %s and restore it", path, backup))
+	return os.WriteFile(path, nil, 0644)
+}
+
+// mergeTrees merges src into dst. Tables present in both are merged recursively, all other values in src
+// replace the ones in dst.
+func mergeTrees(dst, src *toml.Tree) {
+	for _, key := range src.Keys() {
+		path := []string{key}
+		srcValue := src.GetPath(path)
+		if srcTree, ok := srcValue.(*toml.Tree); ok {
+			if dstTree, ok := dst.GetPath(path).(*toml.Tree); ok {
+				mergeTrees(dstTree, srcTree)
+				continue
+			}
+		}
+		dst.SetPath(path, srcValue)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+func TestMergeTrees(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     map[string]any
+	}{
+		{
+			name:     "override",
+			base:     "name = \"base\"\nmax_players = 10",
+			override: "name = \"override\"",
+			want:     map[string]any{"name": "override", "max_players": int64(10)},
+		},
+		{
+			name:     "nested table",
+			base:     "[tags]\nregion = \"eu\"\ntier = \"free\"\n[cdn.socket]\npath = \"/tmp/cdn.sock\"",
+			override: "[tags]\ntier = \"paid\"\n[cdn.socket]\nmode = 432",
+			want: map[string]any{
+				"tags": map[string]any{"region": "eu", "tier": "paid"},
+				"cdn":  map[string]any{"socket": map[string]any{"path": "/tmp/cdn.sock", "mode": int64(432)}},
+			},
+		},
+		{
+			name:     "array replacement",
+			base:     "[[servers]]\nname = \"lobby\"\n[[servers]]\nname = \"island\"\n[groups]\ngames = [\"a\", \"b\"]",
+			override: "[[servers]]\nname = \"hub\"\n[groups]\ngames = [\"c\"]",
+			want: map[string]any{
+				"servers": []any{map[string]any{"name": "hub"}},
+				"groups":  map[string]any{"games": []any{"c"}},
+			},
+		},
+		{
+			name:     "table replacing a value",
+			base:     "motd = \"text\"",
+			override: "[motd]\ntext = \"table\"",
+			want:     map[string]any{"motd": map[string]any{"text": "table"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := toml.Load(tt.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			override, err := toml.Load(tt.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mergeTrees(base, override)
+			if got := base.ToMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("merged tree = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLayeredConfig(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.toml")
+	override := filepath.Join(dir, "production.toml")
+	if err := os.WriteFile(base, []byte("name = \"Base\"\nmax_players = 10\n[[servers]]\nname = \"lobby\"\naddr = \"127.0.0.1:19133\"\n[[servers]]\nname = \"island\"\naddr = \"127.0.0.1:19134\"\n[transfer_metadata.tags]\nregion = \"eu\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte("max_players = 500\n[[servers]]\nname = \"lobby\"\naddr = \"10.0.0.1:19133\"\n[transfer_metadata.tags]\ntier = \"paid\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := readLayeredConfig([]string{base, override}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Name != "Base" || conf.MaxPlayers != 500 {
+		t.Errorf("name %q and max players %d, want the name of the base and the max players of the override", conf.Name, conf.MaxPlayers)
+	}
+	if want := []Server{{Name: "lobby", Addr: "10.0.0.1:19133"}}; !reflect.DeepEqual(conf.Servers, want) {
+		t.Errorf("servers = %+v, want the servers of the override only", conf.Servers)
+	}
+	if want := map[string]string{"region": "eu", "tier": "paid"}; !reflect.DeepEqual(conf.TransferMetadata.Tags, want) {
+		t.Errorf("tags = %v, want %v", conf.TransferMetadata.Tags, want)
+	}
+	if conf.BindAddr != defaultConfig().BindAddr {
+		t.Errorf("bind address %q, want the default for a setting in neither file", conf.BindAddr)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// ConnectionLog configures the audit log of connection attempts.
+type ConnectionLog struct {
+	// Enabled writes a record with the handshake details of every connection attempt to File.
+	Enabled bool `toml:"enabled"`
+	// File is the path of the log file, one JSON record per line.
+	File string `toml:"file"`
+	// MaxSizeMB is the size at which the file is rotated.
+	MaxSizeMB int `toml:"max_size_mb"`
+	// MaxFiles is how many rotated files (File.1, File.2, ...) are kept.
+	MaxFiles int `toml:"max_files"`
+}
+
+// connectionLog records connection attempts. It is nil if the connection log is disabled.
+var connectionLog *ConnectionLogger
+
+// ConnectionRecord holds the handshake details of a single connection attempt.
+type ConnectionRecord struct {
+	Time          time.Time `json:"time"`
+	Session       string    `json:"session"`
+	Address       string    `json:"address"`
+	Name          string    `json:"name"`
+	XUID          string    `json:"xuid"`
+	DeviceID      string    `json:"device_id"`
+	DeviceModel   string    `json:"device_model"`
+	DeviceOS      int       `json:"device_os"`
+	GameVersion   string    `json:"game_version"`
+	Protocol      int32     `json:"protocol"`
+	Authenticated bool      `json:"authenticated"`
+}
+
+// newConnectionRecord builds the record of a connection attempt from the login of conn. Authenticated is
+// false for clients with a self-signed identity, which can claim any name and XUID.
+func newConnectionRecord(conn *minecraft.Conn, sessionID string, at time.Time) ConnectionRecord {
+	identity, client := conn.IdentityData(), conn.ClientData()
+	return ConnectionRecord{
+		Time:          at,
+		Session:       sessionID,
+		Address:       conn.RemoteAddr().String(),
+		Name:          identity.DisplayName,
+		XUID:          identity.XUID,
+		DeviceID:      client.DeviceID,
+		DeviceModel:   client.DeviceModel,
+		DeviceOS:      int(client.DeviceOS),
+		GameVersion:   client.GameVersion,
+		Protocol:      conn.Proto().ID(),
+		Authenticated: conn.Authenticated(),
+	}
+}
+
+// ConnectionLogger writes connection records to a file, rotating it once it reaches its maximum size.
+type ConnectionLogger struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewConnectionLogger opens the log file configured in conf, creating its directory if needed.
+func NewConnectionLogger(conf ConnectionLog) (*ConnectionLogger, error) {
+	if conf.File == "" {
+		return nil, fmt.Errorf("connection log file is not set")
+	}
+	if err := os.MkdirAll(filepath.Dir(conf.File), 0755); err != nil {
+		return nil, err
+	}
+	l := &ConnectionLogger{path: conf.File, maxSize: int64(conf.MaxSizeMB) * 1024 * 1024, maxFiles: conf.MaxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record writes r to the log as a single line of JSON.
+func (l *ConnectionLogger) Record(r ConnectionRecord) error {
+	if l == nil {
+		return nil
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// open opens the log file for appending. l.mu must be held or l not yet shared.
+func (l *ConnectionLogger) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts a new log file. l.mu must be
+// held.
+func (l *ConnectionLogger) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	if l.maxFiles > 0 {
+		_ = os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
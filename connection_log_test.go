@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+)
+
+func TestNewConnectionRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity login.IdentityData
+		wantXUID string
+	}{
+		{name: "xbox identity", identity: login.IdentityData{XUID: "2535", DisplayName: "Steve"}, wantXUID: "2535"},
+		{name: "self-signed identity", identity: login.IdentityData{DisplayName: "Steve"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := acceptTestConn(t, minecraft.Dialer{
+				IdentityData:        tt.identity,
+				ClientData:          login.ClientData{DeviceID: "device-1", DeviceModel: "Pixel 8", DeviceOS: protocol.DeviceAndroid, GameVersion: protocol.CurrentVersion},
+				KeepXBLIdentityData: tt.identity.XUID != "",
+				ErrorLog:            slog.New(slog.DiscardHandler),
+			})
+
+			at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			got := newConnectionRecord(conn, "abc123", at)
+			want := ConnectionRecord{
+				Time:          at,
+				Session:       "abc123",
+				Address:       conn.RemoteAddr().String(),
+				Name:          "Steve",
+				XUID:          tt.wantXUID,
+				DeviceID:      "device-1",
+				DeviceModel:   "Pixel 8",
+				DeviceOS:      int(protocol.DeviceAndroid),
+				GameVersion:   protocol.CurrentVersion,
+				Protocol:      protocol.CurrentProtocol,
+				Authenticated: tt.wantXUID != "",
+			}
+			if got != want {
+				t.Fatalf("newConnectionRecord() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// acceptTestConn returns the server side of a connection dialed with dialer.
+func acceptTestConn(t *testing.T, dialer minecraft.Dialer) *minecraft.Conn {
+	t.Helper()
+	l, err := minecraft.ListenConfig{AuthenticationDisabled: true, ErrorLog: slog.New(slog.DiscardHandler)}.Listen("raknet", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	// The dial doesn't complete as the game is never started, it fails once the connection is closed.
+	go func() {
+		if client, err := dialer.Dial("raknet", l.Addr().String()); err == nil {
+			_ = client.Close()
+		}
+	}()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := c.(*minecraft.Conn)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestConnectionLoggerRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "connections.log")
+	l, err := NewConnectionLogger(ConnectionLog{File: path, MaxSizeMB: 1, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.f.Close() })
+	// Rotate after every record instead of after a megabyte.
+	l.maxSize = 1
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := l.Record(ConnectionRecord{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, want := range map[string]string{path: "d", path + ".1": "c", path + ".2": "b"} {
+		if got := readConnectionRecord(t, file).Name; got != want {
+			t.Errorf("%s holds the record of %q, want %q", filepath.Base(file), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than max_files rotated files were kept: %v", err)
+	}
+}
+
+// readConnectionRecord reads the only record in the file at path.
+func readConnectionRecord(t *testing.T, path string) ConnectionRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []ConnectionRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r ConnectionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 1 {
+		t.Fatalf("%s holds %d records, want 1", filepath.Base(path), len(records))
+	}
+	return records[0]
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+const countdownUsage = "Usage: countdown <seconds> [then:stop|then:lobby] <message...> or countdown cancel"
+
+var (
+	countdownMu sync.Mutex
+	// cancelCountdown cancels the running countdown, or is nil if none is running.
+	cancelCountdown context.CancelFunc
+)
+
+// countdownText returns the action bar text shown with the given number of seconds remaining. The
+// {seconds} placeholder in message is replaced, or the seconds are appended if it has none.
+func countdownText(message string, remaining int) string {
+	if strings.Contains(message, "{seconds}") {
+		return strings.ReplaceAll(message, "{seconds}", strconv.Itoa(remaining))
+	}
+	return fmt.Sprintf("%s %ds", message, remaining)
+}
+
+// handleCountdownCommand starts or cancels a countdown shown in the action bar of all players.
+func handleCountdownCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 1 && args[0] == "cancel" {
+		countdownMu.Lock()
+		cancel := cancelCountdown
+		cancelCountdown = nil
+		countdownMu.Unlock()
+		if cancel == nil {
+			logger.Info("No countdown is running")
+			return
+		}
+		cancel()
+		logger.Info("Cancelled countdown")
+		return
+	}
+	if len(args) < 2 {
+		logger.Info(countdownUsage)
+		return
+	}
+
+	seconds, err := strconv.Atoi(args[0])
+	if err != nil || seconds <= 0 {
+		logger.Info(fmt.Sprintf("Invalid number of seconds: %s", args[0]))
+		return
+	}
+	var then string
+	if action, ok := strings.CutPrefix(args[1], "then:"); ok {
+		if action != "stop" && action != "lobby" {
+			logger.Info(fmt.Sprintf("Unknown countdown action: %s", action))
+			return
+		}
+		then, args = action, args[1:]
+	}
+	if len(args) < 2 {
+		logger.Info(countdownUsage)
+		return
+	}
+	message := strings.Join(args[1:], " ")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	countdownMu.Lock()
+	if cancelCountdown != nil {
+		countdownMu.Unlock()
+		cancel()
+		logger.Info("A countdown is already running, use 'countdown cancel' first")
+		return
+	}
+	cancelCountdown = cancel
+	countdownMu.Unlock()
+
+	logger.Info(fmt.Sprintf("Started %d second countdown", seconds))
+	go runCountdown(ctx, seconds, message, then, proxy, logger)
+}
+
+// runCountdown shows the countdown every second until it reaches zero or ctx is cancelled, then runs the
+// follow-up action.
+func runCountdown(ctx context.Context, seconds int, message, then string, proxy *spectrum.Spectrum, logger *slog.Logger) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for remaining := seconds; remaining > 0; remaining-- {
+		broadcastActionBar(proxy.Registry().GetSessions(), countdownText(message, remaining))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+
+	countdownMu.Lock()
+	cancelCountdown = nil
+	countdownMu.Unlock()
+	logger.Info("Countdown finished")
+
+	switch then {
+	case "stop":
+		handleCommand("stop", proxy)
+	case "lobby":
+		_, lobby := serverRegistry.Lobby()
+		var moving []*session.Session
+		for _, s := range proxy.Registry().GetSessions() {
+			if current, ok := serverTracker.Server(s.Client().IdentityData().XUID); !ok || current != lobby {
+				moving = append(moving, s)
+			}
+		}
+		moveToLobby(moving, logger)
+	}
+}
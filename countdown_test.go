@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestCountdownText(t *testing.T) {
+	tests := []struct {
+		message   string
+		remaining int
+		want      string
+	}{
+		{message: "Restarting in {seconds}s", remaining: 10, want: "Restarting in 10s"},
+		{message: "{seconds}... {seconds}", remaining: 3, want: "3... 3"},
+		{message: "Event starts in", remaining: 5, want: "Event starts in 5s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := countdownText(tt.message, tt.remaining); got != tt.want {
+				t.Fatalf("countdownText(%q, %d) = %q, want %q", tt.message, tt.remaining, got, tt.want)
+			}
+		})
+	}
+}
+
+// nextActionBar returns the text of the next action bar shown to client.
+func nextActionBar(t *testing.T, client *minecraft.Conn) string {
+	t.Helper()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		pk, err := client.ReadPacket()
+		if err != nil {
+			t.Fatalf("read packet: %v", err)
+		}
+		if title, ok := pk.(*packet.SetTitle); ok && title.ActionType == packet.TitleActionSetActionBar {
+			return title.Text
+		}
+	}
+}
+
+func TestRunCountdown(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+	transport := &fakeTransport{}
+	proxy := spectrum.NewSpectrum(LobbyDiscovery{}, slog.New(slog.DiscardHandler), nil, transport)
+	s, client := newTestSession(t, "1", "Steve", transport)
+	proxy.Registry().AddSession("1", s)
+	logs := captureLogs(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runCountdown(context.Background(), 2, "Starting in {seconds}", "", proxy, slog.Default())
+	}()
+	var shown []string
+	for range 2 {
+		shown = append(shown, nextActionBar(t, client))
+	}
+	<-done
+	if want := []string{"Starting in 2", "Starting in 1"}; !slices.Equal(shown, want) {
+		t.Fatalf("shown %v, want %v", shown, want)
+	}
+	if !strings.Contains(logs.String(), "Countdown finished") {
+		t.Error("the finished countdown was not logged")
+	}
+}
+
+func TestCountdownCancel(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+	proxy := spectrum.NewSpectrum(LobbyDiscovery{}, slog.New(slog.DiscardHandler), nil, &fakeTransport{})
+	logs := captureLogs(t)
+
+	handleCountdownCommand([]string{"60", "then:stop", "Restarting"}, proxy, &ServerConfig{})
+	handleCountdownCommand([]string{"60", "Again"}, proxy, &ServerConfig{})
+	handleCountdownCommand([]string{"cancel"}, proxy, &ServerConfig{})
+	handleCountdownCommand([]string{"cancel"}, proxy, &ServerConfig{})
+
+	for _, want := range []string{"Started 60 second countdown", "A countdown is already running", "Cancelled countdown", "No countdown is running"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("countdown commands logged %q, want %q", logs.String(), want)
+		}
+	}
+	countdownMu.Lock()
+	defer countdownMu.Unlock()
+	if cancelCountdown != nil {
+		t.Error("a countdown is still running after it was cancelled")
+	}
+}
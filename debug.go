@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// logLevel is the level of the console logger, which can be changed at runtime with the debug command.
+var logLevel slog.LevelVar
+
+// setDebug sets the log level for debug mode being enabled or disabled.
+func setDebug(enabled bool) {
+	if enabled {
+		logLevel.Set(slog.LevelDebug)
+	} else {
+		logLevel.Set(slog.LevelInfo)
+	}
+	slog.SetLogLoggerLevel(logLevel.Level())
+}
+
+// handleDebugCommand turns debug mode on or off, or reports whether it is on.
+func handleDebugCommand(args []string, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		logger.Info(fmt.Sprintf("Debug mode is %s", onOff(conf.Debug)))
+		return
+	}
+
+	var enabled bool
+	switch args[0] {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		logger.Info("Usage: debug [on|off]")
+		return
+	}
+	updateConfig(func(conf *ServerConfig) { conf.Debug = enabled })
+	setDebug(enabled)
+	logger.Info(fmt.Sprintf("Debug mode is now %s (log level %s)", onOff(enabled), logLevel.Level()))
+	logger.Debug("Debug logging enabled")
+}
+
+// onOff returns "on" if b is true and "off" otherwise.
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// maxStackDumpSize is the largest goroutine dump written by dumpGoroutines. Dumps larger than this are
+// truncated.
+const maxStackDumpSize = 64 << 20
+
+// dumpGoroutines writes the stacks of all goroutines to a new file in dir and returns the path of the file
+// and the number of goroutines at the time of the dump.
+func dumpGoroutines(dir string) (string, int, error) {
+	count := runtime.NumGoroutine()
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackDumpSize {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, min(len(buf)*2, maxStackDumpSize))
+	}
+
+	file := filepath.Join(dir, fmt.Sprintf("goroutines-%s.txt", time.Now().Format("20060102-150405")))
+	if err := os.WriteFile(file, buf, 0644); err != nil {
+		return "", 0, err
+	}
+	return file, count, nil
+}
+
+// handleGoroutinesCommand dumps the stacks of all goroutines to a file in the working directory.
+func handleGoroutinesCommand() {
+	logger := slog.Default()
+	file, count, err := dumpGoroutines(".")
+	if err != nil {
+		logger.Error("Failed to dump goroutines", "error", err)
+		return
+	}
+	logger.Info(fmt.Sprintf("Dumped %d goroutines to %s", count, file))
+}
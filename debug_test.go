@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parkForDump signals started and blocks until release is closed, so that its goroutine shows up in a
+// goroutine dump.
+func parkForDump(started, release chan struct{}) {
+	close(started)
+	<-release
+}
+
+func TestDumpGoroutines(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	go parkForDump(started, release)
+	<-started
+
+	dir := t.TempDir()
+	file, count, err := dumpGoroutines(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(file) != dir {
+		t.Errorf("dumped to %s, want a file in %s", file, dir)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "parkForDump") {
+		t.Error("dump doesn't hold the stack of a parked goroutine")
+	}
+	if count < 2 {
+		t.Errorf("reported %d goroutines, want at least the test and the parked goroutine", count)
+	}
+
+	if _, _, err := dumpGoroutines(filepath.Join(dir, "missing")); err == nil {
+		t.Error("dumping to a missing directory succeeded")
+	}
+}
+
+func TestDebugCommand(t *testing.T) {
+	useConfig(t, defaultConfig())
+	t.Cleanup(func() { setDebug(false) })
+	setDebug(false)
+	logger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(logger) })
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: &logLevel})))
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantDebug bool
+	}{
+		{name: "on", args: []string{"on"}, wantDebug: true},
+		{name: "status", wantDebug: true},
+		{name: "invalid", args: []string{"maybe"}, wantDebug: true},
+		{name: "off", args: []string{"off"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			handleDebugCommand(tt.args, currentConfig())
+			slog.Debug("debug-only entry")
+
+			if currentConfig().Debug != tt.wantDebug {
+				t.Errorf("debug in the live config = %v, want %v", currentConfig().Debug, tt.wantDebug)
+			}
+			wantLevel := slog.LevelInfo
+			if tt.wantDebug {
+				wantLevel = slog.LevelDebug
+			}
+			if logLevel.Level() != wantLevel {
+				t.Errorf("log level = %s, want %s", logLevel.Level(), wantLevel)
+			}
+			if logged := strings.Contains(buf.String(), "debug-only entry"); logged != tt.wantDebug {
+				t.Errorf("debug entries logged: %v, want %v", logged, tt.wantDebug)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Drain configures how the proxy is drained before it shuts down.
+type Drain struct {
+	// Seconds is how long players are given before the proxy stops if drain is run without a duration,
+	// and when the proxy is interrupted.
+	Seconds int `toml:"seconds"`
+	// Message is broadcast to all players while draining. {seconds} is replaced with the seconds left.
+	Message string `toml:"message"`
+	// JoinMessage is the disconnect message shown to players joining while the proxy is draining.
+	JoinMessage string `toml:"join_message"`
+	// Fallback is the address (host:port) of another proxy players are transferred to when draining
+	// finishes. Players are disconnected with the shutdown message if it is empty.
+	Fallback string `toml:"fallback"`
+}
+
+var (
+	// draining is set while the proxy is draining. New sessions are turned away in the meantime.
+	draining atomic.Bool
+
+	drainMu sync.Mutex
+	// cancelDrain cancels the running drain, or is nil if none is running.
+	cancelDrain context.CancelFunc
+)
+
+// drainAnnounceAt reports if the drain message is broadcast with the given number of seconds remaining.
+func drainAnnounceAt(remaining, total int) bool {
+	return remaining == total || remaining%30 == 0 || remaining == 10 || remaining <= 5
+}
+
+// handleDrainCommand starts draining the proxy, stopping it after the given number of seconds, or
+// cancels a running drain.
+func handleDrainCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 1 && args[0] == "cancel" {
+		drainMu.Lock()
+		cancel := cancelDrain
+		cancelDrain = nil
+		drainMu.Unlock()
+		if cancel == nil {
+			logger.Info("The proxy is not draining")
+			return
+		}
+		cancel()
+		draining.Store(false)
+		logger.Info("Cancelled drain, accepting new players again")
+		return
+	}
+
+	seconds := conf.Drain.Seconds
+	if len(args) >= 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			logger.Info(fmt.Sprintf("Invalid number of seconds: %s", args[0]))
+			logger.Info("Usage: drain [seconds] or drain cancel")
+			return
+		}
+		seconds = n
+	}
+	go func() {
+		if drainProxy(proxy, conf, seconds, logger) {
+			os.Exit(0)
+		}
+	}()
+}
+
+// drainProxy turns away new players, counts down for the given number of seconds while broadcasting the
+// drain message, then moves the remaining players to the fallback proxy or disconnects them and closes
+// the proxy. It returns false if the drain was cancelled or another drain is already running.
+func drainProxy(proxy *spectrum.Spectrum, conf *ServerConfig, seconds int, logger *slog.Logger) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	drainMu.Lock()
+	if cancelDrain != nil {
+		drainMu.Unlock()
+		cancel()
+		logger.Info("The proxy is already draining, use 'drain cancel' first")
+		return false
+	}
+	cancelDrain = cancel
+	drainMu.Unlock()
+
+	draining.Store(true)
+	logger.Info(fmt.Sprintf("Draining the proxy, stopping in %d seconds", seconds))
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for remaining := seconds; remaining > 0; remaining-- {
+		if drainAnnounceAt(remaining, seconds) {
+			broadcastMessage(proxy.Registry().GetSessions(), countdownText(conf.Drain.Message, remaining))
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+
+	if conf.Drain.Fallback != "" {
+		moved := transferToFallbackProxy(proxy, conf.Drain.Fallback, logger)
+		logger.Info(fmt.Sprintf("Moved %d player(s) to %s", moved, conf.Drain.Fallback))
+	}
+	for _, s := range proxy.Registry().GetSessions() {
+		if conn := s.Server(); conn != nil {
+			_ = conn.WritePacket(&packet.Disconnect{})
+		}
+	}
+	shutdownProxy(proxy)
+	logger.Info("Stopped proxy")
+	return true
+}
+
+// transferToFallbackProxy sends all players a transfer to the proxy at addr and returns how many players
+// were sent it.
+func transferToFallbackProxy(proxy *spectrum.Spectrum, addr string, logger *slog.Logger) int {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		logger.Error("Invalid drain fallback address", "address", addr, "error", err)
+		return 0
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		logger.Error("Invalid drain fallback port", "address", addr, "error", err)
+		return 0
+	}
+
+	moved := 0
+	for _, s := range proxy.Registry().GetSessions() {
+		if err := s.Client().WritePacket(&packet.Transfer{Address: host, Port: uint16(port)}); err == nil {
+			_ = s.Client().Flush()
+			moved++
+		}
+	}
+	return moved
+}
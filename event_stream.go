@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// StreamEventHello is the first event sent to a new subscriber, listing the players online.
+	StreamEventHello = "hello"
+	// StreamEventHeartbeat is sent to subscribers periodically so they can detect dead connections.
+	StreamEventHeartbeat = "heartbeat"
+	// StreamEventJoin is sent after a player logged in to their first server.
+	StreamEventJoin = "join"
+	// StreamEventQuit is sent after a player disconnected from the proxy.
+	StreamEventQuit = "quit"
+	// StreamEventTransfer is sent after a player was transferred to another server.
+	StreamEventTransfer = "transfer"
+)
+
+// streamHeartbeatInterval is the interval at which heartbeat events are sent to subscribers.
+const streamHeartbeatInterval = 15 * time.Second
+
+// StreamEvent is an event sent to the subscribers of the event stream as a JSON text frame.
+type StreamEvent struct {
+	// ID increases by one for every join, quit and transfer event, so subscribers can tell if they missed
+	// events while reconnecting. Hello and heartbeat events carry the ID of the last event.
+	ID     uint64    `json:"id"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Player string    `json:"player,omitempty"`
+	XUID   string    `json:"xuid,omitempty"`
+	// From and To are the names of the servers of a transfer, Server the server a player joined or quit on.
+	Server string `json:"server,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Players lists the players online in hello events.
+	Players []PlayerInfo `json:"players,omitempty"`
+}
+
+// eventStream sends player events to the subscribers of the HTTP API.
+var eventStream = NewEventStream()
+
+// EventStream fans out events to its subscribers. Subscribers that can't keep up miss events instead of
+// slowing down the proxy.
+type EventStream struct {
+	lastID atomic.Uint64
+
+	mu          sync.Mutex
+	subscribers map[chan StreamEvent]struct{}
+}
+
+// NewEventStream creates an EventStream without subscribers.
+func NewEventStream() *EventStream {
+	return &EventStream{subscribers: make(map[chan StreamEvent]struct{})}
+}
+
+// Publish assigns the event the next ID and sends it to all subscribers.
+func (e *EventStream) Publish(event StreamEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	event.ID, event.Time = e.lastID.Add(1), time.Now()
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving all events published from now on, and the ID of the last event
+// published before.
+func (e *EventStream) Subscribe() (chan StreamEvent, uint64) {
+	ch := make(chan StreamEvent, 64)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subscribers[ch] = struct{}{}
+	return ch, e.lastID.Load()
+}
+
+// Unsubscribe stops sending events to ch.
+func (e *EventStream) Unsubscribe(ch chan StreamEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.subscribers, ch)
+}
+
+// eventStreamHandler returns the handler of the event stream WebSocket. Subscribers first receive a hello
+// event listing the players online, so that they can resynchronise after reconnecting, then every player
+// event and a heartbeat event every streamHeartbeatInterval.
+func eventStreamHandler(proxy *spectrum.Spectrum, logger *slog.Logger) http.Handler {
+	return websocket.Server{
+		// Dashboards may be served from any origin, requests are authenticated with the token instead.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ch, lastID := eventStream.Subscribe()
+			defer eventStream.Unsubscribe(ch)
+			logger.Debug("Event stream subscriber connected", "address", ws.Request().RemoteAddr)
+
+			// Reading detects subscribers that closed the connection, the frames they send are ignored.
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+			}()
+
+			heartbeat := time.NewTicker(streamHeartbeatInterval)
+			defer heartbeat.Stop()
+			event := StreamEvent{ID: lastID, Type: StreamEventHello, Time: time.Now(), Players: collectPlayers(proxy)}
+			for {
+				b, _ := json.Marshal(event)
+				if err := websocket.Message.Send(ws, string(b)); err != nil {
+					return
+				}
+				select {
+				case <-closed:
+					return
+				case event = <-ch:
+					lastID = event.ID
+				case <-heartbeat.C:
+					event = StreamEvent{ID: lastID, Type: StreamEventHeartbeat, Time: time.Now()}
+				}
+			}
+		},
+	}
+}
+
+// publishJoin publishes the join event of the player of s.
+func publishJoin(s *session.Session) {
+	data := playerEventData(s)
+	eventStream.Publish(StreamEvent{Type: StreamEventJoin, Player: data["player"], XUID: data["xuid"], Server: data["server"]})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+const (
+	// EventPlayerJoin is dispatched after a player logged in to their first server.
+	EventPlayerJoin = "player_join"
+	// EventPlayerLeave is dispatched after a player disconnected from the proxy.
+	EventPlayerLeave = "player_leave"
+	// EventServerDown is dispatched when the health checker finds a server with players on it unreachable.
+	EventServerDown = "server_down"
+	// EventProxyStart is dispatched once the proxy accepts players.
+	EventProxyStart = "proxy_start"
+	// EventProxyStop is dispatched when the proxy is stopped from the console.
+	EventProxyStop = "proxy_stop"
+)
+
+// eventNames lists all events that commands can be configured for.
+var eventNames = []string{EventPlayerJoin, EventPlayerLeave, EventServerDown, EventProxyStart, EventProxyStop}
+
+// EventHooks configures external commands run when events happen on the proxy.
+//
+// Commands are run directly, without a shell, with the privileges of the proxy. The event data is passed
+// in SPECTRUM_* environment variables and never as arguments. Values such as player names come from
+// clients, so scripts must quote them and must not pass them to eval or a shell unescaped.
+type EventHooks struct {
+	// Commands maps event names to the command run for them, as the program followed by its arguments.
+	Commands map[string][]string `toml:"commands"`
+	// TimeoutSeconds is how long a command may run before it is killed. Zero disables the timeout.
+	TimeoutSeconds int `toml:"timeout_seconds"`
+}
+
+// events runs the commands configured for events. It is nil if no commands are configured.
+var events *EventDispatcher
+
+// EventDispatcher runs the configured command of an event with the event data in its environment.
+type EventDispatcher struct {
+	commands map[string][]string
+	timeout  time.Duration
+	log      *slog.Logger
+}
+
+// NewEventDispatcher creates an EventDispatcher from the configuration. Unknown event names and empty
+// commands are rejected.
+func NewEventDispatcher(conf EventHooks, log *slog.Logger) (*EventDispatcher, error) {
+	for event, command := range conf.Commands {
+		if !slices.Contains(eventNames, event) {
+			return nil, fmt.Errorf("unknown event %q, expected one of %s", event, strings.Join(eventNames, ", "))
+		}
+		if len(command) == 0 || command[0] == "" {
+			return nil, fmt.Errorf("empty command for event %q", event)
+		}
+	}
+	return &EventDispatcher{
+		commands: conf.Commands,
+		timeout:  time.Duration(conf.TimeoutSeconds) * time.Second,
+		log:      log,
+	}, nil
+}
+
+// Dispatch runs the command of the event in the background. data holds the event data, each key is
+// passed as the SPECTRUM_<KEY> environment variable.
+func (d *EventDispatcher) Dispatch(event string, data map[string]string) {
+	if d == nil {
+		return
+	}
+	if _, ok := d.commands[event]; ok {
+		go d.Run(event, data)
+	}
+}
+
+// Run runs the command of the event and waits for it to finish.
+func (d *EventDispatcher) Run(event string, data map[string]string) error {
+	if d == nil {
+		return nil
+	}
+	command, ok := d.commands[event]
+	if !ok {
+		return nil
+	}
+
+	ctx := context.Background()
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), "SPECTRUM_EVENT="+event)
+	for key, value := range data {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("SPECTRUM_%s=%s", strings.ToUpper(key), sanitizeEventValue(value)))
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		d.log.Error("Event command failed", "event", event, "error", err, "output", strings.TrimSpace(string(output)))
+		return err
+	}
+	d.log.Debug("Ran event command", "event", event, "output", strings.TrimSpace(string(output)))
+	return nil
+}
+
+// sanitizeEventValue removes control characters such as newlines from value, so that event data can't
+// break up lines in scripts reading it.
+func sanitizeEventValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// playerEventData returns the event data describing the player of s.
+func playerEventData(s *session.Session) map[string]string {
+	identity := s.Client().IdentityData()
+	return map[string]string{
+		"player":  identity.DisplayName,
+		"xuid":    identity.XUID,
+		"address": s.Client().RemoteAddr().String(),
+		"server":  currentServerName(identity.XUID),
+	}
+}
+
+// handleHooksCommand lists the configured event commands, or runs the command of an event with example
+// data using 'hooks test <event>'.
+func handleHooksCommand(args []string) {
+	logger := slog.Default()
+	if events == nil || len(events.commands) == 0 {
+		logger.Info("No event commands are configured")
+		return
+	}
+	if len(args) == 0 {
+		for _, event := range eventNames {
+			if command, ok := events.commands[event]; ok {
+				logger.Info(fmt.Sprintf("- %s: %s", event, strings.Join(command, " ")))
+			}
+		}
+		return
+	}
+	if args[0] != "test" || len(args) < 2 {
+		logger.Info("Usage: hooks [test <event>]")
+		return
+	}
+
+	event := args[1]
+	if _, ok := events.commands[event]; !ok {
+		logger.Info(fmt.Sprintf("No command is configured for event %s", event))
+		return
+	}
+	data := map[string]string{"player": "Steve", "xuid": "0", "address": "127.0.0.1:19132", "server": "lobby", "reason": "test"}
+	if err := events.Run(event, data); err != nil {
+		return
+	}
+	logger.Info(fmt.Sprintf("Ran the command of event %s", event))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEventDispatcherRun(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event.env")
+	d, err := NewEventDispatcher(EventHooks{
+		Commands:       map[string][]string{EventPlayerJoin: {"sh", "-c", `env | grep ^SPECTRUM_ | sort > "$0"`, out}},
+		TimeoutSeconds: 5,
+	}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Run(EventPlayerJoin, map[string]string{"player": "Ste\nve", "xuid": "1", "server": "lobby"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"SPECTRUM_EVENT=player_join", "SPECTRUM_PLAYER=Steve", "SPECTRUM_SERVER=lobby", "SPECTRUM_XUID=1"}
+	if got := strings.Fields(string(data)); !slices.Equal(got, want) {
+		t.Fatalf("command got environment %v, want %v", got, want)
+	}
+
+	if err := d.Run(EventPlayerLeave, nil); err != nil {
+		t.Fatalf("running an event without a command failed: %v", err)
+	}
+}
+
+func TestEventDispatcherTimeout(t *testing.T) {
+	d, err := NewEventDispatcher(EventHooks{
+		Commands:       map[string][]string{EventServerDown: {"sleep", "10"}},
+		TimeoutSeconds: 1,
+	}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(EventServerDown, nil); err == nil {
+		t.Fatal("a command running past the timeout succeeded")
+	}
+}
+
+func TestNewEventDispatcherErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands map[string][]string
+	}{
+		{name: "unknown event", commands: map[string][]string{"player_chat": {"true"}}},
+		{name: "empty command", commands: map[string][]string{EventPlayerJoin: {}}},
+		{name: "empty program", commands: map[string][]string{EventPlayerJoin: {""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEventDispatcher(EventHooks{Commands: tt.commands}, slog.New(slog.DiscardHandler)); err == nil {
+				t.Fatal("NewEventDispatcher() succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Firewall configures which IP addresses may connect to the proxy.
+type Firewall struct {
+	// Allow lists the IPs or CIDR ranges allowed to connect. Everyone may connect if it is empty.
+	Allow []string `toml:"allow"`
+	// Deny lists the IPs or CIDR ranges that may not connect.
+	Deny []string `toml:"deny"`
+	// BanFile is the file that IPs banned with the ipban command are stored in, one per line.
+	BanFile string `toml:"ban_file"`
+	// Message is the disconnect message shown to blocked players.
+	Message string `toml:"message"`
+}
+
+// firewall checks the IP of every accepted session. It is nil if no rules are configured.
+var firewall *IPFilter
+
+// IPFilter decides whether an IP may connect based on allow and deny rules and runtime bans.
+type IPFilter struct {
+	allow, deny []*net.IPNet
+
+	mu      sync.RWMutex
+	bans    []*net.IPNet
+	banFile string
+}
+
+// NewIPFilter creates an IPFilter from the configuration, loading the bans from the ban file if it exists.
+func NewIPFilter(conf Firewall) (*IPFilter, error) {
+	f := &IPFilter{banFile: conf.BanFile}
+	var err error
+	if f.allow, err = parseCIDRs(conf.Allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseCIDRs(conf.Deny); err != nil {
+		return nil, err
+	}
+	if conf.BanFile != "" {
+		if f.bans, err = readBanFile(conf.BanFile); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Allowed reports if ip may connect.
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	if len(f.allow) > 0 && !containsIP(f.allow, ip) {
+		return false
+	}
+	if containsIP(f.deny, ip) {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return !containsIP(f.bans, ip)
+}
+
+// Ban bans the IP or CIDR range and saves the bans to the ban file.
+func (f *IPFilter) Ban(cidr string) error {
+	n, err := parseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if slices.ContainsFunc(f.bans, func(b *net.IPNet) bool { return b.String() == n.String() }) {
+		return fmt.Errorf("%s is already banned", n)
+	}
+	f.bans = append(f.bans, n)
+	return f.save()
+}
+
+// Unban removes the ban of the IP or CIDR range and saves the bans to the ban file.
+func (f *IPFilter) Unban(cidr string) error {
+	n, err := parseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	before := len(f.bans)
+	f.bans = slices.DeleteFunc(f.bans, func(b *net.IPNet) bool { return b.String() == n.String() })
+	if len(f.bans) == before {
+		return fmt.Errorf("%s is not banned", n)
+	}
+	return f.save()
+}
+
+// Bans returns the banned IPs and CIDR ranges.
+func (f *IPFilter) Bans() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	bans := make([]string, len(f.bans))
+	for i, b := range f.bans {
+		bans[i] = b.String()
+	}
+	return bans
+}
+
+// save writes the bans to the ban file. f.mu must be held.
+func (f *IPFilter) save() error {
+	if f.banFile == "" {
+		return nil
+	}
+	var b strings.Builder
+	for _, n := range f.bans {
+		b.WriteString(n.String())
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(f.banFile, []byte(b.String()), 0644)
+}
+
+// readBanFile reads the bans from the file at path. A missing file has no bans.
+func readBanFile(path string) ([]*net.IPNet, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return parseCIDRs(lines)
+}
+
+// parseCIDRs parses a list of IPs and CIDR ranges.
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		n, err := parseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// parseCIDR parses a CIDR range, or a single IP which is treated as a range containing only that IP.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// containsIP reports if any of nets contains ip.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrIP returns the IP of a network address, or nil if it has none.
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// handleIPBanCommand processes the subcommands of the ipban command.
+func handleIPBanCommand(args []string) {
+	logger := slog.Default()
+	if firewall == nil {
+		logger.Info("The firewall is disabled, set firewall.ban_file to enable IP bans")
+		return
+	}
+	if len(args) == 0 {
+		logger.Info("Usage: ipban <add|remove|list> [ip|cidr]")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		bans := firewall.Bans()
+		logger.Info(fmt.Sprintf("Banned IPs (%d)", len(bans)))
+		for _, ban := range bans {
+			logger.Info(fmt.Sprintf("- %s", ban))
+		}
+	case "add", "remove":
+		if len(args) < 2 {
+			logger.Info(fmt.Sprintf("Usage: ipban %s <ip|cidr>", args[0]))
+			return
+		}
+		var err error
+		if args[0] == "add" {
+			err = firewall.Ban(args[1])
+		} else {
+			err = firewall.Unban(args[1])
+		}
+		if err != nil {
+			logger.Error("Failed to update IP bans", "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Updated IP bans (%s %s)", args[0], args[1]))
+	default:
+		logger.Info(fmt.Sprintf("Unknown ipban subcommand: %s", args[0]))
+		logger.Info("Usage: ipban <add|remove|list> [ip|cidr]")
+	}
+}
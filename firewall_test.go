@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIPFilterAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Firewall
+		ip   string
+		want bool
+	}{
+		{name: "no rules", ip: "203.0.113.7", want: true},
+		{name: "allowed IP", conf: Firewall{Allow: []string{"203.0.113.7"}}, ip: "203.0.113.7", want: true},
+		{name: "not in the allow list", conf: Firewall{Allow: []string{"203.0.113.7"}}, ip: "203.0.113.8", want: false},
+		{name: "allowed range", conf: Firewall{Allow: []string{"203.0.113.0/24"}}, ip: "203.0.113.200", want: true},
+		{name: "outside the allowed range", conf: Firewall{Allow: []string{"203.0.113.0/24"}}, ip: "203.0.114.1", want: false},
+		{name: "denied IP", conf: Firewall{Deny: []string{"198.51.100.1"}}, ip: "198.51.100.1", want: false},
+		{name: "denied range", conf: Firewall{Deny: []string{"198.51.100.0/28"}}, ip: "198.51.100.15", want: false},
+		{name: "next to the denied range", conf: Firewall{Deny: []string{"198.51.100.0/28"}}, ip: "198.51.100.16", want: true},
+		{name: "deny wins over allow", conf: Firewall{Allow: []string{"198.51.100.0/24"}, Deny: []string{"198.51.100.1"}}, ip: "198.51.100.1", want: false},
+		{name: "IPv6 range", conf: Firewall{Deny: []string{"2001:db8::/32"}}, ip: "2001:db8::1", want: false},
+		{name: "IPv6 outside the range", conf: Firewall{Deny: []string{"2001:db8::/32"}}, ip: "2001:db9::1", want: true},
+		{name: "IPv4-mapped IPv6", conf: Firewall{Deny: []string{"198.51.100.1"}}, ip: "::ffff:198.51.100.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewIPFilter(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Allowed(net.ParseIP(tt.ip)); got != tt.want {
+				t.Fatalf("Allowed(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDR(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "203.0.113.7", want: "203.0.113.7/32"},
+		{in: "2001:db8::1", want: "2001:db8::1/128"},
+		{in: "203.0.113.7/24", want: "203.0.113.0/24"},
+		{in: "2001:db8::/32", want: "2001:db8::/32"},
+		{in: "203.0.113", wantErr: true},
+		{in: "203.0.113.0/33", wantErr: true},
+		{in: "example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			n, err := parseCIDR(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCIDR(%q) = %s, want an error", tt.in, n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.String() != tt.want {
+				t.Fatalf("parseCIDR(%q) = %s, want %s", tt.in, n, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPFilterBansPersist(t *testing.T) {
+	banFile := filepath.Join(t.TempDir(), "ipbans.txt")
+	f, err := NewIPFilter(Firewall{BanFile: banFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cidr := range []string{"203.0.113.7", "198.51.100.0/24", "2001:db8::/32"} {
+		if err := f.Ban(cidr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Ban("203.0.113.7/32"); err == nil {
+		t.Fatal("banning an IP twice succeeded")
+	}
+	if err := f.Unban("198.51.100.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Unban("198.51.100.0/24"); err == nil {
+		t.Fatal("unbanning an IP that isn't banned succeeded")
+	}
+	if f.Allowed(net.ParseIP("203.0.113.7")) || !f.Allowed(net.ParseIP("198.51.100.1")) {
+		t.Fatal("bans are not applied")
+	}
+
+	// Comments and blank lines in the ban file are ignored.
+	b, err := os.ReadFile(banFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(banFile, append([]byte("# banned\n\n"), b...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewIPFilter(Firewall{BanFile: banFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"203.0.113.7/32", "2001:db8::/32"}; !slices.Equal(loaded.Bans(), want) {
+		t.Fatalf("loaded bans %v, want %v", loaded.Bans(), want)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// GeoIP configures routing joining players to the lobby of their region.
+type GeoIP struct {
+	// Database is the path of a MaxMind GeoIP2 or GeoLite2 Country or City database. GeoIP routing is
+	// disabled if it is empty.
+	Database string `toml:"database"`
+	// Lobbies maps regions to the names of the lobbies players from them join. Regions are ISO country
+	// codes such as "DE" or continent codes such as "EU", countries take precedence over continents.
+	// Players from other regions, or whose address can't be resolved, join the default lobbies.
+	Lobbies map[string]string `toml:"lobbies"`
+}
+
+// geoRouter picks the lobby of joining players by their region. It is nil if GeoIP routing is disabled.
+var geoRouter *GeoRouter
+
+// geoCacheSize is the number of addresses whose lobby GeoRouter remembers. The cache is cleared once it
+// is full.
+const geoCacheSize = 4096
+
+// GeoRouter maps the addresses of players to the lobby of their region.
+type GeoRouter struct {
+	db      *geoDatabase
+	lobbies map[string]string
+
+	mu    sync.Mutex
+	cache map[netip.Addr]string
+}
+
+// NewGeoRouter creates a GeoRouter looking up addresses in the database at path.
+func NewGeoRouter(path string, lobbies map[string]string) (*GeoRouter, error) {
+	db, err := openGeoDatabase(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r := &GeoRouter{db: db, lobbies: make(map[string]string, len(lobbies)), cache: make(map[netip.Addr]string)}
+	for region, lobby := range lobbies {
+		r.lobbies[strings.ToUpper(region)] = lobby
+	}
+	return r, nil
+}
+
+// Lobby returns the name of the lobby for the region of addr. It returns false if the region of addr is
+// unknown or has no lobby.
+func (r *GeoRouter) Lobby(addr net.Addr) (string, bool) {
+	if r == nil || addr == nil {
+		return "", false
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return "", false
+	}
+	ip := addrPort.Addr().Unmap()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lobby, ok := r.cache[ip]
+	if !ok {
+		lobby = r.lookup(ip)
+		if len(r.cache) >= geoCacheSize {
+			clear(r.cache)
+		}
+		r.cache[ip] = lobby
+	}
+	return lobby, lobby != ""
+}
+
+// RenameLobby makes the regions whose lobby is named old use the lobby named new instead.
+func (r *GeoRouter) RenameLobby(old, new string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for region, lobby := range r.lobbies {
+		if lobby == old {
+			r.lobbies[region] = new
+		}
+	}
+	clear(r.cache)
+}
+
+// RemoveLobby makes the regions whose lobby is named name use the regular lobbies again.
+func (r *GeoRouter) RemoveLobby(name string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for region, lobby := range r.lobbies {
+		if lobby == name {
+			delete(r.lobbies, region)
+		}
+	}
+	clear(r.cache)
+}
+
+// lookup returns the name of the lobby for the region of ip, or an empty string if there is none.
+func (r *GeoRouter) lookup(ip netip.Addr) string {
+	record, ok, err := r.db.lookup(ip)
+	if err != nil || !ok {
+		return ""
+	}
+	for _, path := range [][]string{{"country", "iso_code"}, {"registered_country", "iso_code"}, {"continent", "code"}} {
+		if region, ok := recordString(record, path...); ok {
+			if lobby, ok := r.lobbies[strings.ToUpper(region)]; ok {
+				return lobby
+			}
+		}
+	}
+	return ""
+}
+
+// recordString returns the string at the given path of nested maps in a database record.
+func recordString(record any, path ...string) (string, bool) {
+	for _, key := range path {
+		m, ok := record.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		record = m[key]
+	}
+	s, ok := record.(string)
+	return s, ok
+}
+
+// errCorruptDatabase is returned for MaxMind databases that can't be decoded.
+var errCorruptDatabase = errors.New("corrupt MaxMind database")
+
+// geoDatabase is a MaxMind DB file read into memory, as described at
+// https://maxmind.github.io/MaxMind-DB/.
+type geoDatabase struct {
+	tree       []byte
+	data       mmdbDecoder
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node IPv4 lookups start at in IPv6 databases.
+	ipv4Start uint
+}
+
+// openGeoDatabase reads the MaxMind DB file at path.
+func openGeoDatabase(path string) (*geoDatabase, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	marker := []byte("\xab\xcd\xefMaxMind.com")
+	metaStart := bytes.LastIndex(b, marker)
+	if metaStart == -1 {
+		return nil, errors.New("not a MaxMind database")
+	}
+	v, _, err := mmdbDecoder(b[metaStart+len(marker):]).decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := v.(map[string]any)
+	if !ok {
+		return nil, errCorruptDatabase
+	}
+	nodeCount, _ := meta["node_count"].(uint64)
+	recordSize, _ := meta["record_size"].(uint64)
+	ipVersion, _ := meta["ip_version"].(uint64)
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", ipVersion)
+	}
+	treeSize := recordSize * 2 / 8 * nodeCount
+	if treeSize+16 > uint64(metaStart) {
+		return nil, errCorruptDatabase
+	}
+
+	db := &geoDatabase{
+		tree:       b[:treeSize],
+		data:       b[treeSize+16 : metaStart],
+		nodeCount:  uint(nodeCount),
+		recordSize: uint(recordSize),
+		ipVersion:  uint(ipVersion),
+	}
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.readNode(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of a node in the search tree.
+func (db *geoDatabase) readNode(node, bit uint) uint {
+	b := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup returns the record of the network ip is in. It returns false if the database has no record for
+// ip.
+func (db *geoDatabase) lookup(ip netip.Addr) (any, bool, error) {
+	var (
+		node uint
+		addr []byte
+	)
+	if ip.Is4() {
+		a := ip.As4()
+		addr = a[:]
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else {
+		if db.ipVersion == 4 {
+			return nil, false, nil
+		}
+		a := ip.As16()
+		addr = a[:]
+	}
+
+	for i := 0; i < len(addr)*8 && node < db.nodeCount; i++ {
+		node = db.readNode(node, uint(addr[i/8]>>(7-i%8))&1)
+	}
+	if node <= db.nodeCount {
+		return nil, false, nil
+	}
+	v, _, err := db.data.decode(int(node-db.nodeCount-16), 0)
+	return v, err == nil, err
+}
+
+// mmdbDecoder decodes values of the MaxMind DB data section format. Pointers are offsets into the
+// decoder.
+type mmdbDecoder []byte
+
+// Data types of the MaxMind DB data section format.
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// decode decodes the value at off and returns it with the offset following it. Maps are decoded to
+// map[string]any, arrays to []any, integers to uint64 or int64 and floating point numbers to float64.
+func (d mmdbDecoder) decode(off, depth int) (any, int, error) {
+	if depth > 32 || off < 0 || off >= len(d) {
+		return nil, 0, errCorruptDatabase
+	}
+	ctrl := d[off]
+	off++
+	typ := int(ctrl >> 5)
+	if typ == mmdbPointer {
+		n := int(ctrl>>3)&0x3 + 1
+		if off+n > len(d) {
+			return nil, 0, errCorruptDatabase
+		}
+		p, b := int(ctrl&0x7), d[off:off+n]
+		switch n {
+		case 1:
+			p = p<<8 | int(b[0])
+		case 2:
+			p = (p<<16 | int(b[0])<<8 | int(b[1])) + 2048
+		case 3:
+			p = (p<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+		case 4:
+			p = int(binary.BigEndian.Uint32(b))
+		}
+		v, _, err := d.decode(p, depth+1)
+		return v, off + n, err
+	}
+	if typ == mmdbExtended {
+		if off >= len(d) {
+			return nil, 0, errCorruptDatabase
+		}
+		typ = 7 + int(d[off])
+		off++
+	}
+
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if off+n > len(d) {
+			return nil, 0, errCorruptDatabase
+		}
+		extra := 0
+		for _, c := range d[off : off+n] {
+			extra = extra<<8 | int(c)
+		}
+		off += n
+		size = [...]int{29, 285, 65821}[n-1] + extra
+	}
+
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for range size {
+			k, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorruptDatabase
+			}
+			if m[key], off, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, off, nil
+	case mmdbArray:
+		a := make([]any, size)
+		for i := range a {
+			var err error
+			if a[i], off, err = d.decode(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, off, nil
+	case mmdbBool:
+		return size != 0, off, nil
+	}
+
+	if off+size > len(d) {
+		return nil, 0, errCorruptDatabase
+	}
+	b := d[off : off+size]
+	off += size
+	switch typ {
+	case mmdbString:
+		return string(b), off, nil
+	case mmdbBytes:
+		return bytes.Clone(b), off, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errCorruptDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errCorruptDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		// 128-bit integers are truncated, the database fields used here are never that large.
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, off, nil
+	case mmdbInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), off, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, off, nil
+	}
+	return nil, 0, fmt.Errorf("unknown MaxMind data type %d", typ)
+}
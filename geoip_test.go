@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encodeMMDB encodes a value of the MaxMind DB data section format with the given type and payload.
+// Only the types with a control byte of their own are supported.
+func encodeMMDB(typ int, payload []byte, size int) []byte {
+	if size < 29 {
+		return append([]byte{byte(typ<<5 | size)}, payload...)
+	}
+	return append([]byte{byte(typ<<5 | 29), byte(size - 29)}, payload...)
+}
+
+func encodeMMDBString(s string) []byte {
+	return encodeMMDB(mmdbString, []byte(s), len(s))
+}
+
+func encodeMMDBUint(typ int, n uint64) []byte {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return encodeMMDB(typ, b, len(b))
+}
+
+// encodeMMDBMap encodes a map from the keys and encoded values alternating in kv.
+func encodeMMDBMap(kv ...any) []byte {
+	var b []byte
+	for i := 0; i < len(kv); i += 2 {
+		b = append(b, encodeMMDBString(kv[i].(string))...)
+		b = append(b, kv[i+1].([]byte)...)
+	}
+	return encodeMMDB(mmdbMap, b, len(kv)/2)
+}
+
+// encodeMMDBPointer encodes a pointer to an offset below 2048 in the data section.
+func encodeMMDBPointer(off int) []byte {
+	return []byte{byte(mmdbPointer<<5 | off>>8), byte(off)}
+}
+
+// testTrieNode is a node of the search tree of a test database. A record points to either the next node,
+// a data section offset plus one in leaf, or neither.
+type testTrieNode struct {
+	next [2]*testTrieNode
+	leaf [2]int
+}
+
+// buildTestDatabase returns a MaxMind DB file with the given record size and IP version, holding data as
+// its data section. networks maps prefixes to the offset of their record in data. IPv4 networks of IPv6
+// databases are stored in the ::/96 subtree.
+func buildTestDatabase(t *testing.T, recordSize, ipVersion int, data []byte, networks map[string]int) []byte {
+	t.Helper()
+	root := &testTrieNode{}
+	for network, off := range networks {
+		prefix := netip.MustParsePrefix(network)
+		addr, bits := prefix.Addr().AsSlice(), prefix.Bits()
+		if ipVersion == 6 && prefix.Addr().Is4() {
+			addr, bits = append(make([]byte, 12), addr...), bits+96
+		}
+		n := root
+		for i := range bits {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				n.leaf[bit] = off + 1
+				break
+			}
+			if n.next[bit] == nil {
+				n.next[bit] = &testTrieNode{}
+			}
+			n = n.next[bit]
+		}
+	}
+
+	var nodes []*testTrieNode
+	index := make(map[*testTrieNode]int)
+	var number func(n *testTrieNode)
+	number = func(n *testTrieNode) {
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, next := range n.next {
+			if next != nil {
+				number(next)
+			}
+		}
+	}
+	number(root)
+
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]uint32
+		for bit := range records {
+			switch {
+			case n.next[bit] != nil:
+				records[bit] = uint32(index[n.next[bit]])
+			case n.leaf[bit] != 0:
+				records[bit] = uint32(len(nodes) + 16 + n.leaf[bit] - 1)
+			default:
+				records[bit] = uint32(len(nodes))
+			}
+		}
+		l, r := records[0], records[1]
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>20&0xf0|r>>24&0x0f), byte(r>>16), byte(r>>8), byte(r))
+		case 32:
+			tree = append(tree, byte(l>>24), byte(l>>16), byte(l>>8), byte(l), byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	b := append(tree, make([]byte, 16)...)
+	b = append(b, data...)
+	b = append(b, "\xab\xcd\xefMaxMind.com"...)
+	return append(b, encodeMMDBMap(
+		"node_count", encodeMMDBUint(mmdbUint32, uint64(len(nodes))),
+		"record_size", encodeMMDBUint(mmdbUint16, uint64(recordSize)),
+		"ip_version", encodeMMDBUint(mmdbUint16, uint64(ipVersion)),
+	)...)
+}
+
+// writeTestDatabase writes b to a file in a temporary directory and returns its path.
+func writeTestDatabase(t *testing.T, b []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testGeoData returns a data section with records of a German, an American and a European address
+// without a country, and the offsets of the records. The American record refers to its country with a
+// pointer.
+func testGeoData() ([]byte, map[string]int) {
+	var data []byte
+	offsets := make(map[string]int)
+	add := func(name string, record []byte) {
+		offsets[name] = len(data)
+		data = append(data, record...)
+	}
+	add("DE", encodeMMDBMap(
+		"continent", encodeMMDBMap("code", encodeMMDBString("EU")),
+		"country", encodeMMDBMap("iso_code", encodeMMDBString("DE")),
+	))
+	usCountry := len(data)
+	add("US country", encodeMMDBMap("iso_code", encodeMMDBString("US")))
+	add("US", encodeMMDBMap(
+		"continent", encodeMMDBMap("code", encodeMMDBString("NA")),
+		"country", encodeMMDBPointer(usCountry),
+	))
+	add("EU", encodeMMDBMap(
+		"continent", encodeMMDBMap("code", encodeMMDBString("EU")),
+		"registered_country", encodeMMDBMap("iso_code", encodeMMDBString("JP")),
+	))
+	return data, offsets
+}
+
+// testAddr is a net.Addr with the address of a player.
+type testAddr string
+
+func (testAddr) Network() string  { return "udp" }
+func (a testAddr) String() string { return string(a) }
+
+func TestGeoRouterLobby(t *testing.T) {
+	lobbies := map[string]string{"de": "lobby-de", "US": "lobby-us", "EU": "lobby-eu"}
+	tests := []struct {
+		name     string
+		addr     string
+		want     string
+		wantIPv4 string
+	}{
+		{name: "IPv4 country", addr: "1.2.3.4:19132", want: "lobby-de", wantIPv4: "lobby-de"},
+		{name: "IPv4-mapped IPv6", addr: "[::ffff:1.2.3.4]:19132", want: "lobby-de", wantIPv4: "lobby-de"},
+		{name: "IPv6 country behind a pointer", addr: "[2001:db8::1]:19132", want: "lobby-us"},
+		{name: "continent without a country lobby", addr: "5.6.7.8:19132", want: "lobby-eu", wantIPv4: "lobby-eu"},
+		{name: "unknown IPv4 address", addr: "9.9.9.9:19132"},
+		{name: "unknown IPv6 address", addr: "[2001:db9::1]:19132"},
+		{name: "not an address", addr: "player"},
+	}
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, ipVersion := range []int{4, 6} {
+			data, offsets := testGeoData()
+			networks := map[string]int{"1.2.3.0/24": offsets["DE"], "5.6.0.0/16": offsets["EU"]}
+			if ipVersion == 6 {
+				networks["2001:db8::/32"] = offsets["US"]
+			}
+			t.Run(fmt.Sprintf("IPv%d %d-bit", ipVersion, recordSize), func(t *testing.T) {
+				r, err := NewGeoRouter(writeTestDatabase(t, buildTestDatabase(t, recordSize, ipVersion, data, networks)), lobbies)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, tt := range tests {
+					t.Run(tt.name, func(t *testing.T) {
+						want := tt.want
+						if ipVersion == 4 {
+							want = tt.wantIPv4
+						}
+						if lobby, ok := r.Lobby(testAddr(tt.addr)); lobby != want || ok != (want != "") {
+							t.Fatalf("Lobby(%s) = %q, %v, want %q", tt.addr, lobby, ok, want)
+						}
+					})
+				}
+			})
+		}
+	}
+}
+
+func TestGeoRouterRenameLobby(t *testing.T) {
+	data, offsets := testGeoData()
+	path := writeTestDatabase(t, buildTestDatabase(t, 24, 6, data, map[string]int{"1.2.3.0/24": offsets["DE"]}))
+	r, err := NewGeoRouter(path, map[string]string{"DE": "lobby-de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := testAddr("1.2.3.4:19132")
+	r.Lobby(addr)
+
+	r.RenameLobby("lobby-de", "lobby-eu")
+	if lobby, _ := r.Lobby(addr); lobby != "lobby-eu" {
+		t.Fatalf("Lobby() after renaming = %q, want the cached lobby replaced by lobby-eu", lobby)
+	}
+}
+
+func TestGeoDatabaseReadNode(t *testing.T) {
+	tests := []struct {
+		recordSize  uint
+		node        []byte
+		left, right uint
+	}{
+		{recordSize: 24, node: []byte{0xab, 0xcd, 0xef, 0x12, 0x34, 0x56}, left: 0xabcdef, right: 0x123456},
+		{recordSize: 28, node: []byte{0xab, 0xcd, 0xef, 0x79, 0x12, 0x34, 0x56}, left: 0x7abcdef, right: 0x9123456},
+		{recordSize: 32, node: []byte{0xfe, 0xab, 0xcd, 0xef, 0xdc, 0x12, 0x34, 0x56}, left: 0xfeabcdef, right: 0xdc123456},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-bit", tt.recordSize), func(t *testing.T) {
+			// The node is the second one of the tree, after a node of zeros.
+			db := &geoDatabase{tree: append(make([]byte, len(tt.node)), tt.node...), recordSize: tt.recordSize}
+			if got := db.readNode(1, 0); got != tt.left {
+				t.Errorf("left record = %#x, want %#x", got, tt.left)
+			}
+			if got := db.readNode(1, 1); got != tt.right {
+				t.Errorf("right record = %#x, want %#x", got, tt.right)
+			}
+		})
+	}
+}
+
+func TestOpenGeoDatabaseCorrupt(t *testing.T) {
+	data, offsets := testGeoData()
+	valid := buildTestDatabase(t, 24, 6, data, map[string]int{"1.2.3.0/24": offsets["DE"]})
+	metaStart := bytes.LastIndex(valid, []byte("\xab\xcd\xefMaxMind.com"))
+	withMeta := func(meta []byte) []byte {
+		return append(bytes.Clone(valid[:metaStart]), append([]byte("\xab\xcd\xefMaxMind.com"), meta...)...)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{name: "empty file", b: nil},
+		{name: "no metadata", b: valid[:metaStart]},
+		{name: "truncated metadata", b: valid[:len(valid)-3]},
+		{name: "metadata not a map", b: withMeta(encodeMMDBString("metadata"))},
+		{name: "unsupported record size", b: withMeta(encodeMMDBMap(
+			"node_count", encodeMMDBUint(mmdbUint32, 1),
+			"record_size", encodeMMDBUint(mmdbUint16, 20),
+			"ip_version", encodeMMDBUint(mmdbUint16, 6),
+		))},
+		{name: "unsupported IP version", b: withMeta(encodeMMDBMap(
+			"node_count", encodeMMDBUint(mmdbUint32, 1),
+			"record_size", encodeMMDBUint(mmdbUint16, 24),
+			"ip_version", encodeMMDBUint(mmdbUint16, 5),
+		))},
+		{name: "tree larger than the file", b: withMeta(encodeMMDBMap(
+			"node_count", encodeMMDBUint(mmdbUint32, 1<<20),
+			"record_size", encodeMMDBUint(mmdbUint16, 24),
+			"ip_version", encodeMMDBUint(mmdbUint16, 6),
+		))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGeoRouter(writeTestDatabase(t, tt.b), nil); err == nil {
+				t.Fatal("NewGeoRouter succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestGeoDatabaseLookupCorruptData(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "truncated record", data: encodeMMDBMap("country", encodeMMDBMap("iso_code", encodeMMDBString("DE")))[:8]},
+		{name: "pointer past the end", data: encodeMMDBMap("country", encodeMMDBPointer(1000))},
+		{name: "pointer loop", data: encodeMMDBPointer(0)},
+		{name: "map key not a string", data: encodeMMDB(mmdbMap, encodeMMDBUint(mmdbUint16, 1), 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestDatabase(t, buildTestDatabase(t, 24, 4, tt.data, map[string]int{"1.2.3.0/24": 0}))
+			db, err := openGeoDatabase(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, err := db.lookup(netip.MustParseAddr("1.2.3.4")); ok || !errors.Is(err, errCorruptDatabase) {
+				t.Fatalf("lookup() = %v, %v, want %v", ok, err, errCorruptDatabase)
+			}
+
+			r := &GeoRouter{db: db, lobbies: map[string]string{"DE": "lobby-de"}, cache: make(map[netip.Addr]string)}
+			if lobby, ok := r.Lobby(testAddr("1.2.3.4:19132")); ok {
+				t.Fatalf("Lobby() = %q for a corrupt record", lobby)
+			}
+		})
+	}
+}
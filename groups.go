@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// groupPrefix is the prefix of transfer targets naming a server group instead of a single server.
+const groupPrefix = "group:"
+
+// resolveTarget returns the name and address of the server a transfer to target should go to. target is
+// either a server name or a server group prefixed with "group:", in which case the least-loaded available
+// member of the group is picked.
+func resolveTarget(target string) (string, string, error) {
+	if group, ok := strings.CutPrefix(target, groupPrefix); ok {
+		return selectGroupServer(group)
+	}
+
+	addr, ok := serverRegistry.Lookup(target)
+	if !ok {
+		return "", "", fmt.Errorf("server %q not found", target)
+	}
+	return target, addr, nil
+}
+
+// selectGroupServer returns the name and address of the member of the group with the fewest players.
+// Members that are unknown, unhealthy or full are skipped, and ties are broken randomly. The groups of the
+// live config are used, so that servers renamed after a session was accepted are still found.
+func selectGroupServer(group string) (string, string, error) {
+	members, ok := currentConfig().ServerGroups[group]
+	if !ok {
+		return "", "", fmt.Errorf("server group %q not found", group)
+	}
+
+	var (
+		candidates []string
+		least      int
+	)
+	addresses := make(map[string]string, len(members))
+	for _, name := range members {
+		addr, ok := serverRegistry.Lookup(name)
+		if !ok || (healthChecker != nil && !healthChecker.Healthy(addr)) || serverFull(name, addr) {
+			continue
+		}
+		addresses[name] = addr
+		count := serverTracker.Count(addr)
+		if len(candidates) == 0 || count < least {
+			candidates, least = []string{name}, count
+		} else if count == least {
+			candidates = append(candidates, name)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", "", fmt.Errorf("no server available in group %q", group)
+	}
+	name := candidates[rand.IntN(len(candidates))]
+	return name, addresses[name], nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSelectGroupServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		players map[string]int
+		down    []string
+		members []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "least loaded", players: map[string]int{"a": 3, "b": 1, "c": 2}, want: []string{"b"}},
+		{name: "ties", players: map[string]int{"a": 1, "b": 1, "c": 2}, want: []string{"a", "b"}},
+		{name: "unhealthy member skipped", players: map[string]int{"a": 3, "b": 1, "c": 2}, down: []string{"b"}, want: []string{"c"}},
+		{name: "full member skipped", players: map[string]int{"a": 5, "b": 4, "c": 4}, want: []string{"a"}},
+		{name: "unknown member skipped", players: map[string]int{"a": 2}, members: []string{"missing", "a"}, want: []string{"a"}},
+		{name: "no member available", players: map[string]int{"a": 1}, members: []string{"a"}, down: []string{"a"}, wantErr: true},
+		{name: "no players", players: map[string]int{}, want: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := []Server{
+				{Name: "lobby", Addr: "127.0.0.1:19133"},
+				{Name: "a", Addr: "127.0.0.1:19134", MaxPlayers: 10},
+				{Name: "b", Addr: "127.0.0.1:19135", MaxPlayers: 4},
+				{Name: "c", Addr: "127.0.0.1:19136", MaxPlayers: 4},
+			}
+			useServers(t, servers...)
+			members := tt.members
+			if members == nil {
+				members = []string{"a", "b", "c"}
+			}
+			useConfig(t, &ServerConfig{Servers: servers, DefaultServer: "lobby", ServerGroups: map[string][]string{"games": members}})
+			checker := healthChecker
+			t.Cleanup(func() { healthChecker = checker })
+			transport := &fakeTransport{}
+			healthChecker = NewHealthChecker(transport, time.Second, slog.New(slog.DiscardHandler))
+			for _, name := range tt.down {
+				addr, _ := serverRegistry.Lookup(name)
+				transport.setDown(addr, true)
+				healthChecker.Check(addr)
+			}
+			xuid := 0
+			for name, n := range tt.players {
+				addr, _ := serverRegistry.Lookup(name)
+				for range n {
+					xuid++
+					serverTracker.Set(strconv.Itoa(xuid), addr)
+				}
+			}
+
+			// Ties are broken randomly, so pick repeatedly to see every candidate that can be picked.
+			picked := make(map[string]bool)
+			for range 50 {
+				name, addr, err := resolveTarget("group:games")
+				if tt.wantErr {
+					if err == nil {
+						t.Fatalf("resolveTarget(group:games) = %s, want an error", name)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, _ := serverRegistry.Lookup(name); addr != want {
+					t.Fatalf("resolveTarget(group:games) = %s, %s, want the address of %s", name, addr, name)
+				}
+				picked[name] = true
+			}
+			if got := slices.Sorted(maps.Keys(picked)); !slices.Equal(got, tt.want) {
+				t.Fatalf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectGroupServerUnknownGroup(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+	if _, _, err := selectGroupServer("missing"); err == nil {
+		t.Fatal("selectGroupServer succeeded for an unknown group")
+	}
+}
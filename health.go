@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/transport"
+)
+
+// healthChecker tracks the health of the backend servers. It is nil until the proxy has started.
+var healthChecker *HealthChecker
+
+// HealthChecker probes backend servers by dialing them through the proxy's transport and keeps track
+// of which servers are currently reachable.
+type HealthChecker struct {
+	transport transport.Transport
+	timeout   time.Duration
+	log       *slog.Logger
+
+	mu   sync.RWMutex
+	down map[string]bool
+}
+
+// NewHealthChecker creates a new HealthChecker dialing servers using t, giving up after timeout.
+func NewHealthChecker(t transport.Transport, timeout time.Duration, log *slog.Logger) *HealthChecker {
+	return &HealthChecker{
+		transport: t,
+		timeout:   timeout,
+		log:       log,
+		down:      make(map[string]bool),
+	}
+}
+
+// Probe dials the server at addr once and returns an error if it could not be reached.
+func (h *HealthChecker) Probe(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	conn, err := h.transport.Dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Check probes the server at addr and updates its state. It returns true if the server went from
+// healthy to unhealthy as a result of this check.
+func (h *HealthChecker) Check(addr string) bool {
+	err := h.Probe(addr)
+
+	h.mu.Lock()
+	wasDown := h.down[addr]
+	h.down[addr] = err != nil
+	h.mu.Unlock()
+
+	if err != nil && !wasDown {
+		h.log.Warn("Server is down", "address", addr, "err", err)
+		return true
+	}
+	if err == nil && wasDown {
+		h.log.Info("Server is back up", "address", addr)
+	}
+	return false
+}
+
+// Move moves the state of the server at old to new, for servers whose address changed.
+func (h *HealthChecker) Move(old, new string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if down, ok := h.down[old]; ok {
+		h.down[new] = down
+		delete(h.down, old)
+	}
+}
+
+// Healthy returns false if the last probe of the server at addr failed. Servers that were never
+// probed are assumed to be healthy.
+func (h *HealthChecker) Healthy(addr string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.down[addr]
+}
+
+// RunActive probes every server that currently has players connected at the given interval until ctx
+// is done. When such a server goes down, onDown is called with its address.
+func (h *HealthChecker) RunActive(ctx context.Context, interval time.Duration, onDown func(addr string)) {
+	h.run(ctx, interval, serverTracker.Addresses, onDown)
+}
+
+// RunAll probes every configured server at the given interval until ctx is done. When a server goes
+// down, onDown is called with its address.
+func (h *HealthChecker) RunAll(ctx context.Context, interval time.Duration, onDown func(addr string)) {
+	h.run(ctx, interval, func() []string {
+		return slices.Collect(maps.Values(serverRegistry.All()))
+	}, onDown)
+}
+
+// run probes the servers returned by addrs at the given interval until ctx is done.
+func (h *HealthChecker) run(ctx context.Context, interval time.Duration, addrs func() []string, onDown func(addr string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, addr := range addrs() {
+			if h.Check(addr) {
+				onDown(addr)
+			}
+		}
+	}
+}
+
+// State returns whether the server at addr was up at its last probe. known is false if the server was
+// never probed.
+func (h *HealthChecker) State(addr string) (up, known bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	down, known := h.down[addr]
+	return !down, known
+}
+
+// ProbeResult is the result of probing a single server.
+type ProbeResult struct {
+	Name    string
+	Addr    string
+	Err     error
+	Latency time.Duration
+}
+
+// ProbeAll probes all given servers (name to address) concurrently, at most concurrency at a time, and
+// returns the results sorted by server name.
+func (h *HealthChecker) ProbeAll(servers map[string]string, concurrency int) []ProbeResult {
+	results := make([]ProbeResult, 0, len(servers))
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(concurrency, 1))
+	)
+	for name, addr := range servers {
+		wg.Add(1)
+		go func(name, addr string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			err := h.Probe(addr)
+			result := ProbeResult{Name: name, Addr: addr, Err: err, Latency: time.Since(start)}
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(name, addr)
+	}
+	wg.Wait()
+
+	slices.SortFunc(results, func(a, b ProbeResult) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return results
+}
+
+// handleHealthCheckCommand probes every configured server and prints a summary. The protocol version of
+// the servers can't be shown, as the spectrum transport doesn't exchange it.
+func handleHealthCheckCommand() {
+	logger := slog.Default()
+	if healthChecker == nil {
+		logger.Info("Health checking is not available yet")
+		return
+	}
+
+	servers := serverRegistry.All()
+
+	results := healthChecker.ProbeAll(servers, 8)
+	up := 0
+	for _, r := range results {
+		if r.Err != nil {
+			logger.Info(fmt.Sprintf("- %s (%s): DOWN (%v)", r.Name, r.Addr, r.Err))
+			continue
+		}
+		up++
+		logger.Info(fmt.Sprintf("- %s (%s): UP, %s", r.Name, r.Addr, r.Latency.Round(time.Millisecond)))
+	}
+	logger.Info(fmt.Sprintf("%d/%d servers up", up, len(results)))
+	logger.Info("Backend protocol versions are not reported over the spectrum transport, run 'protocol' for the versions of clients")
+}
+
+// serverDown reports if the last probe of the server at addr failed.
+func serverDown(addr string) bool {
+	return healthChecker != nil && !healthChecker.Healthy(addr)
+}
+
+// handleHealthCommand prints the state of every configured server as of its last probe, without probing.
+func handleHealthCommand() {
+	logger := slog.Default()
+	if healthChecker == nil {
+		logger.Info("Health checking is not available yet")
+		return
+	}
+
+	servers := serverRegistry.All()
+	names := slices.Sorted(maps.Keys(servers))
+	for _, name := range names {
+		addr := servers[name]
+		state := "unknown"
+		if up, known := healthChecker.State(addr); known && up {
+			state = "UP"
+		} else if known {
+			state = "DOWN"
+		}
+		logger.Info(fmt.Sprintf("- %s (%s): %s", name, addr, state))
+	}
+}
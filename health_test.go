@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTransport is a transport.Transport whose dials to an address fail while the address is down. It
+// records the addresses dialed.
+type fakeTransport struct {
+	mu    sync.Mutex
+	down  map[string]bool
+	dials []string
+}
+
+func (f *fakeTransport) setDown(addr string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down == nil {
+		f.down = make(map[string]bool)
+	}
+	f.down[addr] = down
+}
+
+func (f *fakeTransport) Dial(_ context.Context, addr string) (io.ReadWriteCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dials = append(f.dials, addr)
+	if f.down[addr] {
+		return nil, errors.New("connection refused")
+	}
+	return nopConn{}, nil
+}
+
+// dialed returns the addresses dialed so far.
+func (f *fakeTransport) dialed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.dials)
+}
+
+type nopConn struct{}
+
+func (nopConn) Read([]byte) (int, error)    { return 0, io.EOF }
+func (nopConn) Write(b []byte) (int, error) { return len(b), nil }
+func (nopConn) Close() error                { return nil }
+
+func TestHealthCheckerCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		probes      []bool
+		wentDown    []bool
+		wantHealthy bool
+	}{
+		{name: "up", probes: []bool{true, true}, wentDown: []bool{false, false}, wantHealthy: true},
+		{name: "goes down once", probes: []bool{true, false, false}, wentDown: []bool{false, true, false}, wantHealthy: false},
+		{name: "down from the first probe", probes: []bool{false}, wentDown: []bool{true}, wantHealthy: false},
+		{name: "comes back up", probes: []bool{false, true}, wentDown: []bool{true, false}, wantHealthy: true},
+		{name: "goes down again", probes: []bool{false, true, false}, wentDown: []bool{true, false, true}, wantHealthy: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const addr = "127.0.0.1:19133"
+			transport := &fakeTransport{}
+			h := NewHealthChecker(transport, time.Second, slog.New(slog.DiscardHandler))
+			if !h.Healthy(addr) {
+				t.Fatal("a server that was never probed is unhealthy")
+			}
+
+			for i, up := range tt.probes {
+				transport.setDown(addr, !up)
+				if got := h.Check(addr); got != tt.wentDown[i] {
+					t.Fatalf("probe %d: Check() = %v, want %v", i, got, tt.wentDown[i])
+				}
+			}
+			if got := h.Healthy(addr); got != tt.wantHealthy {
+				t.Fatalf("Healthy() = %v, want %v", got, tt.wantHealthy)
+			}
+			if up, known := h.State(addr); !known || up != tt.wantHealthy {
+				t.Fatalf("State() = %v, %v, want %v, true", up, known, tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestHealthCheckerRunReportsDownServers(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+	serverTracker.Set("1", "127.0.0.1:19134")
+
+	tests := []struct {
+		name       string
+		allServers bool
+		addr       string
+		want       bool
+	}{
+		{name: "active server", addr: "127.0.0.1:19134", want: true},
+		{name: "idle server not probed", addr: "127.0.0.1:19133", want: false},
+		{name: "idle server with all servers", allServers: true, addr: "127.0.0.1:19133", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &fakeTransport{}
+			transport.setDown(tt.addr, true)
+			h := NewHealthChecker(transport, time.Second, slog.New(slog.DiscardHandler))
+
+			run := h.RunActive
+			if tt.allServers {
+				run = h.RunAll
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			defer func() {
+				cancel()
+				<-stopped
+			}()
+			down := make(chan string, 16)
+			go func() {
+				defer close(stopped)
+				run(ctx, time.Millisecond, func(addr string) { down <- addr })
+			}()
+
+			select {
+			case addr := <-down:
+				if !tt.want || addr != tt.addr {
+					t.Fatalf("onDown(%q) called, want %v for %s", addr, tt.want, tt.addr)
+				}
+				if h.Healthy(tt.addr) {
+					t.Fatal("server reported down is still healthy")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.want {
+					t.Fatal("onDown was not called for a down server")
+				}
+			}
+
+			// The server is reported only once while it stays down.
+			select {
+			case addr := <-down:
+				t.Fatalf("onDown(%q) called again while the server stayed down", addr)
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// slowTransport is a transport.Transport whose dials take delay, or hang until the dial is cancelled
+// for servers in hang. It records the most dials in progress at once.
+type slowTransport struct {
+	fakeTransport
+	delay time.Duration
+	hang  map[string]bool
+
+	active, maxActive atomic.Int32
+}
+
+func (f *slowTransport) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	n := f.active.Add(1)
+	defer f.active.Add(-1)
+	for {
+		m := f.maxActive.Load()
+		if n <= m || f.maxActive.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	if f.hang[addr] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	time.Sleep(f.delay)
+	return f.fakeTransport.Dial(ctx, addr)
+}
+
+func TestHealthCheckerProbeAll(t *testing.T) {
+	servers := map[string]string{
+		"a": "127.0.0.1:19133",
+		"b": "127.0.0.1:19134",
+		"c": "127.0.0.1:19135",
+		"d": "127.0.0.1:19136",
+		"e": "127.0.0.1:19137",
+	}
+	transport := &slowTransport{delay: 50 * time.Millisecond, hang: map[string]bool{servers["e"]: true}}
+	transport.setDown(servers["b"], true)
+	h := NewHealthChecker(transport, 200*time.Millisecond, slog.New(slog.DiscardHandler))
+
+	results := h.ProbeAll(servers, 2)
+	if got := transport.maxActive.Load(); got != 2 {
+		t.Errorf("probed %d servers at once, want 2", got)
+	}
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+		if r.Addr != servers[r.Name] {
+			t.Errorf("result of %s has address %s, want %s", r.Name, r.Addr, servers[r.Name])
+		}
+		switch r.Name {
+		case "b":
+			if r.Err == nil {
+				t.Error("the down server b was reported up")
+			}
+		case "e":
+			if !errors.Is(r.Err, context.DeadlineExceeded) {
+				t.Errorf("probing the hanging server e failed with %v, want it to time out", r.Err)
+			}
+		default:
+			if r.Err != nil || r.Latency < transport.delay {
+				t.Errorf("server %s reported error %v and latency %s, want it up with the latency of the dial", r.Name, r.Err, r.Latency)
+			}
+		}
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(names, want) {
+		t.Fatalf("results for %v, want %v", names, want)
+	}
+}
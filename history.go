@@ -3,36 +3,81 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// commandHistory is the history of the console, or nil if it couldn't be loaded.
+var commandHistory *HistoryFile
+
+// historySaveDelay is how long saving the history is delayed after a command was appended, so that
+// commands entered in quick succession are written at once.
+const historySaveDelay = time.Second
+
 // HistoryFile manages the command history stored in a file
 type HistoryFile struct {
 	filePath string
 	maxSize  int
-	history  []string
+	// dedupAll removes earlier occurrences of a command when it is appended again, instead of only
+	// skipping repeats of the last command.
+	dedupAll bool
+
+	mu      sync.Mutex
+	history []string
+	// saveTimer is the timer of the pending save, or nil if no save is pending.
+	saveTimer *time.Timer
 }
 
-// NewHistoryFile creates a new history file manager
-func NewHistoryFile(filename string, maxSize int) (*HistoryFile, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+// stateDirEnv is the environment variable overriding the directory state files such as the command history
+// are stored in.
+const stateDirEnv = "SPECTRUM_HOME"
+
+// stateDir returns the directory state files are stored in, creating it if needed. It is dir if it isn't
+// empty, otherwise $SPECTRUM_HOME, ~/.spectrum or .spectrum in the working directory, whichever can be
+// created first.
+func stateDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, os.MkdirAll(dir, 0755)
 	}
 
-	spectrumDir := filepath.Join(homeDir, ".spectrum")
-	if _, err := os.Stat(spectrumDir); os.IsNotExist(err) {
-		if err := os.Mkdir(spectrumDir, 0755); err != nil {
-			return nil, err
+	var candidates []string
+	if env := os.Getenv(stateDirEnv); env != "" {
+		candidates = append(candidates, env)
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(homeDir, ".spectrum"))
+	}
+	candidates = append(candidates, ".spectrum")
+
+	var err error
+	for _, candidate := range candidates {
+		if err = os.MkdirAll(candidate, 0755); err == nil {
+			return candidate, nil
 		}
 	}
+	return "", err
+}
+
+// NewHistoryFile creates a new history file manager storing the history in dir, or the default state
+// directory if dir is empty. If dedupAll is true, a command appended again is moved to the end of the
+// history, so that it is ordered by most recent use.
+func NewHistoryFile(filename string, maxSize int, dedupAll bool, dir string) (*HistoryFile, error) {
+	spectrumDir, err := stateDir(dir)
+	if err != nil {
+		return nil, err
+	}
 
 	filePath := filepath.Join(spectrumDir, filename)
 	h := &HistoryFile{
 		filePath: filePath,
 		maxSize:  maxSize,
+		dedupAll: dedupAll,
 		history:  []string{},
 	}
 
@@ -60,44 +105,84 @@ func (h *HistoryFile) Load() error {
 		}
 	}
 
+	// A history written without dedupAll may repeat commands, keep their most recent use only
+	if h.dedupAll {
+		seen := make(map[string]struct{}, len(lines))
+		for i := len(lines) - 1; i >= 0; i-- {
+			if _, ok := seen[lines[i]]; ok {
+				lines = slices.Delete(lines, i, i+1)
+				continue
+			}
+			seen[lines[i]] = struct{}{}
+		}
+	}
+
 	// Only keep the last maxSize entries
 	if len(lines) > h.maxSize {
 		lines = lines[len(lines)-h.maxSize:]
 	}
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.history = lines
 	return scanner.Err()
 }
 
-// Save writes history to the file
+// Save writes history to the file right away, cancelling a pending save. The history is written to a
+// temporary file that then replaces the history file, so that the file is never left half-written.
 func (h *HistoryFile) Save() error {
-	file, err := os.Create(h.filePath)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.saveTimer != nil {
+		h.saveTimer.Stop()
+		h.saveTimer = nil
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(h.filePath), filepath.Base(h.filePath)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
 	writer := bufio.NewWriter(file)
 	for _, line := range h.history {
 		if _, err := fmt.Fprintln(writer, line); err != nil {
+			_ = file.Close()
 			return err
 		}
 	}
-	return writer.Flush()
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), h.filePath)
 }
 
-// Append adds a command to history
-func (h *HistoryFile) Append(cmd string) error {
+// Append adds a command to history. The history is saved after historySaveDelay, failures to save it are
+// logged.
+func (h *HistoryFile) Append(cmd string) {
 	cmd = strings.TrimSpace(cmd)
 	if cmd == "" {
-		return nil
+		return
 	}
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	// Don't add duplicate of the last command
 	if len(h.history) > 0 && h.history[len(h.history)-1] == cmd {
-		return nil
+		return
 	}
 
+	if h.dedupAll {
+		h.history = slices.DeleteFunc(h.history, func(line string) bool { return line == cmd })
+	}
 	h.history = append(h.history, cmd)
 
 	// Trim history if it exceeds maxSize
@@ -105,10 +190,54 @@ func (h *HistoryFile) Append(cmd string) error {
 		h.history = h.history[len(h.history)-h.maxSize:]
 	}
 
-	return h.Save()
+	if h.saveTimer == nil {
+		h.saveTimer = time.AfterFunc(historySaveDelay, func() {
+			if err := h.Save(); err != nil {
+				slog.Default().Error("Failed to save command history", "error", err)
+			}
+		})
+	}
 }
 
-// GetHistory returns the history as a slice
+// GetHistory returns a copy of the history
 func (h *HistoryFile) GetHistory() []string {
-	return h.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.history)
+}
+
+// historyEntry returns the command with the given 1-based index in the command history, as referenced
+// with !<n> in the console.
+func historyEntry(index string) (string, bool) {
+	if commandHistory == nil {
+		return "", false
+	}
+	n, err := strconv.Atoi(index)
+	history := commandHistory.GetHistory()
+	if err != nil || n < 1 || n > len(history) {
+		return "", false
+	}
+	return history[n-1], true
+}
+
+// handleHistoryCommand lists the commands in the command history containing filter with their index, so
+// that they can be run again with !<n>.
+func handleHistoryCommand(args []string) {
+	logger := slog.Default()
+	if commandHistory == nil {
+		logger.Info("Command history is not available")
+		return
+	}
+
+	filter := strings.Join(args, " ")
+	matches := 0
+	for i, cmd := range commandHistory.GetHistory() {
+		if strings.Contains(cmd, filter) {
+			logger.Info(fmt.Sprintf("%4d  %s", i+1, cmd))
+			matches++
+		}
+	}
+	if matches == 0 {
+		logger.Info("No matching commands in the history")
+	}
 }
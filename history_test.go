@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHistoryFileAppend(t *testing.T) {
+	tests := []struct {
+		name     string
+		dedupAll bool
+		maxSize  int
+		append   []string
+		want     []string
+	}{
+		{name: "repeat of the last command", maxSize: 10, append: []string{"list", "list", "list"}, want: []string{"list"}},
+		{name: "earlier command kept", maxSize: 10, append: []string{"list", "status", "list"}, want: []string{"list", "status", "list"}},
+		{name: "earlier command moved with dedup", dedupAll: true, maxSize: 10, append: []string{"list", "status", "list"}, want: []string{"status", "list"}},
+		{name: "repeat of the last command with dedup", dedupAll: true, maxSize: 10, append: []string{"list", "list"}, want: []string{"list"}},
+		{name: "blank commands skipped", maxSize: 10, append: []string{"  ", "list ", " list"}, want: []string{"list"}},
+		{name: "trimmed to the max size", maxSize: 2, append: []string{"a", "b", "c"}, want: []string{"b", "c"}},
+		{name: "dedup before trimming", dedupAll: true, maxSize: 2, append: []string{"a", "b", "a", "a"}, want: []string{"b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			h, err := NewHistoryFile("history", tt.maxSize, tt.dedupAll, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, cmd := range tt.append {
+				h.Append(cmd)
+			}
+			if got := h.GetHistory(); !slices.Equal(got, tt.want) {
+				t.Fatalf("GetHistory() = %q, want %q", got, tt.want)
+			}
+
+			if err := h.Save(); err != nil {
+				t.Fatal(err)
+			}
+			reloaded, err := NewHistoryFile("history", tt.maxSize, tt.dedupAll, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reloaded.GetHistory(); !slices.Equal(got, tt.want) {
+				t.Fatalf("GetHistory() after reloading = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryFileLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		dedupAll bool
+		maxSize  int
+		content  string
+		want     []string
+	}{
+		{name: "repeats kept", maxSize: 10, content: "list\nstatus\nlist\n", want: []string{"list", "status", "list"}},
+		{name: "repeats removed with dedup", dedupAll: true, maxSize: 10, content: "list\nstatus\nlist\n", want: []string{"status", "list"}},
+		{name: "blank lines skipped", maxSize: 10, content: "\nlist\n  \nstatus", want: []string{"list", "status"}},
+		{name: "last entries kept", maxSize: 2, content: "a\nb\nc\n", want: []string{"b", "c"}},
+		{name: "dedup before trimming", dedupAll: true, maxSize: 2, content: "a\nb\nc\nc\nb\n", want: []string{"c", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "history"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			h, err := NewHistoryFile("history", tt.maxSize, tt.dedupAll, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := h.GetHistory(); !slices.Equal(got, tt.want) {
+				t.Fatalf("GetHistory() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// tempFiles returns the temporary files left in dir by saving the history file named name.
+func tempFiles(t *testing.T, dir, name string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, name+".tmp*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestHistoryFileSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history")
+	// A longer history saved earlier is replaced as a whole, not overwritten in place.
+	if err := os.WriteFile(path, []byte(strings.Repeat("an older, longer command\n", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHistoryFile("history", 2, false, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Append("list")
+	if h.saveTimer == nil {
+		t.Fatal("Append didn't schedule a save")
+	}
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if h.saveTimer != nil {
+		t.Fatal("Save didn't cancel the scheduled save")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "an older, longer command\nlist\n"; string(b) != want {
+		t.Fatalf("history file holds %q, want %q", b, want)
+	}
+	if files := tempFiles(t, dir, "history"); len(files) != 0 {
+		t.Fatalf("temporary files left after saving: %v", files)
+	}
+}
+
+func TestHistoryFileSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHistoryFile("history", 10, false, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Append("list")
+
+	// The history file can't be replaced by the temporary file while a non-empty directory is in its place.
+	if err := os.MkdirAll(filepath.Join(dir, "history", "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Save(); err == nil {
+		t.Fatal("Save succeeded, want an error")
+	}
+	if files := tempFiles(t, dir, "history"); len(files) != 0 {
+		t.Fatalf("temporary files left after a failed save: %v", files)
+	}
+	if got := h.GetHistory(); !slices.Equal(got, []string{"list"}) {
+		t.Fatalf("GetHistory() after a failed save = %q, want [list]", got)
+	}
+}
+
+func TestHistoryFileLoadIgnoresTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "history"), []byte("list\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A save interrupted before replacing the history file leaves a partial temporary file behind.
+	if err := os.WriteFile(filepath.Join(dir, "history.tmp123"), []byte("sta"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHistoryFile("history", 10, false, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.GetHistory(); !slices.Equal(got, []string{"list"}) {
+		t.Fatalf("GetHistory() = %q, want [list]", got)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// JoinFull configures what happens to players joining while the proxy or the lobby is full.
+type JoinFull struct {
+	// ProxyFullMessage is the disconnect message shown when the proxy reached max_players.
+	ProxyFullMessage string `toml:"proxy_full_message"`
+	// LobbyFullMessage is the disconnect message shown when the lobby is full.
+	LobbyFullMessage string `toml:"lobby_full_message"`
+	// WaitForLobby keeps joining players on the loading screen until the lobby has room, instead of
+	// disconnecting them right away.
+	WaitForLobby bool `toml:"wait_for_lobby"`
+	// MaxWaitSeconds is how long players wait for the lobby before being disconnected.
+	MaxWaitSeconds int `toml:"max_wait_seconds"`
+}
+
+// playerSlots counts the sessions holding one of the max_players slots of the proxy.
+var playerSlots PlayerSlots
+
+// PlayerSlots counts taken player slots. Slots are taken atomically, so that concurrent joins can't take
+// more slots than allowed.
+type PlayerSlots struct {
+	mu    sync.Mutex
+	taken int
+}
+
+// TryTake takes a slot if fewer than limit slots are taken. It returns false if no slot is free.
+func (p *PlayerSlots) TryTake(limit int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.taken >= limit {
+		return false
+	}
+	p.taken++
+	return true
+}
+
+// Take takes a slot even if all slots are taken.
+func (p *PlayerSlots) Take() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.taken++
+}
+
+// Release releases a taken slot.
+func (p *PlayerSlots) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.taken--
+}
+
+// Taken returns the number of taken slots.
+func (p *PlayerSlots) Taken() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.taken
+}
+
+// admitPlayer takes a player slot for s and returns false if the proxy is full. It is called from the
+// accept loop, as sessions are only added to the session registry once they logged in, which would let
+// concurrent joins past max_players. Slots reserved for reconnecting players count as taken. Observers
+// don't take a slot and reconnecting players get one even if the proxy is full. Slots are taken even if
+// max_players is not set, so that the count is right if it is set by a reload. The slot is released once
+// the session closed, whether or not it logged in.
+func admitPlayer(conf *ServerConfig, s *session.Session) bool {
+	if isObserver(s) {
+		return true
+	}
+	if conf.MaxPlayers <= 0 || reconnects.Reserved(s.Client().IdentityData().XUID) {
+		playerSlots.Take()
+	} else if !playerSlots.TryTake(conf.MaxPlayers - reconnects.Count()) {
+		return false
+	}
+	context.AfterFunc(s.Context(), playerSlots.Release)
+	return true
+}
+
+// joinRoutes holds the servers picked for joining players by checkJoinCapacity.
+var joinRoutes = NewJoinRoutes()
+
+// joinRouteTTL is how long a picked server is kept for a joining player. Discover is called right after the
+// server was picked, so routes are only left over by players who disconnected in between.
+const joinRouteTTL = time.Minute
+
+// route is the server picked for a joining player.
+type route struct {
+	addr   string
+	picked time.Time
+}
+
+// JoinRoutes passes the server picked for a joining player from checkJoinCapacity to Discover, so that the
+// player is sent to the server that was checked for room.
+type JoinRoutes struct {
+	mu     sync.Mutex
+	routes map[string]route
+}
+
+// NewJoinRoutes creates an empty JoinRoutes.
+func NewJoinRoutes() *JoinRoutes {
+	return &JoinRoutes{routes: make(map[string]route)}
+}
+
+// Set records the address of the server picked for the player with the given XUID.
+func (r *JoinRoutes) Set(xuid, addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for xuid, rt := range r.routes {
+		if now.Sub(rt.picked) > joinRouteTTL {
+			delete(r.routes, xuid)
+		}
+	}
+	r.routes[xuid] = route{addr: addr, picked: now}
+}
+
+// Take removes and returns the address of the server picked for the player with the given XUID.
+func (r *JoinRoutes) Take(xuid string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.routes[xuid]
+	delete(r.routes, xuid)
+	if !ok || time.Since(rt.picked) > joinRouteTTL {
+		return "", false
+	}
+	return rt.addr, true
+}
+
+// checkJoinCapacity checks if a new player can join the server Discover will send them to, waiting for that
+// server to have room if configured. It returns the disconnect message to show if the player can't join. The
+// player limit of the proxy is enforced by admitPlayer.
+func checkJoinCapacity(conf *ServerConfig, s *session.Session, log *slog.Logger) (string, bool) {
+	if !waitForLobby(conf) {
+		log.Info("Rejected session, the lobby is down")
+		return localize(s, "lobby_down", conf.LobbyFailover.Message), false
+	}
+	if reconnects.Reserved(s.Client().IdentityData().XUID) {
+		// The player's slot was kept for them while they were disconnected.
+		return "", true
+	}
+	if isObserver(s) {
+		log.Info("Accepted observer, bypassing player limits")
+		return "", true
+	}
+
+	// The route is picked once, as picking it advances the lobby rotation and takes the player's
+	// reconnect entry. Waiting players only check that server for room.
+	addr := LobbyDiscovery{}.route(s.Client())
+	name, _ := serverRegistry.Name(addr)
+	deadline := time.Now().Add(time.Duration(conf.JoinFull.MaxWaitSeconds) * time.Second)
+	for {
+		if !serverFull(name, addr) {
+			joinRoutes.Set(s.Client().IdentityData().XUID, addr)
+			return "", true
+		}
+		if !conf.JoinFull.WaitForLobby || time.Now().After(deadline) {
+			log.Info("Rejected session, the lobby is full")
+			return localize(s, "lobby_full", conf.JoinFull.LobbyFullMessage), false
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlayerSlotsTryTake(t *testing.T) {
+	tests := []struct {
+		name  string
+		taken int
+		limit int
+		want  bool
+	}{
+		{name: "empty", taken: 0, limit: 2, want: true},
+		{name: "one left", taken: 1, limit: 2, want: true},
+		{name: "full", taken: 2, limit: 2, want: false},
+		{name: "over limit after reload", taken: 3, limit: 2, want: false},
+		{name: "all slots reserved for reconnects", taken: 0, limit: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p PlayerSlots
+			for range tt.taken {
+				p.Take()
+			}
+			if got := p.TryTake(tt.limit); got != tt.want {
+				t.Fatalf("TryTake(%d) with %d taken = %v, want %v", tt.limit, tt.taken, got, tt.want)
+			}
+			want := tt.taken
+			if tt.want {
+				want++
+			}
+			if got := p.Taken(); got != want {
+				t.Fatalf("Taken() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestPlayerSlotsConcurrentJoins(t *testing.T) {
+	const (
+		limit = 10
+		joins = 200
+	)
+	var (
+		p        PlayerSlots
+		admitted atomic.Int32
+		wg       sync.WaitGroup
+	)
+	for range joins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.TryTake(limit) {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := admitted.Load(); got != limit {
+		t.Fatalf("admitted %d concurrent joins, want %d", got, limit)
+	}
+
+	p.Release()
+	if !p.TryTake(limit) {
+		t.Fatal("TryTake failed after a slot was released")
+	}
+}
+
+func TestCheckJoinCapacity(t *testing.T) {
+	const lobby = "127.0.0.1:19133"
+	tests := []struct {
+		name     string
+		players  int
+		wait     bool
+		leave    bool
+		wantJoin bool
+	}{
+		{name: "lobby has room", players: 1, wantJoin: true},
+		{name: "lobby full", players: 2},
+		{name: "wait for room", players: 2, wait: true, leave: true, wantJoin: true},
+		{name: "wait times out", players: 2, wait: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: lobby, MaxPlayers: 2})
+			for i := range tt.players {
+				serverTracker.Set(strconv.Itoa(100+i), lobby)
+			}
+			conf := &ServerConfig{JoinFull: JoinFull{LobbyFullMessage: "The lobby is full", WaitForLobby: tt.wait, MaxWaitSeconds: 1}}
+			s, _ := newTestSession(t, "1", "Steve", &fakeTransport{})
+			if tt.leave {
+				time.AfterFunc(100*time.Millisecond, func() { serverTracker.Remove("100") })
+			}
+
+			message, ok := checkJoinCapacity(conf, s, slog.New(slog.DiscardHandler))
+			if ok != tt.wantJoin {
+				t.Fatalf("checkJoinCapacity() = %v, want %v", ok, tt.wantJoin)
+			}
+			addr, routed := joinRoutes.Take("1")
+			if tt.wantJoin && (!routed || addr != lobby) {
+				t.Errorf("joining player routed to %q, want the lobby", addr)
+			}
+			if !tt.wantJoin && message != "The lobby is full" {
+				t.Errorf("rejected with %q, want the lobby full message", message)
+			}
+		})
+	}
+}
+
+func TestCheckJoinCapacityKeepsRoute(t *testing.T) {
+	const first, second = "127.0.0.1:19133", "127.0.0.1:19134"
+	useServers(t, Server{Name: "first", Addr: first, Lobby: true, MaxPlayers: 1}, Server{Name: "second", Addr: second, Lobby: true, MaxPlayers: 1})
+	serverTracker.Set("100", first)
+	time.AfterFunc(100*time.Millisecond, func() { serverTracker.Remove("100") })
+
+	conf := &ServerConfig{JoinFull: JoinFull{WaitForLobby: true, MaxWaitSeconds: 5}}
+	s, _ := newTestSession(t, "1", "Steve", &fakeTransport{})
+	if _, ok := checkJoinCapacity(conf, s, slog.New(slog.DiscardHandler)); !ok {
+		t.Fatal("checkJoinCapacity() rejected the player")
+	}
+	if addr, _ := joinRoutes.Take("1"); addr != first {
+		t.Fatalf("waiting player routed to %q, want the lobby they waited for", addr)
+	}
+	// Waiting took a single turn of the lobby rotation.
+	if addr := serverRegistry.NextLobby(func(string) bool { return true }); addr != second {
+		t.Fatalf("next lobby is %q, want %q", addr, second)
+	}
+}
+
+func TestAdmitPlayerProxyFull(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+	slots := playerSlots.Taken()
+	transport := &fakeTransport{}
+	conf := &ServerConfig{MaxPlayers: slots + 1}
+	first, _ := newTestSession(t, "1", "Steve", transport)
+	if !admitPlayer(conf, first) {
+		t.Fatal("rejected a player while the proxy has room")
+	}
+	second, _ := newTestSession(t, "2", "Alex", transport)
+	if admitPlayer(conf, second) {
+		t.Fatal("admitted a player while the proxy is full")
+	}
+
+	// The slot of a player is released once their session closed.
+	first.Disconnect("left")
+	deadline := time.Now().Add(5 * time.Second)
+	for playerSlots.Taken() != slots {
+		if time.Now().After(deadline) {
+			t.Fatal("the slot of a disconnected player was not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !admitPlayer(conf, second) {
+		t.Fatal("rejected a player after a slot was released")
+	}
+}
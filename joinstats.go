@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// joinStats records how long it takes sessions to go from being accepted to being logged in.
+var joinStats = NewJoinStats(100)
+
+// JoinStats keeps the durations of the most recent joins.
+type JoinStats struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	next      int
+	total     int
+}
+
+// NewJoinStats creates a JoinStats keeping the durations of the last size joins.
+func NewJoinStats(size int) *JoinStats {
+	return &JoinStats{durations: make([]time.Duration, 0, size)}
+}
+
+// Record records the duration of a join.
+func (j *JoinStats) Record(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.durations) < cap(j.durations) {
+		j.durations = append(j.durations, d)
+	} else {
+		j.durations[j.next] = d
+	}
+	j.next = (j.next + 1) % cap(j.durations)
+	j.total++
+}
+
+// Recent returns the recorded durations, from the oldest to the most recent, and the number of joins
+// recorded in total.
+func (j *JoinStats) Recent() ([]time.Duration, int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.durations) < cap(j.durations) {
+		return append([]time.Duration(nil), j.durations...), j.total
+	}
+	return append(append([]time.Duration(nil), j.durations[j.next:]...), j.durations[:j.next]...), j.total
+}
+
+// summarizeDurations returns the average, minimum and maximum of durations, which must not be empty.
+func summarizeDurations(durations []time.Duration) (avg, lo, hi time.Duration) {
+	lo, hi = durations[0], durations[0]
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	return sum / time.Duration(len(durations)), lo, hi
+}
+
+// handleJoinStatsCommand shows statistics about recent join durations.
+func handleJoinStatsCommand() {
+	logger := slog.Default()
+	durations, total := joinStats.Recent()
+	if len(durations) == 0 {
+		logger.Info("No joins recorded yet")
+		return
+	}
+
+	avg, lo, hi := summarizeDurations(durations)
+	logger.Info(fmt.Sprintf("Join Statistics (last %d of %d joins)", len(durations), total))
+	logger.Info(fmt.Sprintf("- Average: %s", avg.Round(time.Millisecond)))
+	logger.Info(fmt.Sprintf("- Min: %s", lo.Round(time.Millisecond)))
+	logger.Info(fmt.Sprintf("- Max: %s", hi.Round(time.Millisecond)))
+
+	recent := durations[max(0, len(durations)-10):]
+	parts := make([]string, len(recent))
+	for i, d := range recent {
+		parts[i] = d.Round(time.Millisecond).String()
+	}
+	logger.Info(fmt.Sprintf("- Recent: %s", strings.Join(parts, ", ")))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestJoinStatsRecent(t *testing.T) {
+	tests := []struct {
+		name      string
+		recorded  []time.Duration
+		want      []time.Duration
+		wantTotal int
+	}{
+		{name: "empty"},
+		{name: "below the size", recorded: []time.Duration{1, 2}, want: []time.Duration{1, 2}, wantTotal: 2},
+		{name: "at the size", recorded: []time.Duration{1, 2, 3}, want: []time.Duration{1, 2, 3}, wantTotal: 3},
+		{name: "wrapped", recorded: []time.Duration{1, 2, 3, 4, 5}, want: []time.Duration{3, 4, 5}, wantTotal: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewJoinStats(3)
+			for _, d := range tt.recorded {
+				j.Record(d)
+			}
+			got, total := j.Recent()
+			if !slices.Equal(got, tt.want) || total != tt.wantTotal {
+				t.Fatalf("Recent() = %v, %d, want %v, %d", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestSummarizeDurations(t *testing.T) {
+	tests := []struct {
+		name            string
+		durations       []time.Duration
+		wantAvg, wantLo time.Duration
+		wantHi          time.Duration
+	}{
+		{name: "single", durations: []time.Duration{time.Second}, wantAvg: time.Second, wantLo: time.Second, wantHi: time.Second},
+		{name: "several", durations: []time.Duration{300 * time.Millisecond, 100 * time.Millisecond, 800 * time.Millisecond}, wantAvg: 400 * time.Millisecond, wantLo: 100 * time.Millisecond, wantHi: 800 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avg, lo, hi := summarizeDurations(tt.durations)
+			if avg != tt.wantAvg || lo != tt.wantLo || hi != tt.wantHi {
+				t.Fatalf("summarizeDurations(%v) = %s, %s, %s, want %s, %s, %s", tt.durations, avg, lo, hi, tt.wantAvg, tt.wantLo, tt.wantHi)
+			}
+		})
+	}
+}
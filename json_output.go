@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/cooldogedev/spectrum"
+)
+
+// PlayerInfo describes an online player in the JSON output of the players command and the HTTP API.
+type PlayerInfo struct {
+	Name   string `json:"name"`
+	XUID   string `json:"xuid"`
+	Server string `json:"server"`
+	// Address is the address of the server the player is on.
+	Address string `json:"address"`
+	Latency int64  `json:"latency"`
+}
+
+// ServerInfo describes a configured server in the JSON output of the servers command.
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Players int    `json:"players"`
+	Queued  int    `json:"queued"`
+	Default bool   `json:"default"`
+}
+
+// ProxyInfo is the JSON output of the info command.
+type ProxyInfo struct {
+	BindAddress   string       `json:"bind_address"`
+	DefaultServer string       `json:"default_server"`
+	Players       int          `json:"players"`
+	Servers       []ServerInfo `json:"servers"`
+	Goroutines    int          `json:"goroutines"`
+	GoVersion     string       `json:"go_version"`
+	TotalAllocMB  float64      `json:"total_alloc_mb"`
+}
+
+// collectPlayers returns information about all online players.
+func collectPlayers(proxy *spectrum.Spectrum) []PlayerInfo {
+	players := make([]PlayerInfo, 0)
+	for _, s := range proxy.Registry().GetSessions() {
+		identity := s.Client().IdentityData()
+		addr, _ := serverTracker.Server(identity.XUID)
+		name, _ := serverRegistry.Name(addr)
+		players = append(players, PlayerInfo{
+			Name:    identity.DisplayName,
+			XUID:    identity.XUID,
+			Server:  name,
+			Address: addr,
+			Latency: s.Latency(),
+		})
+	}
+	slices.SortFunc(players, func(a, b PlayerInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return players
+}
+
+// collectServers returns information about all configured servers.
+func collectServers(conf *ServerConfig) []ServerInfo {
+	all := serverRegistry.All()
+	servers := make([]ServerInfo, 0, len(all))
+	for name, addr := range all {
+		servers = append(servers, ServerInfo{
+			Name:    name,
+			Address: addr,
+			Players: serverTracker.Count(addr),
+			Queued:  len(joinQueue.List(name)),
+			Default: name == conf.DefaultServer,
+		})
+	}
+	slices.SortFunc(servers, func(a, b ServerInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return servers
+}
+
+// collectInfo returns general information about the proxy.
+func collectInfo(proxy *spectrum.Spectrum, conf *ServerConfig) ProxyInfo {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return ProxyInfo{
+		BindAddress:   proxy.Opts().Addr,
+		DefaultServer: conf.DefaultServer,
+		Players:       len(proxy.Registry().GetSessions()),
+		Servers:       collectServers(conf),
+		Goroutines:    runtime.NumGoroutine(),
+		GoVersion:     runtime.Version(),
+		TotalAllocMB:  float64(memStats.TotalAlloc) / 1024 / 1024,
+	}
+}
+
+// currentServerName returns the name of the server the player with the given XUID is on, or an empty
+// string if it is unknown.
+func currentServerName(xuid string) string {
+	addr, ok := serverTracker.Server(xuid)
+	if !ok {
+		return ""
+	}
+	name, _ := serverRegistry.Name(addr)
+	return name
+}
+
+// handleJSONCommand runs a command with machine-readable output, writing a single line of JSON to stdout.
+func handleJSONCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		logger.Info("Usage: json <players|servers|info>")
+		return
+	}
+
+	var v any
+	switch args[0] {
+	case "players":
+		v = collectPlayers(proxy)
+	case "servers":
+		v = collectServers(conf)
+	case "info":
+		v = collectInfo(proxy, conf)
+	default:
+		logger.Info(fmt.Sprintf("Command %s does not support JSON output", args[0]))
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("Failed to encode JSON output", "error", err)
+		return
+	}
+	_, _ = fmt.Fprintln(os.Stdout, string(b))
+}
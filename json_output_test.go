@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// captureStdout returns what f writes to stdout.
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	_ = w.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestJSONServers(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+	queue := joinQueue
+	t.Cleanup(func() { joinQueue = queue })
+	joinQueue = NewQueueManager()
+
+	serverTracker.Set("1", "127.0.0.1:19134")
+	serverTracker.Set("2", "127.0.0.1:19134")
+	joinQueue.enqueue("island", "3", nil)
+
+	out := captureStdout(t, func() {
+		handleJSONCommand([]string{"servers"}, nil, &ServerConfig{DefaultServer: "lobby"})
+	})
+	var got []ServerInfo
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("output %q is not a JSON list of servers: %v", out, err)
+	}
+	want := []ServerInfo{
+		{Name: "island", Address: "127.0.0.1:19134", Players: 2, Queued: 1},
+		{Name: "lobby", Address: "127.0.0.1:19133", Default: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("servers = %+v, want %+v", got, want)
+	}
+}
+
+func TestJSONUnsupportedCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no command", args: nil},
+		{name: "unsupported command", args: []string{"health"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLogs(t)
+			if out := captureStdout(t, func() { handleJSONCommand(tt.args, nil, &ServerConfig{}) }); len(out) != 0 {
+				t.Fatalf("handleJSONCommand(%v) wrote %q to stdout, want nothing", tt.args, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+)
+
+// serverLatency is the latency report of a single server.
+type serverLatency struct {
+	ProbeResult
+	// players is the number of players on the server and clientLatency their average ping.
+	players       int
+	clientLatency time.Duration
+}
+
+// handleLatencyCommand probes every configured server and prints the time it took to connect to it,
+// together with the average ping of the players on it, slowest servers first. Backends are reached
+// through the spectrum transport rather than RakNet, so the round-trip time is that of dialing the
+// transport.
+func handleLatencyCommand(proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	if healthChecker == nil {
+		logger.Info("Latency reports are not available yet")
+		return
+	}
+
+	servers := serverRegistry.All()
+	totals := make(map[string]time.Duration)
+	counts := make(map[string]int)
+	for _, s := range proxy.Registry().GetSessions() {
+		if addr, ok := serverTracker.Server(s.Client().IdentityData().XUID); ok {
+			totals[addr] += time.Duration(s.Latency()) * time.Millisecond
+			counts[addr]++
+		}
+	}
+
+	reports := make([]serverLatency, 0, len(servers))
+	for _, r := range healthChecker.ProbeAll(servers, 8) {
+		report := serverLatency{ProbeResult: r, players: counts[r.Addr]}
+		if report.players > 0 {
+			report.clientLatency = totals[r.Addr] / time.Duration(report.players)
+		}
+		reports = append(reports, report)
+	}
+	// Unreachable servers come first, then the slowest ones.
+	slices.SortStableFunc(reports, func(a, b serverLatency) int {
+		if (a.Err != nil) != (b.Err != nil) {
+			if a.Err != nil {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(b.Latency, a.Latency)
+	})
+
+	logger.Info(fmt.Sprintf("%-16s %-24s %10s %8s %12s", "SERVER", "ADDRESS", "RTT", "PLAYERS", "AVG PING"))
+	for _, r := range reports {
+		rtt := "DOWN"
+		if r.Err == nil {
+			rtt = r.Latency.Round(time.Millisecond).String()
+		}
+		ping := "-"
+		if r.players > 0 {
+			ping = r.clientLatency.Round(time.Millisecond).String()
+		}
+		logger.Info(fmt.Sprintf("%-16s %-24s %10s %8d %12s", r.Name, r.Addr, rtt, r.players, ping))
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// liveConfig holds the config currently in use. Settings changed while the proxy is running are never
+// written to it in place, as sessions and the accept loop read it concurrently. A changed copy is published
+// with updateConfig instead.
+var liveConfig atomic.Pointer[ServerConfig]
+
+// configMu serializes updates of the live config, so that concurrent updates don't lose each other's changes.
+var configMu sync.Mutex
+
+// currentConfig returns the config currently in use. The returned config must not be modified.
+func currentConfig() *ServerConfig {
+	return liveConfig.Load()
+}
+
+// updateConfig calls f with a copy of the current config and makes the copy the current config once f
+// returns. The copy shares its maps and slices with the previous config, so f must replace them instead of
+// modifying them. The new config is returned.
+func updateConfig(f func(conf *ServerConfig)) *ServerConfig {
+	configMu.Lock()
+	defer configMu.Unlock()
+	conf := *liveConfig.Load()
+	f(&conf)
+	liveConfig.Store(&conf)
+	return &conf
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// LobbyFailover configures what happens while the lobby server is down.
+type LobbyFailover struct {
+	// Enabled moves the players on the lobby to the fallback server when the health checker detects the
+	// lobby went down.
+	Enabled bool `toml:"enabled"`
+	// Fallback is the name of the server players are moved to while the lobby is down.
+	Fallback string `toml:"fallback"`
+	// HoldLogins holds new logins until the lobby is back up, instead of sending them to the fallback.
+	// Held players are disconnected with Message after join_full.max_wait_seconds.
+	HoldLogins bool `toml:"hold_logins"`
+	// Message is the disconnect message shown to held players if the lobby doesn't come back in time.
+	Message string `toml:"message"`
+}
+
+// lobbyDown is set while the lobby is down and players are routed to the fallback server.
+var lobbyDown atomic.Bool
+
+// handleLobbyDown moves the players on the lobby to the fallback server and watches the lobby until it is
+// back up.
+func handleLobbyDown(proxy *spectrum.Spectrum, lobby string, interval time.Duration, logger *slog.Logger) {
+	if !lobbyDown.CompareAndSwap(false, true) {
+		return
+	}
+
+	fallback := currentConfig().LobbyFailover.Fallback
+	fallbackAddr, ok := serverRegistry.Lookup(fallback)
+	if !ok {
+		logger.Error("Lobby is down and the fallback server does not exist", "fallback", fallback)
+	} else {
+		sessions := sessionsOnServer(proxy, lobby)
+		logger.Warn(fmt.Sprintf("Lobby is down, moving %d player(s) to %s", len(sessions), fallback))
+		for _, s := range sessions {
+			go func(s *session.Session) {
+				if err := transferSession(s, fallback, fallbackAddr); err != nil {
+					logger.Error("Failed to move player to the fallback server", "player", s.Client().IdentityData().DisplayName, "error", err)
+				}
+			}(s)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if healthChecker.Check(lobby); healthChecker.Healthy(lobby) {
+				lobbyDown.Store(false)
+				logger.Info("Lobby is back up, resuming normal logins")
+				return
+			}
+		}
+	}()
+}
+
+// lobbyFailoverAddr returns the address of the fallback server if the lobby is down and logins are routed
+// to the fallback server.
+func lobbyFailoverAddr() (string, bool) {
+	conf := currentConfig()
+	if !lobbyDown.Load() || conf.LobbyFailover.HoldLogins {
+		return "", false
+	}
+	return serverRegistry.Lookup(conf.LobbyFailover.Fallback)
+}
+
+// waitForLobby waits for the lobby to come back up if it is down and logins are held. It returns false if
+// the lobby is still down after join_full.max_wait_seconds.
+func waitForLobby(conf *ServerConfig) bool {
+	if !conf.LobbyFailover.HoldLogins {
+		return true
+	}
+	deadline := time.Now().Add(time.Duration(conf.JoinFull.MaxWaitSeconds) * time.Second)
+	for lobbyDown.Load() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+)
+
+func TestLobbyFailover(t *testing.T) {
+	const lobby, hub = "127.0.0.1:19133", "127.0.0.1:19134"
+	tests := []struct {
+		name       string
+		holdLogins bool
+	}{
+		{name: "route logins to the fallback"},
+		{name: "hold logins", holdLogins: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := []Server{{Name: "lobby", Addr: lobby}, {Name: "hub", Addr: hub}}
+			useServers(t, servers...)
+			useConfig(t, &ServerConfig{
+				Servers:       servers,
+				DefaultServer: "lobby",
+				LobbyFailover: LobbyFailover{Enabled: true, Fallback: "hub", HoldLogins: tt.holdLogins},
+				JoinFull:      JoinFull{MaxWaitSeconds: 5},
+			})
+			checker := healthChecker
+			t.Cleanup(func() {
+				healthChecker = checker
+				lobbyDown.Store(false)
+			})
+			transport := &fakeTransport{}
+			healthChecker = NewHealthChecker(transport, time.Second, slog.New(slog.DiscardHandler))
+			proxy := spectrum.NewSpectrum(LobbyDiscovery{}, slog.New(slog.DiscardHandler), nil, transport)
+			s, _ := newTestSession(t, "1", "Steve", transport)
+			proxy.Registry().AddSession("1", s)
+			serverTracker.Set("1", lobby)
+
+			// The lobby goes down: its players are moved to the fallback server.
+			transport.setDown(lobby, true)
+			healthChecker.Check(lobby)
+			handleLobbyDown(proxy, lobby, 10*time.Millisecond, slog.New(slog.DiscardHandler))
+			completePendingTransfer(t, s, hub)
+			if got := transport.dialed(); !slices.Contains(got, hub) {
+				t.Fatalf("dialed %v, want the player moved to the fallback server", got)
+			}
+			want := hub
+			if tt.holdLogins {
+				want = ""
+			}
+			if addr, _ := lobbyFailoverAddr(); addr != want {
+				t.Fatalf("logins are routed to %q while the lobby is down, want %q", addr, want)
+			}
+			held := make(chan bool, 1)
+			go func() { held <- waitForLobby(currentConfig()) }()
+
+			// The lobby comes back up: logins go to the lobby again and held logins resume.
+			transport.setDown(lobby, false)
+			if !<-held {
+				t.Fatal("held login gave up before the lobby came back up")
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for lobbyDown.Load() {
+				if time.Now().After(deadline) {
+					t.Fatal("the lobby is still considered down after it came back up")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if addr, ok := lobbyFailoverAddr(); ok {
+				t.Fatalf("logins are routed to %s after the lobby came back up", addr)
+			}
+			if addr := (LobbyDiscovery{}).route(s.Client()); addr != lobby {
+				t.Fatalf("new login routed to %s, want the lobby", addr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/pelletier/go-toml"
+)
+
+// Locale configures localized player-facing messages.
+type Locale struct {
+	// CatalogFile is the path of the message catalog, a TOML file with a table of messages per language
+	// code, e.g. [de_DE] or [de]. Messages are not localized if it is empty.
+	CatalogFile string `toml:"catalog_file"`
+	// DefaultLanguage is the language used for players whose language is not in the catalog.
+	DefaultLanguage string `toml:"default_language"`
+}
+
+// messageCatalog holds the localized messages, or nil if messages are not localized.
+var messageCatalog *MessageCatalog
+
+// MessageCatalog holds player-facing messages by language code and message key.
+type MessageCatalog struct {
+	messages        map[string]map[string]string
+	defaultLanguage string
+}
+
+// LoadMessageCatalog loads a message catalog from the TOML file at path.
+func LoadMessageCatalog(path, defaultLanguage string) (*MessageCatalog, error) {
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &MessageCatalog{messages: make(map[string]map[string]string), defaultLanguage: strings.ToLower(defaultLanguage)}
+	for _, lang := range tree.Keys() {
+		table, ok := tree.GetPath([]string{lang}).(*toml.Tree)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not a table of messages", path, lang)
+		}
+		messages := make(map[string]string)
+		for key, value := range table.ToMap() {
+			message, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: message %s.%s is not a string", path, lang, key)
+			}
+			messages[key] = message
+		}
+		c.messages[strings.ToLower(lang)] = messages
+	}
+	return c, nil
+}
+
+// Message returns the message with the given key in the given language. The language is matched exactly
+// (e.g. de_DE) first, then by its language part (e.g. de), and then the default language is used.
+func (c *MessageCatalog) Message(lang, key string) (string, bool) {
+	lang = strings.ToLower(lang)
+	candidates := []string{lang}
+	if base, _, ok := strings.Cut(lang, "_"); ok {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, c.defaultLanguage)
+	for _, candidate := range candidates {
+		if message, ok := c.messages[candidate][key]; ok {
+			return message, true
+		}
+	}
+	return "", false
+}
+
+// localize returns the message with the given key in the language of the session, or fallback if the
+// catalog has no such message. placeholders are pairs of placeholders and their values, e.g. "{server}",
+// "lobby", replaced in the returned message.
+func localize(s *session.Session, key, fallback string, placeholders ...string) string {
+	return localizeLang(s.Client().ClientData().LanguageCode, key, fallback, placeholders...)
+}
+
+// localizeLang is like localize, but for the given language code instead of the language of a session.
+func localizeLang(lang, key, fallback string, placeholders ...string) string {
+	message := fallback
+	if messageCatalog != nil {
+		if m, ok := messageCatalog.Message(lang, key); ok {
+			message = m
+		}
+	}
+	if len(placeholders) > 0 {
+		message = strings.NewReplacer(placeholders...).Replace(message)
+	}
+	return message
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestCatalog writes a message catalog with the given contents and returns its path.
+func writeTestCatalog(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "messages.toml")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMessageCatalogMessage(t *testing.T) {
+	c, err := LoadMessageCatalog(writeTestCatalog(t, `
+[en]
+maintenance = "Maintenance"
+queued = "Queued"
+
+[de]
+maintenance = "Wartungsarbeiten"
+
+[DE_AT]
+maintenance = "Wartung"
+`), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		lang   string
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{name: "exact language", lang: "de_AT", key: "maintenance", want: "Wartung", wantOK: true},
+		{name: "case insensitive", lang: "DE_at", key: "maintenance", want: "Wartung", wantOK: true},
+		{name: "language part", lang: "de_DE", key: "maintenance", want: "Wartungsarbeiten", wantOK: true},
+		{name: "default language for a missing message", lang: "de_DE", key: "queued", want: "Queued", wantOK: true},
+		{name: "default language for an unknown language", lang: "fr_FR", key: "maintenance", want: "Maintenance", wantOK: true},
+		{name: "unknown message", lang: "de_DE", key: "unknown", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := c.Message(tt.lang, tt.key)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("Message(%q, %q) = %q, %v, want %q, %v", tt.lang, tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadMessageCatalogErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{name: "not a table", contents: `en = "Maintenance"`},
+		{name: "not a string", contents: "[en]\nmaintenance = 1"},
+		{name: "invalid TOML", contents: "[en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadMessageCatalog(writeTestCatalog(t, tt.contents), "en"); err == nil {
+				t.Fatal("LoadMessageCatalog succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLocalizeLang(t *testing.T) {
+	catalog := messageCatalog
+	t.Cleanup(func() { messageCatalog = catalog })
+
+	tests := []struct {
+		name    string
+		catalog string
+		want    string
+	}{
+		{name: "no catalog", want: "lobby is full"},
+		{name: "catalog message", catalog: "[de]\nfull = \"{server} ist voll\"", want: "lobby ist voll"},
+		{name: "fallback for a missing message", catalog: "[de]\nother = \"Andere\"", want: "lobby is full"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messageCatalog = nil
+			if tt.catalog != "" {
+				c, err := LoadMessageCatalog(writeTestCatalog(t, tt.catalog), "en")
+				if err != nil {
+					t.Fatal(err)
+				}
+				messageCatalog = c
+			}
+			if got := localizeLang("de_DE", "full", "{server} is full", "{server}", "lobby"); got != tt.want {
+				t.Fatalf("localizeLang() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
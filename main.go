@@ -3,7 +3,10 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"flag"
 	"fmt"
 	"image/color"
 	"log/slog"
@@ -13,7 +16,9 @@ import (
 	"path"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -26,7 +31,6 @@ import (
 	"github.com/cooldogedev/spectrum/util"
 	"github.com/elk-language/go-prompt"
 	"github.com/lmittmann/tint"
-	"github.com/oomph-ac/oconfig"
 	"github.com/oomph-ac/oomph"
 	"github.com/oomph-ac/oomph/player"
 	"github.com/pelletier/go-toml"
@@ -36,26 +40,35 @@ import (
 	"github.com/sandertv/gophertunnel/minecraft/resource"
 )
 
-// map of server addresses to their names.
-var serverMap = make(map[string]string)
-var addressToName = make(map[string]string)
-
-var lobbyServerAddress string
 var resourcePackServer *ResourcePackServer
 
+// loadedPacks holds the resource packs read from disk, before they are modified for the CDN.
+var loadedPacks []*resource.Pack
+
+// cdnBaseURL is the base URL of the resource pack CDN, or empty if the CDN is disabled.
+var cdnBaseURL string
+
+// announcer announces transfers between servers to other players.
+var announcer *transferAnnouncer
+
 // LobbyDiscovery implements server.Discovery to discover the lobby server address.
-type LobbyDiscovery struct {
-}
+type LobbyDiscovery struct{}
 
 type ServerConfig struct {
 	// Name is the name of this server, used for MOTD.
 	Name string `toml:"name"`
+	// SubName is the sub name shown in the server list, Name is used if it is empty.
+	SubName string `toml:"sub_name"`
+	// Motd configures a server list entry with live player counts, shown instead of Name and SubName.
+	Motd Motd `toml:"motd"`
 	// BindAddr is the address to bind the proxy server to.
 	BindAddr string `toml:"bind_addr"`
 	// DefaultServer is the name of the default server to connect to.
 	DefaultServer string `toml:"default_server"`
 	// Servers is a list of servers to connect to.
 	Servers []Server `toml:"servers"`
+	// SRVRefreshSeconds is the interval at which addresses resolved through SRV records are resolved again.
+	SRVRefreshSeconds int `toml:"srv_refresh_seconds"`
 	// ShutdownMessage is the message sent to players when the proxy is shutting down.
 	ShutdownMessage string `toml:"shutdown_message"`
 	// Debug enables debug mode, which logs more information.
@@ -64,34 +77,314 @@ type ServerConfig struct {
 	CdnConfig CdnConfig `toml:"cdn_config"`
 	// OomphEnabled indicates whether to enable Oomph Anticheat proxy.
 	OomphEnabled bool `toml:"oomph_enabled"`
+	// Oomph contains the settings of Oomph Anticheat. Use 'oomph reload' to apply changes.
+	Oomph OomphSettings `toml:"oomph"`
 
 	APIServer APIServer `toml:"api_server"`
+	// LoginRate limits how fast players may log in across the whole proxy.
+	LoginRate LoginRate `toml:"login_rate"`
+	// HealthCheck contains backend health checking configuration.
+	HealthCheck HealthCheck `toml:"health_check"`
+	// PackLimits limits the resource packs loaded at startup.
+	PackLimits PackLimits `toml:"pack_limits"`
+	// TransferAnnouncement configures the chat message announcing players transferring between servers.
+	TransferAnnouncement TransferAnnouncement `toml:"transfer_announcement"`
+	// TransferMetadata configures the metadata sent to backends after a transfer.
+	TransferMetadata TransferMetadataConfig `toml:"transfer_metadata"`
+	// MaxConcurrentTransfers limits how many transfers may be in progress at the same time, 0 for no limit.
+	MaxConcurrentTransfers int `toml:"max_concurrent_transfers"`
+	// TransferTimeoutSeconds is how long a transfer may take, from dialing the server until the player
+	// spawned on it, before it is abandoned. It may need to be raised for backends on slow links.
+	TransferTimeoutSeconds int `toml:"transfer_timeout_seconds"`
+	// DisplayNames configures how display names with invalid characters are handled.
+	DisplayNames DisplayNames `toml:"display_names"`
+	// PackRefreshMessage is the message sent to all players by 'packs notify' after resource packs changed.
+	PackRefreshMessage string `toml:"pack_refresh_message"`
+	// ServerGroups maps group names to the names of their servers. Transfers to "group:<name>" go to the
+	// least-loaded available server of the group.
+	ServerGroups map[string][]string `toml:"server_groups"`
+	// MaxPlayers is the maximum number of players on the proxy, 0 for no limit.
+	MaxPlayers int `toml:"max_players"`
+	// JoinFull configures what happens to players joining while the proxy or the lobby is full.
+	JoinFull JoinFull `toml:"join_full"`
+	// ChatRate limits how fast a single player may send chat messages and commands.
+	ChatRate ChatRate `toml:"chat_rate"`
+	// OptionalPacks lets players that decline the resource packs join without them. By default, packs are
+	// required and the client refuses to join when they are declined. The proxy is never told about the
+	// decline, so players can't be routed elsewhere or shown a message from the proxy.
+	OptionalPacks bool `toml:"optional_packs"`
+	// TransferFailure configures what happens when a transfer requested by a backend fails.
+	TransferFailure TransferFailure `toml:"transfer_failure"`
+	// TransferCooldown limits how often a backend can transfer the same player.
+	TransferCooldown TransferCooldown `toml:"transfer_cooldown"`
+	// PlayerCommands configures the commands players can run on the proxy from chat.
+	PlayerCommands PlayerCommands `toml:"player_commands"`
+	// RecentDisconnects is the number of disconnects kept for the recent command.
+	RecentDisconnects int `toml:"recent_disconnects"`
+	// Firewall configures which IP addresses may connect to the proxy.
+	Firewall Firewall `toml:"firewall"`
+	// Locale configures localized player-facing messages.
+	Locale Locale `toml:"locale"`
+	// ReconnectGraceSeconds is how long the slot and last server of a disconnected player are kept, so
+	// that reconnecting players return to their server even if it is full. Zero disables reservations.
+	ReconnectGraceSeconds int `toml:"reconnect_grace_seconds"`
+	// Metrics configures where metrics are sent.
+	Metrics Metrics `toml:"metrics"`
+	// LobbyFailover configures what happens while the lobby server is down.
+	LobbyFailover LobbyFailover `toml:"lobby_failover"`
+	// ConnectionThrottle limits how often a single IP may connect.
+	ConnectionThrottle ConnectionThrottle `toml:"connection_throttle"`
+	// UnsupportedVersion configures how clients on an unsupported game version are turned away.
+	UnsupportedVersion UnsupportedVersion `toml:"unsupported_version"`
+	// Drain configures how the proxy is drained before it shuts down.
+	Drain Drain `toml:"drain"`
+	// Network tunes how packets are batched on the connections of the proxy.
+	Network Network `toml:"network"`
+	// SlowMode delays logins while the default server is busy.
+	SlowMode SlowMode `toml:"slow_mode"`
+	// EventHooks configures commands run when events such as player joins happen.
+	EventHooks EventHooks `toml:"event_hooks"`
+	// ContentKeys maps the UUIDs of encrypted resource packs to the keys used to decrypt them.
+	ContentKeys map[string]string `toml:"content_keys"`
+	// ConnectionLog configures the audit log of connection attempts.
+	ConnectionLog ConnectionLog `toml:"connection_log"`
+	// Observers configures staff accounts that may join any server regardless of allow lists and limits.
+	Observers Observers `toml:"observers"`
+	// Maintenance configures maintenance mode, toggled with the maintenance command.
+	Maintenance Maintenance `toml:"maintenance"`
+	// Whitelist configures the whitelist managed with the whitelist command.
+	Whitelist WhitelistConfig `toml:"whitelist"`
+	// Bans configures the ban list managed with the ban and unban commands.
+	Bans BansConfig `toml:"bans"`
+	// GeoIP configures routing joining players to the lobby of their region.
+	GeoIP GeoIP `toml:"geoip"`
+	// History configures the history of the console.
+	History History `toml:"history"`
+	// Aliases maps console command shortcuts to the commands they stand for, such as tp = "transfer". An
+	// alias may include arguments and refer to another alias.
+	Aliases map[string]string `toml:"aliases"`
+}
+
+// TransferFailure configures what happens when a transfer requested by a backend fails.
+type TransferFailure struct {
+	// Message is shown to the player, in chat if they were moved to the lobby and as the disconnect
+	// message otherwise.
+	Message string `toml:"message"`
+	// Fallback moves the player to the lobby instead of disconnecting them.
+	Fallback bool `toml:"fallback"`
+	// Attempts is how many times a transfer is attempted before it is considered failed. Transfers that
+	// are denied or vetoed are not retried.
+	Attempts int `toml:"attempts"`
+	// RetryDelayMillis is the delay before the first retry in milliseconds. It doubles with every retry.
+	RetryDelayMillis int `toml:"retry_delay_millis"`
+}
+
+// History configures the history of the console.
+type History struct {
+	// DedupAll keeps a single entry per command, moving commands that are run again to the end of the
+	// history. Otherwise only repeats of the last command are skipped.
+	DedupAll bool `toml:"dedup_all"`
+	// Dir is the directory the history is stored in. If empty, $SPECTRUM_HOME is used, or ~/.spectrum, or
+	// .spectrum in the working directory if the home directory can't be used.
+	Dir string `toml:"dir"`
+}
+
+// TransferCooldown configures the minimum interval between two transfers of a player requested by backends.
+type TransferCooldown struct {
+	// Millis is the minimum interval in milliseconds. Zero disables the cooldown.
+	Millis int `toml:"millis"`
+	// Message is sent to the player when a transfer is ignored. No message is sent if it is empty.
+	Message string `toml:"message"`
+}
+
+// DisplayNames configures how display names with characters other than letters, digits, spaces,
+// underscores and hyphens are handled at login.
+type DisplayNames struct {
+	// Policy is one of "pass", "sanitize" or "reject". With "sanitize" the real name is kept for display,
+	// but a sanitized form is used for log files and log entries.
+	Policy string `toml:"policy"`
+	// RejectMessage is the disconnect message shown to players rejected by the "reject" policy.
+	RejectMessage string `toml:"reject_message"`
 }
 
 type Server struct {
 	Name string `toml:"name"`
+	// Addr is the address of the server. Addresses without a port are resolved through the
+	// _minecraft._udp SRV record of the host.
 	Addr string `toml:"addr"`
+	// SRV resolves Addr through its SRV record even if it has a port, which is used if the lookup fails.
+	SRV bool `toml:"srv"`
+	// host is the configured address of a server resolved through SRV, while Addr is the resolved one.
+	host string
+	// MaxPlayers is the maximum number of players on this server. Players transferring to a full
+	// server are put in its queue. Zero means unlimited.
+	MaxPlayers int `toml:"max_players"`
+	// Allowed lists the XUIDs or display names of the players allowed to join this server. Everyone may
+	// join if it is empty.
+	Allowed []string `toml:"allowed"`
+	// DenyMessage is sent to players that aren't allowed to join this server. {server} is replaced with
+	// the name of the server.
+	DenyMessage string `toml:"deny_message"`
+	// ConnectMessage is sent to players after they joined this server, if not empty. {player} is replaced
+	// with the name of the player.
+	ConnectMessage string `toml:"connect_message"`
+	// Lobby makes new players join this server as well as the default server, spread by weight.
+	Lobby bool `toml:"lobby"`
+	// Weight is the share of new players sent to this server if it is a lobby, relative to the other
+	// lobbies. Zero counts as one.
+	Weight int `toml:"weight"`
+	// Packs lists the UUIDs of the resource packs holding the content of this server. 'packs reload
+	// <server>' reloads only these packs.
+	Packs []string `toml:"packs"`
 }
 
 type CdnConfig struct {
 	Enabled bool   `toml:"enabled"`
 	Ip      string `toml:"ip"`
 	Port    int    `toml:"port"`
+	// SelfTest downloads every pack from the CDN at startup to verify it is reachable.
+	SelfTest bool `toml:"self_test"`
+	// ExternalURLs maps pack UUIDs to external URLs (e.g. S3 or CloudFront) that clients are redirected to
+	// instead of downloading the pack from the proxy.
+	ExternalURLs map[string]string `toml:"external_urls"`
+	// Socket contains socket options applied to connections accepted by the CDN.
+	Socket CdnSocket `toml:"socket"`
+	// TLSCert and TLSKey are the paths of the certificate and key used to serve the CDN over HTTPS. The CDN
+	// is served over plain HTTP if they are empty. Use 'cdn reload-cert' after renewing the certificate.
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
+	// AutoCert obtains the certificate from Let's Encrypt instead, for the domain name in Ip. The CDN must
+	// be reachable on port 443 for the domain to be verified.
+	AutoCert bool `toml:"auto_cert"`
+	// AutoCertCacheDir is the directory obtained certificates are stored in, so they survive restarts.
+	AutoCertCacheDir string `toml:"auto_cert_cache_dir"`
+}
+
+// CdnSocket contains socket options of the CDN listener. Zero values keep the Go and OS defaults.
+type CdnSocket struct {
+	// DisableNoDelay disables TCP_NODELAY, which Go enables by default, so small writes are coalesced.
+	DisableNoDelay bool `toml:"disable_no_delay"`
+	// WriteBufferKB is the size of the socket send buffer (SO_SNDBUF) in KB.
+	WriteBufferKB int `toml:"write_buffer_kb"`
+	// ReadBufferKB is the size of the socket receive buffer (SO_RCVBUF) in KB.
+	ReadBufferKB int `toml:"read_buffer_kb"`
+	// KeepAliveSeconds is the TCP keep-alive period in seconds, or -1 to disable keep-alives.
+	KeepAliveSeconds int `toml:"keep_alive_seconds"`
 }
 
 type APIServer struct {
 	BindAddr string `toml:"bind_addr"`
 	Token    string `toml:"token"`
+	// HTTPAddr is the address of the HTTP API, which serves a WebSocket event stream at /events, the online
+	// players at /players and player transfers at /transfer. It is authenticated with Token and disabled
+	// if empty.
+	HTTPAddr string `toml:"http_addr"`
+}
+
+type LoginRate struct {
+	// PerSecond is the number of logins allowed per second. Zero disables the limit.
+	PerSecond float64 `toml:"per_second"`
+	// Burst is the number of logins allowed at once before the rate applies.
+	Burst int `toml:"burst"`
+	// MaxWaitSeconds is how long a login may be held back before it is rejected instead.
+	MaxWaitSeconds int `toml:"max_wait_seconds"`
+	// Message is the disconnect message sent to players rejected by the limit.
+	Message string `toml:"message"`
 }
 
-// Discover returns the lobby server address for the player to connect to.
+type HealthCheck struct {
+	// ActiveIntervalSeconds is the interval at which servers are probed. Zero, the default, disables probing.
+	ActiveIntervalSeconds int `toml:"active_interval_seconds"`
+	// TimeoutSeconds is how long a probe may take before the server is considered down.
+	TimeoutSeconds int `toml:"timeout_seconds"`
+	// AllServers probes every configured server instead of only those with players on them, so that
+	// transfers to servers that are down can be refused up front.
+	AllServers bool `toml:"all_servers"`
+	// DownMessage is sent to players transferring to a server that is down. {server} is replaced with
+	// the name of the server.
+	DownMessage string `toml:"down_message"`
+}
+
+type PackLimits struct {
+	// MaxCount is the maximum number of resource packs loaded. Zero means unlimited.
+	MaxCount int `toml:"max_count"`
+	// MaxTotalSizeMB is the maximum combined size of all loaded resource packs in megabytes. Zero means unlimited.
+	MaxTotalSizeMB int `toml:"max_total_size_mb"`
+	// Strict makes the proxy refuse to start when a limit is exceeded. Otherwise, packs are loaded in
+	// file name order until a limit is reached and the rest are skipped.
+	Strict bool `toml:"strict"`
+}
+
+type TransferAnnouncement struct {
+	// Scope is who receives the announcement: "all", "target" (players on the target server) or "none".
+	Scope string `toml:"scope"`
+	// Template is the announcement message. {player} and {server} are replaced with the player and server name.
+	Template string `toml:"template"`
+	// PerSecond is the maximum number of announcements per second. Zero means unlimited.
+	PerSecond float64 `toml:"per_second"`
+	// Burst is the number of announcements allowed at once before PerSecond applies.
+	Burst int `toml:"burst"`
+}
+
+type TransferMetadataConfig struct {
+	// Enabled enables sending a script message with transfer metadata to the target backend.
+	Enabled bool `toml:"enabled"`
+	// Identifier is the identifier of the script message.
+	Identifier string `toml:"identifier"`
+	// Tags are static tags included in the metadata, e.g. the region of this proxy.
+	Tags map[string]string `toml:"tags"`
+}
+
+// Discover returns the address of the server checkJoinCapacity picked for the player. Otherwise, it returns
+// the address of the lobby server for the player to connect to, or the server the player was on if they are
+// reconnecting within the reconnect grace window. With GeoIP routing, players join the lobby of their region
+// if it is healthy. With multiple lobbies, players are spread over the healthy ones by weight.
 func (l LobbyDiscovery) Discover(conn *minecraft.Conn) (string, error) {
-	return lobbyServerAddress, nil
+	xuid := conn.IdentityData().XUID
+	addr, ok := joinRoutes.Take(xuid)
+	if !ok {
+		addr = l.route(conn)
+	}
+	serverTracker.Set(xuid, addr)
+	return addr, nil
 }
 
-// DiscoverFallback returns the lobby server address as a fallback for the player.
+// route returns the address of the server a joining player is sent to. The weighted round-robin turn of
+// the lobbies is only taken if the player isn't sent to a specific server, so that the distribution over
+// the lobbies matches their weights.
+func (l LobbyDiscovery) route(conn *minecraft.Conn) string {
+	xuid := conn.IdentityData().XUID
+	if addr, ok := lobbyFailoverAddr(); ok {
+		reconnects.Take(xuid)
+		return addr
+	}
+	healthy := func(addr string) bool {
+		return healthChecker == nil || healthChecker.Healthy(addr)
+	}
+
+	if last, ok := reconnects.Take(xuid); ok {
+		if _, exists := serverRegistry.Name(last); exists && healthy(last) {
+			return last
+		}
+	}
+	if name, ok := geoRouter.Lobby(conn.RemoteAddr()); ok {
+		if regional, exists := serverRegistry.Lookup(name); exists && healthy(regional) {
+			return regional
+		}
+	}
+	return serverRegistry.NextLobby(healthy)
+}
+
+// DiscoverFallback returns the address of a lobby server as a fallback for the player, preferring a
+// healthy lobby other than the server the player was on.
 func (l LobbyDiscovery) DiscoverFallback(conn *minecraft.Conn) (string, error) {
-	return lobbyServerAddress, nil
+	if addr, ok := lobbyFailoverAddr(); ok {
+		return addr, nil
+	}
+	failed, _ := serverTracker.Server(conn.IdentityData().XUID)
+	return serverRegistry.NextLobby(func(addr string) bool {
+		return addr != failed && (healthChecker == nil || healthChecker.Healthy(addr))
+	}), nil
 }
 
 // TransferProcessor implements session.Processor to handle server transfers while player is in the game.
@@ -99,83 +392,285 @@ type TransferProcessor struct {
 	session.NopProcessor
 	// s is the current session being processed.
 	s *session.Session
+	// conf is the proxy configuration.
+	conf *ServerConfig
+	// registry is the session registry of the proxy.
+	registry *session.Registry
 	// log is the logger for this processor.
 	log *slog.Logger
+	// accepted is the time the session was accepted.
+	accepted time.Time
+	// joined is set once the session logged in. Sessions disconnected before that never joined, so they
+	// don't leave either.
+	joined atomic.Bool
+	// lastTransfer is the time the backend last requested a transfer that was not rejected by the cooldown.
+	lastTransfer time.Time
+}
+
+// transferCooldown reports if a transfer requested by the backend at now falls within the cooldown of the
+// previous one. If not, now is recorded as the time of the last transfer.
+func (p *TransferProcessor) transferCooldown(now time.Time) bool {
+	cooldown := time.Duration(p.conf.TransferCooldown.Millis) * time.Millisecond
+	if cooldown > 0 && !p.lastTransfer.IsZero() && now.Sub(p.lastTransfer) < cooldown {
+		return true
+	}
+	p.lastTransfer = now
+	return false
 }
 
 // ProcessServer is called when a packet is received from the server.
 // Canceling it will prevent the packet from being sent to the client.
 func (p *TransferProcessor) ProcessServer(ctx *session.Context, pk *packet.Packet) {
 	if t, ok := (*pk).(*packet.Transfer); ok {
-		addr := t.Address
-		if a, ok := serverMap[addr]; ok {
+		name, addr, err := resolveTarget(t.Address)
+		if err == nil {
 			ctx.Cancel()
-			err := p.s.TransferTimeout(a, 10*time.Second)
-			if err != nil {
-				p.log.Error("failed to transfer", "err", err, "address", addr)
-				p.s.CloseWithError(err)
+			if p.transferCooldown(time.Now()) {
+				p.log.Debug("transfer ignored, cooldown active", "server", name)
+				if p.conf.TransferCooldown.Message != "" {
+					_ = sendMessage(p.s, localize(p.s, "transfer_cooldown", p.conf.TransferCooldown.Message))
+				}
+				return
+			}
+			if denyIfNotAllowed(p.s, name) {
+				p.log.Info("transfer denied", "server", name)
+				return
 			}
+			if serverDown(addr) {
+				p.log.Info("transfer refused, server is down", "server", name)
+				_ = sendMessage(p.s, localize(p.s, "server_down", p.conf.HealthCheck.DownMessage, "{server}", name))
+				return
+			}
+			if serverFullFor(p.s, name, addr) {
+				pos := joinQueue.Enqueue(name, p.s)
+				_ = sendMessage(p.s, queuedMessage(p.s, name, pos))
+				return
+			}
+			// ProcessServer runs on the packet loop of the session, which also drives the connection
+			// sequence with the new server, so the transfer and its retries must not block it.
+			go p.transferWithRetries(name, addr)
+		}
+		return
+	}
+}
+
+// transferWithRetries transfers the player to the named server, retrying failed attempts with an
+// exponential backoff as configured. If all attempts fail, the failure is handled as configured in
+// TransferFailure.
+func (p *TransferProcessor) transferWithRetries(name, addr string) {
+	err := p.retryTransfer(name, addr)
+	switch {
+	case errors.Is(err, errTransferDenied):
+		// The player was told why, keep them on their current server.
+		p.log.Info("transfer denied", "server", name)
+	case errors.Is(err, errTransferVetoed):
+		p.log.Info("transfer vetoed", "server", name)
+	case errors.Is(err, errTransferInProgress):
+		p.log.Info("transfer ignored, another transfer is in progress", "server", name)
+	case errors.Is(err, context.Canceled):
+		// The session closed, there is no one left to handle the failure for.
+	case err != nil:
+		p.log.Error("failed to transfer", "err", err, "address", name)
+		p.handleTransferFailure(addr)
+	}
+}
+
+// retryTransfer transfers the player to the named server and retries failed attempts. It returns the
+// error of the last attempt.
+func (p *TransferProcessor) retryTransfer(name, addr string) error {
+	conf := p.conf.TransferFailure
+	delay := time.Duration(conf.RetryDelayMillis) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := transferSession(p.s, name, addr)
+		if err == nil || attempt >= conf.Attempts || !retryableTransferError(err) {
+			return err
+		}
+		p.log.Warn("transfer failed, retrying", "server", name, "attempt", attempt, "delay", delay, "err", err)
+		select {
+		case <-p.s.Context().Done():
+			return p.s.Context().Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// handleTransferFailure is called when a transfer to addr requested by the backend failed. The player is
+// moved to a lobby if configured, and disconnected with the configured message otherwise.
+func (p *TransferProcessor) handleTransferFailure(addr string) {
+	conf := p.conf.TransferFailure
+	if conf.Fallback {
+		lobby, _ := LobbyDiscovery{}.DiscoverFallback(p.s.Client())
+		if lobbyName, ok := serverRegistry.Name(lobby); ok && addr != lobby {
+			err := transferSession(p.s, lobbyName, lobby)
+			if err == nil {
+				_ = sendMessage(p.s, localize(p.s, "transfer_failed", conf.Message))
+				return
+			}
+			p.log.Error("failed to fall back to the lobby", "err", err)
+		}
+	}
+	p.s.Disconnect(localize(p.s, "transfer_failed", conf.Message))
+}
+
+// ProcessTransferFailure is called when the transfer of the player to a different server failed.
+func (p *TransferProcessor) ProcessTransferFailure(_ *session.Context, origin *string, target *string) {
+	failTransfer(p.s, *origin, *target)
+}
+
+// ProcessPostTransfer is called after the player has been transferred to a different server.
+func (p *TransferProcessor) ProcessPostTransfer(_ *session.Context, origin *string, target *string) {
+	serverTracker.Set(p.s.Client().IdentityData().XUID, *target)
+
+	name, ok := serverRegistry.Name(*target)
+	previous, _ := serverRegistry.Name(*origin)
+	if !completeTransfer(p.s, *target, nil) {
+		// The transfer was started by Spectrum itself, e.g. to move the player to a fallback server.
+		reportTransfer(p.s, previous, name, nil)
+	}
+
+	if p.conf.TransferMetadata.Enabled {
+		if err := sendTransferMetadata(p.s, p.conf.TransferMetadata, previous); err != nil {
+			p.log.Error("failed to send transfer metadata", "err", err)
 		}
+	}
+	if ok && announcer != nil {
+		announcer.Announce(p.s, p.registry, name, *target)
+	}
+	identity := p.s.Client().IdentityData()
+	eventStream.Publish(StreamEvent{Type: StreamEventTransfer, Player: identity.DisplayName, XUID: identity.XUID, From: previous, To: name})
+	sendConnectMessage(p.s)
+}
+
+// ProcessDisconnection is called when the player disconnects from the proxy. Sessions that never joined
+// are only forgotten, they don't leave, show up in the recent disconnects or get a reconnect reservation.
+func (p *TransferProcessor) ProcessDisconnection(_ *session.Context, message *string) {
+	proxyCounters.disconnects.Add(1)
+	metricsSink.AddCounter(metricDisconnects, 1)
+	identity := p.s.Client().IdentityData()
+	addr, tracked := serverTracker.Server(identity.XUID)
+	data := playerEventData(p.s)
+	serverTracker.Remove(identity.XUID)
+	joinQueue.Remove(identity.XUID)
+	attachedProcessors.Remove(p.s)
+	if !p.joined.Load() {
 		return
 	}
+
+	metricsSink.SetGauge(metricPlayers, float64(max(len(p.registry.GetSessions())-1, 0)))
+	data["reason"] = *message
+	events.Dispatch(EventPlayerLeave, data)
+	eventStream.Publish(StreamEvent{Type: StreamEventQuit, Player: data["player"], XUID: data["xuid"], Server: data["server"], Reason: *message})
+	if tracked && p.conf.ReconnectGraceSeconds > 0 && !proxyClosing.Load() {
+		reconnects.Reserve(identity.XUID, addr, time.Duration(p.conf.ReconnectGraceSeconds)*time.Second)
+	}
+	recentDisconnects.Add(DisconnectRecord{
+		Name:     identity.DisplayName,
+		XUID:     identity.XUID,
+		Reason:   *message,
+		Time:     time.Now(),
+		Duration: time.Since(p.accepted),
+	})
 }
 
 func main() {
-	conf, err := readConfig()
+	flag.Var(&configPaths, "config", "path of a config file, repeat to merge override files over a base config in order")
+	regenerateBroken := flag.Bool("regenerate-broken-config", false, "back up an unparsable config file to <file>.bak and start with the default configuration")
+	flag.Parse()
+
+	if len(configPaths) > 0 {
+		configFile = configPaths[0]
+	}
+	conf, err := loadConfig(*regenerateBroken)
 	if err != nil {
 		panic(fmt.Errorf("read config: %w", err))
 	}
 
-	var logLevel slog.Level
-	if conf.Debug {
-		logLevel = slog.LevelDebug
-	} else {
-		logLevel = slog.LevelInfo
-	}
-
-	slog.SetLogLoggerLevel(logLevel)
+	setDebug(conf.Debug)
+	consoleCommands = newConsoleCommands()
 
 	w := os.Stderr
 	logger := slog.New(
 		tint.NewHandler(w, &tint.Options{
-			Level:      logLevel,
+			Level:      &logLevel,
 			TimeFormat: time.TimeOnly,
 		}),
 	)
 	slog.SetDefault(logger)
 
-	for _, srv := range conf.Servers {
-		serverMap[srv.Name] = srv.Addr
-		addressToName[srv.Addr] = srv.Name
-		if srv.Name == conf.DefaultServer {
-			lobbyServerAddress = srv.Addr
+	observers.Set(conf.Observers.XUIDs)
+	maintenance.SetEnabled(conf.Maintenance.Enabled)
+	maintenance.SetWhitelist(conf.Maintenance.Whitelist)
+	if conf.Whitelist.File != "" {
+		if whitelist, err = NewWhitelist(conf.Whitelist.File); err != nil {
+			logger.Error("Failed to load the whitelist", "error", err)
+			return
 		}
-		logger.Info("Loaded server", "name", srv.Name, "address", srv.Addr)
+	} else if conf.Whitelist.Enabled {
+		logger.Error("The whitelist is enabled, but whitelist.file is not set")
+		return
 	}
-
-	if lobbyServerAddress == "" {
-		logger.Error("No default server found")
+	if conf.Bans.File != "" {
+		if bans, err = NewBanManager(conf.Bans.File); err != nil {
+			logger.Error("Failed to load bans", "error", err)
+			return
+		}
+	}
+	conf.Servers = resolveServers(conf.Servers, logger)
+	if err := serverRegistry.Set(conf.Servers, conf.DefaultServer); err != nil {
+		logger.Error("Invalid server configuration", "error", err)
 		return
 	}
+	for _, srv := range conf.Servers {
+		logger.Info("Loaded server", "name", srv.Name, "address", srv.Addr)
+	}
+	if conf.GeoIP.Database != "" {
+		if geoRouter, err = NewGeoRouter(conf.GeoIP.Database, conf.GeoIP.Lobbies); err != nil {
+			logger.Error("Failed to load the GeoIP database", "error", err)
+			return
+		}
+		for region, lobby := range conf.GeoIP.Lobbies {
+			if _, ok := serverRegistry.Lookup(lobby); !ok {
+				logger.Warn("Unknown GeoIP lobby, players from its region join the default lobbies", "region", region, "server", lobby)
+			}
+		}
+	}
 
-	packs, err := parse(make(map[string]string), logger) // TODO: support content keys
+	packs, err := parse(conf.ContentKeys, conf.PackLimits, logger)
 	if err != nil {
 		logger.Error("failed to parse resource packs", "err", err)
 		return
 	}
 
 	logger.Info("Loaded resource packs", "count", len(packs))
+	loadedPacks = packs
 
 	// Start the HTTP resource pack server if CDN is enabled
 	if conf.CdnConfig.Enabled && len(packs) > 0 {
-		baseURL := fmt.Sprintf("http://%s:%d", conf.CdnConfig.Ip, conf.CdnConfig.Port)
+		if err := validateCDNTLS(conf.CdnConfig); err != nil {
+			logger.Error("Invalid CDN TLS configuration", "error", err)
+			return
+		}
+		scheme := "http"
+		if conf.CdnConfig.TLSCert != "" || conf.CdnConfig.AutoCert {
+			scheme = "https"
+		}
+		baseURL := fmt.Sprintf("%s://%s:%d", scheme, conf.CdnConfig.Ip, conf.CdnConfig.Port)
 
 		// Create and start the resource pack HTTP server
-		resourcePackServer, err = NewResourcePackServer(packs, conf.CdnConfig.Port, logger)
+		resourcePackServer, err = NewResourcePackServer(packs, conf.CdnConfig.Port, conf.CdnConfig.ExternalURLs, conf.CdnConfig.Socket, logger)
 		if err != nil {
 			logger.Error("Failed to create resource pack HTTP server", "error", err)
 			return
 		}
+		if conf.CdnConfig.TLSCert != "" {
+			if err := resourcePackServer.EnableTLS(conf.CdnConfig.TLSCert, conf.CdnConfig.TLSKey); err != nil {
+				logger.Error("Failed to enable TLS for the resource pack server", "error", err)
+				return
+			}
+		} else if conf.CdnConfig.AutoCert {
+			resourcePackServer.EnableAutoCert(conf.CdnConfig.Ip, conf.CdnConfig.AutoCertCacheDir)
+		}
 
 		// Start the HTTP server in a goroutine
 		go func() {
@@ -189,61 +684,85 @@ func main() {
 		logger.Info("Resource pack HTTP server is ready", "baseURL", baseURL)
 
 		// Modify resource packs to use HTTP URLs
-		packs = ModifyResourcePackForCDN(packs, baseURL)
+		if conf.CdnConfig.SelfTest {
+			if errs := SelfTestCDN(packs, baseURL); len(errs) > 0 {
+				for _, err := range errs {
+					logger.Error("CDN self-test failed", "err", err)
+				}
+			} else {
+				logger.Info("CDN self-test passed", "packs", len(packs))
+			}
+		}
+
+		cdnBaseURL = baseURL
+		if packs, err = ModifyResourcePackForCDN(packs, baseURL); err != nil {
+			logger.Error("Failed to load resource packs from the CDN", "error", err)
+			return
+		}
 		for _, pack := range packs {
 			logger.Debug("Loaded resource pack", "name", pack.Name(), "uuid", pack.UUID(), "url", pack.DownloadURL())
 		}
 		logger.Info("Modified resource packs to use HTTP URLs")
 	}
 
-	var flushRate time.Duration
-	if conf.OomphEnabled {
-		flushRate = -1
-	} else {
-		flushRate = 20 / time.Second
+	if conf.Drain.Fallback != "" {
+		if err := validateAddr(conf.Drain.Fallback); err != nil {
+			logger.Error("Invalid drain fallback address", "error", err)
+			return
+		}
 	}
-
-	var autoLogin = true
-	if conf.OomphEnabled {
-		autoLogin = false
+	if err := validateNetwork(conf.Network); err != nil {
+		logger.Error("Invalid network config", "error", err)
+		return
 	}
+	if conf.TransferTimeoutSeconds <= 0 {
+		logger.Error(fmt.Sprintf("transfer_timeout_seconds must be positive, got %d", conf.TransferTimeoutSeconds))
+		return
+	}
+	if conf.HealthCheck.TimeoutSeconds <= 0 {
+		logger.Error(fmt.Sprintf("health_check.timeout_seconds must be positive, got %d", conf.HealthCheck.TimeoutSeconds))
+		return
+	}
+	if conf.OomphEnabled && conf.Network.ClientFlushMillis != 0 && conf.Network.ClientFlushMillis != -1 {
+		logger.Warn("Ignoring network.client_flush_millis, Oomph flushes client connections by itself")
+	}
+	flushRate := clientFlushRate(conf)
 
-	oconfig.Global = oconfig.DefaultConfig
-	//oconfig.Global.Network.Transport = oconfig.NetworkTransportSpectral
-
-	oconfig.Global.Movement.AcceptClientPosition = false
-	oconfig.Global.Movement.PositionAcceptanceThreshold = 0.003
-	oconfig.Global.Movement.AcceptClientVelocity = false
-	oconfig.Global.Movement.VelocityAcceptanceThreshold = 0.077
-
-	oconfig.Global.Movement.PersuasionThreshold = 0.002
-	oconfig.Global.Movement.CorrectionThreshold = 0.003
-
-	oconfig.Global.Combat.MaximumAttackAngle = 90
-	oconfig.Global.Combat.EnableClientEntityTracking = true
+	applyOomphSettings(conf.Oomph)
 
-	oconfig.Global.Network.GlobalMovementCutoffThreshold = -1
-	oconfig.Global.Network.MaxEntityRewind = 6
-	oconfig.Global.Network.MaxGhostBlockChain = 7
-	oconfig.Global.Network.MaxKnockbackDelay = -1
-	oconfig.Global.Network.MaxBlockUpdateDelay = -1
+	if err := validateAliases(conf.Aliases); err != nil {
+		logger.Error("Invalid command aliases", "error", err)
+		return
+	}
+	if conf.PlayerCommands.Enabled {
+		if err := validateCommandPrefix(conf.PlayerCommands.Prefix); err != nil {
+			logger.Error("Invalid player command prefix", "error", err)
+			return
+		}
+	}
 
-	proxy := spectrum.NewSpectrum(server.NewStaticDiscovery(lobbyServerAddress, lobbyServerAddress), logger, &util.Opts{
-		ShutdownMessage: conf.ShutdownMessage,
-		Addr:            conf.BindAddr,
-		AutoLogin:       autoLogin,
-		LatencyInterval: 1000,
-		ClientDecode:    player.ClientDecode,
-		SyncProtocol:    false,
-	}, transport.NewSpectral(logger))
+	clientDecode := player.ClientDecode
+	if conf.ChatRate.PerSecond > 0 || conf.PlayerCommands.Enabled {
+		clientDecode = append(slices.Clone(clientDecode), packet.IDText, packet.IDCommandRequest)
+	}
+	liveConfig.Store(conf)
+	statusProvider = NewStatusProvider(conf)
+	var acceptedProtocols []minecraft.Protocol
+	if conf.UnsupportedVersion.Enabled {
+		acceptedProtocols = unsupportedProtocols()
+	}
+	proxy := spectrum.NewSpectrum(LobbyDiscovery{}, logger, proxyOpts(conf, clientDecode), transport.NewSpectral(logger))
 	if err := proxy.Listen(minecraft.ListenConfig{
-		StatusProvider:       util.NewStatusProvider(conf.Name, conf.Name),
-		TexturePacksRequired: len(packs) > 0,
+		StatusProvider:       statusProvider,
+		TexturePacksRequired: texturePacksRequired(conf, packs),
 		ResourcePacks:        packs,
+		AcceptedProtocols:    acceptedProtocols,
+		Compression:          compressions[conf.Network.Compression],
 		FlushRate:            flushRate,
 	}); err != nil {
 		return
 	}
+	statusProvider.SetOnline(func() int { return len(proxy.Registry().GetSessions()) })
 
 	info, _ := debug.ReadBuildInfo()
 	if info == nil {
@@ -260,23 +779,120 @@ func main() {
 
 	go processCommand(proxy, conf)
 
-	go func() {
-		a := api.NewAPI(proxy.Registry(), logger, api.NewSecretBasedAuthentication(conf.APIServer.Token))
-		if err := a.Listen(conf.APIServer.BindAddr); err != nil {
-			logger.Error("Error starting API server", "err", err)
+	a := api.NewAPI(proxy.Registry(), logger, api.NewSecretBasedAuthentication(conf.APIServer.Token))
+	if err := a.Listen(conf.APIServer.BindAddr); err != nil {
+		logger.Error("Error starting API server", "err", err)
+	} else {
+		apiServer = a
+		logger.Info("Started API server", "bind-addr", conf.APIServer.BindAddr, "token", conf.APIServer.Token)
+		go serveAPI(a, logger)
+	}
+	if conf.APIServer.HTTPAddr != "" && conf.APIServer.Token == "" {
+		logger.Error("Not starting the HTTP API, api_server.token must be set to authenticate it")
+	} else if conf.APIServer.HTTPAddr != "" {
+		httpAPI := newHTTPAPI(conf, proxy, logger)
+		go func() {
+			logger.Info("Serving HTTP API", "address", httpAPI.Addr)
+			if err := httpAPI.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("HTTP API server error", "error", err)
+			}
+		}()
+	}
+
+	healthChecker = NewHealthChecker(proxy.Transport(), time.Duration(conf.HealthCheck.TimeoutSeconds)*time.Second, logger)
+	if conf.HealthCheck.ActiveIntervalSeconds > 0 {
+		run := healthChecker.RunActive
+		if conf.HealthCheck.AllServers {
+			run = healthChecker.RunAll
+		}
+		go run(context.Background(), time.Duration(conf.HealthCheck.ActiveIntervalSeconds)*time.Second, func(addr string) {
+			name, _ := serverRegistry.Name(addr)
+			events.Dispatch(EventServerDown, map[string]string{"server": name, "address": addr})
+			if _, lobby := serverRegistry.Lobby(); addr == lobby {
+				if conf.LobbyFailover.Enabled {
+					handleLobbyDown(proxy, lobby, time.Duration(conf.HealthCheck.ActiveIntervalSeconds)*time.Second, logger)
+				}
+				return
+			}
+			moveToLobby(sessionsOnServer(proxy, addr), logger)
+		})
+	}
+
+	setMaxConcurrentTransfers(conf.MaxConcurrentTransfers)
+	transferTimeout = time.Duration(conf.TransferTimeoutSeconds) * time.Second
+	recentDisconnects = NewDisconnectLog(conf.RecentDisconnects)
+	if len(conf.EventHooks.Commands) > 0 {
+		events, err = NewEventDispatcher(conf.EventHooks, logger)
+		if err != nil {
+			logger.Error("Invalid event hooks", "error", err)
 			return
 		}
-		logger.Info("Started API server", "bind-addr", conf.APIServer.BindAddr, "token", conf.APIServer.Token)
-		for {
-			_ = a.Accept()
+	}
+	sink, metricsServer, err := newMetricsSink(conf.Metrics)
+	if err != nil {
+		logger.Error("Failed to set up metrics", "error", err)
+		return
+	}
+	metricsSink = sink
+	if metricsServer != nil {
+		go func() {
+			logger.Info("Serving metrics", "address", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Metrics server error", "error", err)
+			}
+		}()
+	}
+	if conf.Locale.CatalogFile != "" {
+		messageCatalog, err = LoadMessageCatalog(conf.Locale.CatalogFile, conf.Locale.DefaultLanguage)
+		if err != nil {
+			logger.Error("Failed to load message catalog", "error", err)
+			return
 		}
-	}()
+	}
+	if len(conf.Firewall.Allow) > 0 || len(conf.Firewall.Deny) > 0 || conf.Firewall.BanFile != "" {
+		firewall, err = NewIPFilter(conf.Firewall)
+		if err != nil {
+			logger.Error("Failed to load firewall rules", "error", err)
+			return
+		}
+	}
+	RegisterPreTransferHook(permissionHook())
+	go joinQueue.Run(context.Background(), time.Second, logger)
+	if conf.SRVRefreshSeconds > 0 {
+		go refreshSRV(context.Background(), time.Duration(conf.SRVRefreshSeconds)*time.Second, logger)
+	}
+
+	if conf.TransferAnnouncement.Scope != AnnounceScopeNone {
+		announcer = newTransferAnnouncer(conf.TransferAnnouncement)
+	}
+
+	var loginLimiter *TokenBucket
+	if conf.LoginRate.PerSecond > 0 {
+		loginLimiter = NewTokenBucket(conf.LoginRate.PerSecond, conf.LoginRate.Burst)
+	}
+	if conf.SlowMode.HighWater > 0 {
+		loginSlowdown = NewSlowModeState(conf.SlowMode, logger)
+	}
+	var throttle *IPThrottle
+	if conf.ConnectionThrottle.MaxConnections > 0 {
+		throttle = NewIPThrottle(conf.ConnectionThrottle.MaxConnections, time.Duration(conf.ConnectionThrottle.WindowSeconds)*time.Second)
+	}
+	if conf.ConnectionLog.Enabled {
+		if connectionLog, err = NewConnectionLogger(conf.ConnectionLog); err != nil {
+			logger.Error("Failed to open the connection log", "error", err)
+			return
+		}
+	}
+	events.Dispatch(EventProxyStart, map[string]string{"address": conf.BindAddr})
 
 	for {
 		s, err := proxy.Accept()
 		if err != nil {
 			continue
 		}
+		// Every session uses the config in use when it was accepted, settings changed at runtime apply to
+		// sessions accepted afterwards.
+		conf := currentConfig()
 		s.SetAnimation(&animation.Fade{
 			Colour: color.RGBA{},
 			Timing: protocol.CameraFadeTimeData{
@@ -285,47 +901,190 @@ func main() {
 				FadeOutDuration: 0.23,
 			},
 		})
-		if conf.OomphEnabled {
-			go func(s *session.Session) {
-				// Disable auto-login so that Oomph's processor can modify the StartGame data to allow server-authoritative movement.
-				f, err := os.OpenFile(fmt.Sprintf("./logs/%s.log", s.Client().IdentityData().DisplayName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0744)
-				if err != nil {
-					s.Disconnect("failed to create log file")
+		acceptedAt := time.Now()
+		sessionID := newSessionID()
+		if err := connectionLog.Record(newConnectionRecord(s.Client(), sessionID, acceptedAt)); err != nil {
+			logger.Error("Failed to write to the connection log", "session", sessionID, "error", err)
+		}
+		if draining.Load() {
+			logger.Info("Rejected session, the proxy is draining", "session", sessionID)
+			s.Disconnect(localize(s, "draining", conf.Drain.JoinMessage))
+			continue
+		}
+		if bans != nil {
+			identity := s.Client().IdentityData()
+			ban, banned, err := bans.Lookup(identity.XUID, identity.DisplayName, acceptedAt)
+			if err != nil {
+				logger.Error("Failed to save bans after removing expired bans", "error", err)
+			}
+			if banned {
+				logger.Info("Rejected session, the player is banned", "session", sessionID, "xuid", identity.XUID)
+				s.Disconnect(banMessage(s, conf.Bans, ban, acceptedAt))
+				continue
+			}
+		}
+		if conf.Whitelist.Enabled && !whitelisted(s) {
+			logger.Info("Rejected session, not whitelisted", "session", sessionID)
+			s.Disconnect(localize(s, "not_whitelisted", conf.Whitelist.Message))
+			continue
+		}
+		if maintenance.Enabled() && !maintenance.Allowed(s) {
+			logger.Info("Rejected session, maintenance mode is on", "session", sessionID)
+			s.Disconnect(localize(s, "maintenance", conf.Maintenance.Message))
+			continue
+		}
+		if !supportedProtocol(s.Client()) {
+			logger.Info("Rejected session on an unsupported version", "session", sessionID, "protocol", s.Client().Proto().ID(), "version", s.Client().ClientData().GameVersion)
+			rejectedVersions.Record(s.Client().Proto().ID(), s.Client().ClientData().GameVersion, acceptedAt)
+			s.Disconnect(localize(s, "unsupported_version", conf.UnsupportedVersion.Message, "{client}", s.Client().ClientData().GameVersion, "{required}", protocol.CurrentVersion))
+			continue
+		}
+		if firewall != nil && !firewall.Allowed(addrIP(s.Client().RemoteAddr())) {
+			logger.Info("Rejected session by firewall", "session", sessionID, "address", s.Client().RemoteAddr())
+			s.Disconnect(localize(s, "firewall_blocked", conf.Firewall.Message))
+			continue
+		}
+		if throttle != nil {
+			if cooldown, ok := throttle.Allow(addrIP(s.Client().RemoteAddr()).String(), acceptedAt); !ok {
+				logger.Info("Rejected session by connection throttle", "session", sessionID, "address", s.Client().RemoteAddr(), "cooldown", cooldown)
+				s.Disconnect(localize(s, "connection_throttled", conf.ConnectionThrottle.Message, "{cooldown}", cooldownSeconds(cooldown)))
+				continue
+			}
+		}
+		safeName, nameErr := applyNamePolicy(conf.DisplayNames.Policy, s.Client().IdentityData().DisplayName)
+		if nameErr != nil {
+			logger.Info("Rejected session", "session", sessionID, "player", sanitizeName(s.Client().IdentityData().DisplayName), "reason", nameErr)
+			s.Disconnect(localize(s, "name_rejected", conf.DisplayNames.RejectMessage))
+			continue
+		}
+		if !admitPlayer(conf, s) {
+			logger.Info("Rejected session, the proxy is full", "session", sessionID)
+			s.Disconnect(localize(s, "proxy_full", conf.JoinFull.ProxyFullMessage))
+			continue
+		}
+		sessionLog := logger.With("session", sessionID, "player", safeName)
+		sessionLog.Debug("Accepted session")
+		logCompression(sessionLog, conf.Network, s.Client().Proto().ID())
+		transferProc := &TransferProcessor{s: s, conf: conf, registry: proxy.Registry(), log: sessionLog, accepted: acceptedAt}
+		var sessionProc session.Processor = transferProc
+		if conf.PlayerCommands.Enabled {
+			sessionProc = NewProcessorChain(NewPlayerCommandProcessor(s, conf, sessionLog), sessionProc)
+		}
+		if conf.ChatRate.PerSecond > 0 {
+			sessionProc = NewProcessorChain(NewChatLimitProcessor(s, conf.ChatRate), sessionProc)
+		}
+		go func(s *session.Session) {
+			if loginLimiter != nil {
+				wait, ok := loginLimiter.Reserve(time.Duration(conf.LoginRate.MaxWaitSeconds) * time.Second)
+				if !ok {
+					sessionLog.Info("Rejected session due to login rate limit")
+					s.Disconnect(localize(s, "login_rate", conf.LoginRate.Message))
 					return
 				}
-				playerLogHandler := slog.NewTextHandler(f, &slog.HandlerOptions{
-					Level: slog.LevelDebug,
-				})
-				playerLog := slog.New(playerLogHandler)
-				proc := oomph.NewProcessor(s, proxy.Registry(), proxy.Listener(), playerLog)
-				proc.Player().SetCloser(func() {
-					f.Close()
-				})
-				proc.Player().SetRecoverFunc(func(p *player.Player, err any) {
-					logger.Error("Error during processing player packet", "player", p.Name(), "err", err)
-					debug.PrintStack()
-				})
-				proc.Player().AddPerm(player.PermissionDebug)
-				proc.Player().AddPerm(player.PermissionAlerts)
-				proc.Player().AddPerm(player.PermissionLogs)
-				proc.Player().HandleEvents(player.NewExampleEventHandler())
-				s.SetProcessor(proc)
-
-				if err := s.LoginTimeout(10 * time.Second); err != nil {
+				if wait > 0 {
+					sessionLog.Debug("Delaying login due to login rate limit", "wait", wait)
+					time.Sleep(wait)
+				}
+			}
+
+			if wait := loginSlowdown.Delay(); wait > 0 {
+				sessionLog.Debug("Delaying login due to slow mode", "wait", wait)
+				time.Sleep(wait)
+			}
+
+			if message, ok := checkJoinCapacity(conf, s, sessionLog); !ok {
+				s.Disconnect(message)
+				return
+			}
+
+			if !conf.OomphEnabled {
+				setProcessor(s, sessionProc)
+				if err := s.Login(); err != nil {
 					s.Disconnect(err.Error())
-					f.Close()
 					if !errors.Is(err, context.Canceled) {
-						logger.Error("failed to login session", "err", err)
+						sessionLog.Error("failed to login session", "err", err)
 					}
 					return
 				}
+				transferProc.joined.Store(true)
+				joinStats.Record(time.Since(acceptedAt))
+				metricsSink.SetGauge(metricPlayers, float64(len(proxy.Registry().GetSessions())))
+				sendConnectMessage(s)
+				events.Dispatch(EventPlayerJoin, playerEventData(s))
+				publishJoin(s)
+				return
+			}
 
-				proc.Player().SetServerConn(s.Server())
-			}(s)
-		}
+			// Oomph's processor has to be set before logging in so that it can modify the StartGame data to allow server-authoritative movement.
+			f, err := os.OpenFile(fmt.Sprintf("./logs/%s.log", safeName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0744)
+			if err != nil {
+				s.Disconnect("failed to create log file")
+				return
+			}
+			playerLogHandler := slog.NewTextHandler(f, &slog.HandlerOptions{
+				Level: slog.LevelDebug,
+			})
+			playerLog := slog.New(playerLogHandler).With("session", sessionID)
+			proc := oomph.NewProcessor(s, proxy.Registry(), proxy.Listener(), playerLog)
+			proc.Player().SetCloser(func() {
+				f.Close()
+			})
+			proc.Player().SetRecoverFunc(func(p *player.Player, err any) {
+				sessionLog.Error("Error during processing player packet", "err", err)
+				debug.PrintStack()
+			})
+			proc.Player().AddPerm(player.PermissionDebug)
+			proc.Player().AddPerm(player.PermissionAlerts)
+			proc.Player().AddPerm(player.PermissionLogs)
+			proc.Player().HandleEvents(player.NewExampleEventHandler())
+			setProcessor(s, NewProcessorChain(proc, sessionProc))
+
+			if err := s.LoginTimeout(10 * time.Second); err != nil {
+				s.Disconnect(err.Error())
+				f.Close()
+				if !errors.Is(err, context.Canceled) {
+					sessionLog.Error("failed to login session", "err", err)
+				}
+				return
+			}
+
+			transferProc.joined.Store(true)
+			proc.Player().SetServerConn(s.Server())
+			joinStats.Record(time.Since(acceptedAt))
+			metricsSink.SetGauge(metricPlayers, float64(len(proxy.Registry().GetSessions())))
+			sendConnectMessage(s)
+			events.Dispatch(EventPlayerJoin, playerEventData(s))
+			publishJoin(s)
+		}(s)
 	}
 }
 
+// proxyOpts returns the options of the proxy for the configuration.
+func proxyOpts(conf *ServerConfig, clientDecode []uint32) *util.Opts {
+	return &util.Opts{
+		ShutdownMessage: conf.ShutdownMessage,
+		Addr:            conf.BindAddr,
+		// Sessions are logged in by the accept loop so that logins can be gated before reaching a backend.
+		AutoLogin:       false,
+		LatencyInterval: conf.Network.LatencyIntervalMillis,
+		ClientDecode:    clientDecode,
+		SyncProtocol:    false,
+	}
+}
+
+// texturePacksRequired reports if clients must accept the resource packs to join. Players declining optional
+// packs join without them, while the client refuses to join if it declines required packs.
+func texturePacksRequired(conf *ServerConfig, packs []*resource.Pack) bool {
+	return len(packs) > 0 && !conf.OptionalPacks
+}
+
+// newSessionID returns a short random ID used to correlate the log entries of a single session.
+func newSessionID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 // isInContainer returns if the application is running in the container.
 func isInContainer() bool {
 	file, err := os.Open("/proc/1/cgroup")
@@ -363,19 +1122,28 @@ func processCommand(proxy *spectrum.Spectrum, conf *ServerConfig) {
 	}
 	c := NewCompleter(proxy)
 
-	historyFile, err := NewHistoryFile("command_history.txt", 100)
+	historyFile, err := NewHistoryFile("command_history.txt", 100, conf.History.DedupAll, conf.History.Dir)
 	if err != nil {
 		logger.Error("Failed to initialize command history", "error", err)
+	} else {
+		commandHistory = historyFile
 	}
 
 	executor := func(in string) {
 		if in = strings.TrimSpace(in); in != "" {
-			if historyFile != nil {
-				if err := historyFile.Append(in); err != nil {
-					logger.Error("Failed to save command to history", "error", err)
+			if index, ok := strings.CutPrefix(in, "!"); ok {
+				entry, ok := historyEntry(index)
+				if !ok {
+					logger.Info(fmt.Sprintf("No history entry !%s, run 'history' to list the entries", index))
+					return
 				}
+				in = entry
+				logger.Info(fmt.Sprintf("> %s", in))
 			}
-			handleCommand(in, proxy, conf)
+			if historyFile != nil {
+				historyFile.Append(in)
+			}
+			handleCommand(in, proxy)
 		}
 	}
 
@@ -394,12 +1162,7 @@ func processCommand(proxy *spectrum.Spectrum, conf *ServerConfig) {
 			Fn: func(_ *prompt.Prompt) bool {
 				// Handle Ctrl+C to exit gracefully
 				logger.Info("Exiting Spectrum Proxy Console...")
-				if historyFile != nil {
-					if err := historyFile.Save(); err != nil {
-						logger.Error("Failed to save command history on exit", "error", err)
-					}
-				}
-				proxy.Close()
+				shutdownProxy(proxy)
 				os.Exit(0)
 				return false
 			},
@@ -418,121 +1181,111 @@ func processCommand(proxy *spectrum.Spectrum, conf *ServerConfig) {
 	p.Run()
 }
 
+// handleTermination drains the proxy when it is interrupted and exits once it stopped. A second interrupt
+// while draining stops the proxy right away.
 func handleTermination(proxy *spectrum.Spectrum) {
 	go func() {
 		var interrupt = make(chan os.Signal, 1)
 		signal.Notify(interrupt, os.Interrupt)
 		<-interrupt
-		for _, s := range proxy.Registry().GetSessions() {
-			s.Server().WritePacket(&packet.Disconnect{})
-			s.Disconnect("Proxy restarting...")
+		logger := slog.Default()
+		go func() {
+			<-interrupt
+			logger.Info("Interrupted again, stopping right away")
+			shutdownProxy(proxy)
+			os.Exit(0)
+		}()
+		conf := currentConfig()
+		if !drainProxy(proxy, conf, conf.Drain.Seconds, logger) {
+			shutdownProxy(proxy)
 		}
 		time.Sleep(time.Second)
 		os.Exit(0)
 	}()
 }
 
-// handleCommand processes the input command
-func handleCommand(command string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+// proxyClosing is set once the proxy started shutting down. Commands are ignored from then on, since the
+// listener and sessions are being torn down.
+var proxyClosing atomic.Bool
+
+// proxyUnavailable reports if the proxy is shutting down or its session registry is gone.
+func proxyUnavailable(proxy *spectrum.Spectrum) bool {
+	return proxyClosing.Load() || proxy == nil || proxy.Registry() == nil
+}
+
+// handleCommand processes the input command with the config currently in use.
+func handleCommand(command string, proxy *spectrum.Spectrum) {
 	args := strings.Fields(command)
 	if len(args) == 0 {
 		return
 	}
+	conf := currentConfig()
 
 	logger := slog.Default()
+	if proxyUnavailable(proxy) {
+		logger.Info("The proxy is shutting down, ignoring command")
+		return
+	}
+	args, err := expandAlias(conf.Aliases, args)
+	if err != nil {
+		logger.Error("Invalid command alias", "error", err)
+		return
+	}
 
-	switch args[0] {
-	case "players":
-		sessions := proxy.Registry().GetSessions()
-		if len(sessions) == 0 {
-			logger.Info("No players online")
-			return
-		}
-
-		logger.Info(fmt.Sprintf("Players online (%d)", len(sessions)))
-		for _, s := range sessions {
-			playerName := s.Client().IdentityData().DisplayName
-			logger.Info(fmt.Sprintf("- %s", playerName))
-		}
-
-	case "transfer":
-		if len(args) < 3 {
-			logger.Info("Usage: transfer <player> <server>")
-			return
-		}
-
-		playerName := args[1]
-		serverName := args[2]
-
-		var targetSession *session.Session
-		for _, s := range proxy.Registry().GetSessions() {
-			if s.Client().IdentityData().DisplayName == playerName {
-				targetSession = s
-				break
-			}
-		}
-
-		if targetSession == nil {
-			logger.Info(fmt.Sprintf("Player '%s' not found", playerName))
-			return
-		}
-
-		var serverAddr string
-		for name, addr := range serverMap {
-			if name == serverName {
-				serverAddr = addr
-				break
-			}
-		}
-
-		if serverAddr == "" {
-			logger.Info(fmt.Sprintf("Server '%s' not found", serverName))
-			return
-		}
+	cmd, ok := consoleCommands.Lookup(args[0])
+	if !ok {
+		logger.Info(fmt.Sprintf("Unknown command: %s", args[0]))
+		logger.Info("Run 'help' to list the available commands")
+		return
+	}
+	cmd.Execute(args[1:], proxy, conf)
+}
 
-		err := targetSession.TransferTimeout(serverAddr, 10*time.Second)
+// readConfig reads the configuration from the config file or creates a default one if it doesn't exist.
+// If the file can't be parsed and regenerateBroken is true, the broken file is moved to <file>.bak and
+// replaced with the default configuration instead of failing.
+func readConfig(regenerateBroken bool) (*ServerConfig, error) {
+	conf := defaultConfig()
+	if _, err := os.Stat(configFile); err == nil {
+		data, err := os.ReadFile(configFile)
 		if err != nil {
-			logger.Error("Failed to transfer player", "player", playerName, "server", serverName, "error", err)
-			return
-		}
-
-		logger.Info(fmt.Sprintf("Transferred %s to %s", playerName, serverName))
-
-	case "info":
-		logger.Info("Spectrum Proxy Information")
-		logger.Info(fmt.Sprintf("- Bind Address: %s", proxy.Opts().Addr))
-		logger.Info(fmt.Sprintf("- Default Server: %s", conf.DefaultServer))
-		logger.Info(fmt.Sprintf("- Connected Players: %d", len(proxy.Registry().GetSessions())))
-		logger.Info("Available Servers:")
-
-		for addr, name := range serverMap {
-			logger.Info(fmt.Sprintf("- %s (%s)", name, addr))
+			return nil, err
 		}
-		logger.Info(fmt.Sprintf("Goroutines: %d", runtime.NumGoroutine()))
-		logger.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
-		var memStats runtime.MemStats
-		runtime.ReadMemStats(&memStats)
-		logger.Info(fmt.Sprintf("Total Allocated Memory: %.2f MB", float64(memStats.TotalAlloc)/1024/1024))
-
-	case "stop", "end":
-		if resourcePackServer != nil {
-			if err := resourcePackServer.Close(); err != nil {
-				logger.Error("Failed to close resource pack HTTP server", "error", err)
+		if err := toml.Unmarshal(data, conf); err != nil {
+			if !regenerateBroken {
+				return nil, err
 			}
+			return regenerateConfig(err)
 		}
-		proxy.Close()
-		logger.Info("Stopped proxy")
-		os.Exit(0)
+		return conf, nil
+	}
+	if err := writeConfig(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
 
-	default:
-		logger.Info(fmt.Sprintf("Unknown command: %s", args[0]))
-		logger.Info("Available commands: players, transfer, info")
+// regenerateConfig backs up the unparsable config file to <file>.bak and writes the default
+// configuration in its place.
+func regenerateConfig(parseErr error) (*ServerConfig, error) {
+	backup := configFile + ".bak"
+	if err := os.Rename(configFile, backup); err != nil {
+		return nil, fmt.Errorf("back up broken config: %w", err)
+	}
+	logger := slog.Default()
+	logger.Error(fmt.Sprintf("Failed to parse %s, it was moved to %s", configFile, backup), "error", parseErr)
+	logger.Error(fmt.Sprintf("The proxy is starting with the DEFAULT configuration, fix %s and restore it", backup))
+
+	conf := defaultConfig()
+	if err := writeConfig(conf); err != nil {
+		return nil, err
 	}
+	return conf, nil
 }
 
-// readConfig reads the configuration from config.toml or creates a default one if it doesn't exist.
-func readConfig() (*ServerConfig, error) {
-	conf := &ServerConfig{
+// defaultConfig returns the default configuration.
+func defaultConfig() *ServerConfig {
+	return &ServerConfig{
 		Name:          "Spectrum Proxy",
 		BindAddr:      "0.0.0.0:19132",
 		DefaultServer: "lobby",
@@ -546,40 +1299,214 @@ func readConfig() (*ServerConfig, error) {
 				Addr: "127.0.0.1:19134",
 			},
 		},
-		ShutdownMessage: "Proxy shutdown",
+		SRVRefreshSeconds: 60,
+		ShutdownMessage:   "Proxy shutdown",
 		CdnConfig: CdnConfig{
-			Enabled: false,
-			Ip:      "0.0.0.0",
-			Port:    8080,
+			Enabled:          false,
+			Ip:               "0.0.0.0",
+			Port:             8080,
+			SelfTest:         true,
+			TLSCert:          "",
+			TLSKey:           "",
+			AutoCertCacheDir: "autocert",
+			ExternalURLs:     map[string]string{},
 		},
 		OomphEnabled: false,
+		Oomph: OomphSettings{
+			CorrectionThreshold:           0.003,
+			PersuasionThreshold:           0.002,
+			AcceptClientPosition:          false,
+			PositionAcceptanceThreshold:   0.003,
+			AcceptClientVelocity:          false,
+			VelocityAcceptanceThreshold:   0.077,
+			MaximumAttackAngle:            90,
+			EnableClientEntityTracking:    true,
+			GlobalMovementCutoffThreshold: -1,
+			MaxEntityRewind:               6,
+			MaxGhostBlockChain:            7,
+			MaxKnockbackDelay:             -1,
+			MaxBlockUpdateDelay:           -1,
+		},
 		APIServer: APIServer{
 			BindAddr: "127.0.0.1:19132",
 			Token:    "",
+			HTTPAddr: "",
+		},
+		LoginRate: LoginRate{
+			PerSecond:      0,
+			Burst:          10,
+			MaxWaitSeconds: 5,
+			Message:        "Server is busy, please try again in a moment.",
+		},
+		HealthCheck: HealthCheck{
+			ActiveIntervalSeconds: 0,
+			TimeoutSeconds:        3,
+			AllServers:            false,
+			DownMessage:           "{server} is currently offline, please try again later.",
+		},
+		PackLimits: PackLimits{
+			MaxCount:       0,
+			MaxTotalSizeMB: 0,
+			Strict:         false,
+		},
+		TransferAnnouncement: TransferAnnouncement{
+			Scope:     AnnounceScopeNone,
+			Template:  "§e{player} joined {server}",
+			PerSecond: 1,
+			Burst:     5,
+		},
+		TransferMetadata: TransferMetadataConfig{
+			Enabled:    false,
+			Identifier: "spectrum-proxy:transfer",
+			Tags:       map[string]string{},
+		},
+		MaxConcurrentTransfers: 16,
+		TransferTimeoutSeconds: 10,
+		DisplayNames: DisplayNames{
+			Policy:        NamePolicyPass,
+			RejectMessage: "Your name contains characters that are not allowed on this server.",
+		},
+		PackRefreshMessage: "§eResource packs were updated, reconnect to get the latest content.",
+		ServerGroups:       map[string][]string{},
+		SubName:            "",
+		MaxPlayers:         0,
+		Motd: Motd{
+			Text:          "",
+			SubTitles:     []string{},
+			RotateSeconds: 5,
+		},
+		JoinFull: JoinFull{
+			ProxyFullMessage: "The server is full, please try again later.",
+			LobbyFullMessage: "The lobby is full, please try again later.",
+			WaitForLobby:     false,
+			MaxWaitSeconds:   30,
+		},
+		ChatRate: ChatRate{
+			PerSecond: 0,
+			Burst:     5,
+			Message:   "§cYou are sending messages too fast.",
+		},
+		OptionalPacks: false,
+		TransferFailure: TransferFailure{
+			Message:          "§cCould not connect you to that server, please try again later.",
+			Fallback:         true,
+			Attempts:         3,
+			RetryDelayMillis: 500,
+		},
+		TransferCooldown: TransferCooldown{
+			Millis:  1000,
+			Message: "",
+		},
+		PlayerCommands: PlayerCommands{
+			Enabled: false,
+			Prefix:  "#",
 		},
+		RecentDisconnects: 50,
+		Firewall: Firewall{
+			Allow:   []string{},
+			Deny:    []string{},
+			BanFile: "ipbans.txt",
+			Message: "You are not allowed to connect to this server.",
+		},
+		Locale: Locale{
+			CatalogFile:     "",
+			DefaultLanguage: "en_US",
+		},
+		ReconnectGraceSeconds: 0,
+		Metrics: Metrics{
+			Sink: MetricsSinkNone,
+			Addr: "127.0.0.1:9100",
+		},
+		LobbyFailover: LobbyFailover{
+			Enabled:    false,
+			Fallback:   "",
+			HoldLogins: false,
+			Message:    "The lobby is restarting, please try again in a moment.",
+		},
+		ConnectionThrottle: ConnectionThrottle{
+			MaxConnections: 0,
+			WindowSeconds:  10,
+			Message:        "You are connecting too fast, please try again in {cooldown} seconds.",
+		},
+		UnsupportedVersion: UnsupportedVersion{
+			Enabled: false,
+			Message: "Please use Minecraft {required} to join, you are on {client}.",
+		},
+		Drain: Drain{
+			Seconds:     30,
+			Message:     "§eThe proxy is restarting in {seconds} seconds.",
+			JoinMessage: "The proxy is restarting, please try again in a moment.",
+			Fallback:    "",
+		},
+		Network: Network{
+			ClientFlushMillis:     0,
+			LatencyIntervalMillis: 1000,
+			Compression:           "flate",
+		},
+		SlowMode: SlowMode{
+			HighWater:   0,
+			LowWater:    0,
+			DelayMillis: 2000,
+		},
+		EventHooks: EventHooks{
+			Commands:       map[string][]string{},
+			TimeoutSeconds: 10,
+		},
+		ContentKeys: map[string]string{},
+		ConnectionLog: ConnectionLog{
+			Enabled:   false,
+			File:      "logs/connections.log",
+			MaxSizeMB: 10,
+			MaxFiles:  5,
+		},
+		Observers: Observers{
+			XUIDs: []string{},
+		},
+		Maintenance: Maintenance{
+			Enabled:   false,
+			Whitelist: []string{},
+			Message:   "The server is under maintenance, please try again later.",
+			Motd:      "§cMaintenance",
+		},
+		Whitelist: WhitelistConfig{
+			Enabled: false,
+			File:    "whitelist.json",
+			Message: "You are not whitelisted on this server.",
+		},
+		Bans: BansConfig{
+			File:    "bans.json",
+			Message: "You are banned from this server.\nReason: {reason}\nExpires in: {expires}",
+		},
+		GeoIP: GeoIP{
+			Database: "",
+			Lobbies:  map[string]string{},
+		},
+		History: History{
+			DedupAll: false,
+			Dir:      "",
+		},
+		Aliases: map[string]string{},
 	}
-	if _, err := os.Stat("config.toml"); err == nil {
-		data, err := os.ReadFile("config.toml")
-		if err != nil {
-			return nil, err
-		}
-		if err := toml.Unmarshal(data, conf); err != nil {
-			return nil, err
-		}
-		return conf, nil
+}
+
+// writeConfig writes the given configuration to the config file. It returns errLayeredConfig if layered
+// config files are used.
+func writeConfig(conf *ServerConfig) error {
+	if len(configPaths) > 1 {
+		return errLayeredConfig
 	}
-	b, err := toml.Marshal(conf)
+	c := *conf
+	c.Servers = configServers(conf.Servers)
+	b, err := toml.Marshal(&c)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if err := os.WriteFile("config.toml", b, 0644); err != nil {
-		return nil, err
-	}
-	return conf, nil
+	return os.WriteFile(configFile, b, 0644)
 }
 
 // parse reads resource packs from the "resource_packs" directory and applies content keys if provided.
-func parse(keys map[string]string, logger *slog.Logger) ([]*resource.Pack, error) {
+// Packs are read in file name order and the given limits are applied.
+func parse(keys map[string]string, limits PackLimits, logger *slog.Logger) ([]*resource.Pack, error) {
 	wd, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -598,17 +1525,48 @@ func parse(keys map[string]string, logger *slog.Logger) ([]*resource.Pack, error
 	}
 
 	var packs []*resource.Pack
+	var totalSize int64
+	maxTotalSize := int64(limits.MaxTotalSizeMB) * 1024 * 1024
 	for _, entry := range entries {
-		pack, err := resource.ReadPath(path.Join(dir, entry.Name()))
+		if limits.MaxCount > 0 && len(packs) >= limits.MaxCount {
+			if limits.Strict {
+				return nil, fmt.Errorf("more than %d resource packs found", limits.MaxCount)
+			}
+			logger.Error("Resource pack count limit reached, skipping remaining packs", "limit", limits.MaxCount, "skipped", len(entries)-len(packs))
+			break
+		}
+
+		packPath := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if _, err := os.Stat(path.Join(packPath, "manifest.json")); err != nil {
+				logger.Error(fmt.Sprintf("Missing manifest in %s, skipping pack", entry.Name()), "err", err)
+				continue
+			}
+		}
+		pack, err := resource.ReadPath(packPath)
 		if err != nil {
+			if entry.IsDir() {
+				// Unzipped packs with a broken manifest are a common mistake, don't refuse to start over them.
+				logger.Error(fmt.Sprintf("Invalid manifest in %s, skipping pack", entry.Name()), "err", err)
+				continue
+			}
 			return nil, err
 		}
 
+		if maxTotalSize > 0 && totalSize+int64(pack.Len()) > maxTotalSize {
+			if limits.Strict {
+				return nil, fmt.Errorf("resource packs exceed the total size limit of %dMB", limits.MaxTotalSizeMB)
+			}
+			logger.Error("Resource pack size limit reached, skipping pack", "name", pack.Name(), "limit", fmt.Sprintf("%dMB", limits.MaxTotalSizeMB))
+			continue
+		}
+		totalSize += int64(pack.Len())
+
 		if key, ok := keys[pack.UUID().String()]; ok {
 			pack = pack.WithContentKey(key)
 		}
 		sizeInMB := float64(pack.Len()) / (1024 * 1024)
-		logger.Debug("Loaded pack", "name", pack.Name(), "size", fmt.Sprintf("%.2fMB", sizeInMB), "uuid", pack.UUID(), "version", pack.Version())
+		logger.Debug("Loaded pack", "name", pack.Name(), "size", fmt.Sprintf("%.2fMB", sizeInMB), "uuid", pack.UUID(), "version", pack.Version(), "encrypted", pack.Encrypted())
 		packs = append(packs, pack)
 	}
 	return packs, nil
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/cooldogedev/spectrum/transport"
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+// writeTestPack writes an unzipped resource pack named name to the resource_packs directory in dir. The
+// pack holds size bytes of incompressible content, so that its zipped size is about size.
+func writeTestPack(t *testing.T, dir, name string, size int) {
+	t.Helper()
+	packDir := filepath.Join(dir, "resource_packs", name)
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	r := rand.New(rand.NewPCG(h.Sum64(), uint64(size)))
+	manifest := fmt.Sprintf(`{
+	"format_version": 2,
+	"header": {"name": %q, "description": "", "uuid": %q, "version": [1, 0, 0], "min_engine_version": [1, 20, 0]},
+	"modules": [{"type": "resources", "uuid": %q, "version": [1, 0, 0]}]
+}`, name, testUUID(r), testUUID(r))
+	if err := os.WriteFile(filepath.Join(packDir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(r.Uint32())
+	}
+	if err := os.WriteFile(filepath.Join(packDir, "content.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testUUID returns a random UUID drawn from r.
+func testUUID(r *rand.Rand) string {
+	return fmt.Sprintf("%08x-%04x-4%03x-8%03x-%012x", r.Uint32(), r.Uint32()&0xffff, r.Uint32()&0xfff, r.Uint32()&0xfff, r.Uint64()&0xffffffffffff)
+}
+
+func TestParsePackLimits(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name    string
+		sizes   []int
+		limits  PackLimits
+		want    []string
+		wantErr bool
+	}{
+		{name: "no limits", sizes: []int{1000, 1000, 1000}, want: []string{"pack0", "pack1", "pack2"}},
+		{name: "within the count", sizes: []int{1000, 1000}, limits: PackLimits{MaxCount: 2}, want: []string{"pack0", "pack1"}},
+		{name: "count exceeded", sizes: []int{1000, 1000, 1000}, limits: PackLimits{MaxCount: 2}, want: []string{"pack0", "pack1"}},
+		{name: "count exceeded strict", sizes: []int{1000, 1000, 1000}, limits: PackLimits{MaxCount: 2, Strict: true}, wantErr: true},
+		{name: "size exceeded", sizes: []int{mb * 6 / 10, mb * 6 / 10, mb / 10}, limits: PackLimits{MaxTotalSizeMB: 1}, want: []string{"pack0", "pack2"}},
+		{name: "size exceeded strict", sizes: []int{mb * 6 / 10, mb * 6 / 10}, limits: PackLimits{MaxTotalSizeMB: 1, Strict: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i, size := range tt.sizes {
+				writeTestPack(t, dir, fmt.Sprintf("pack%d", i), size)
+			}
+			t.Chdir(dir)
+
+			packs, err := parse(nil, tt.limits, slog.New(slog.DiscardHandler))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parse loaded %d pack(s), want an error", len(packs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, pack := range packs {
+				names = append(names, pack.Name())
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Fatalf("parse loaded %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferCooldown(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		millis   int
+		requests []time.Duration
+		want     []bool
+	}{
+		{name: "disabled", millis: 0, requests: []time.Duration{0, 0, time.Millisecond}, want: []bool{false, false, false}},
+		{name: "first transfer", millis: 1000, requests: []time.Duration{0}, want: []bool{false}},
+		{name: "within the cooldown", millis: 1000, requests: []time.Duration{0, 999 * time.Millisecond}, want: []bool{false, true}},
+		{name: "after the cooldown", millis: 1000, requests: []time.Duration{0, time.Second}, want: []bool{false, false}},
+		{
+			name:     "rejected transfers don't extend the cooldown",
+			millis:   1000,
+			requests: []time.Duration{0, 500 * time.Millisecond, 900 * time.Millisecond, 1100 * time.Millisecond, 1500 * time.Millisecond},
+			want:     []bool{false, true, true, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &TransferProcessor{conf: &ServerConfig{TransferCooldown: TransferCooldown{Millis: tt.millis}}}
+			for i, offset := range tt.requests {
+				if got := p.transferCooldown(start.Add(offset)); got != tt.want[i] {
+					t.Fatalf("request %d at +%s: transferCooldown() = %v, want %v", i, offset, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// newTestSession connects a client with the given XUID and name to an in-process listener and returns the
+// session of the connection on the proxy side, which dials servers over transport, and the client side of
+// the connection. The client is Xbox Live authenticated if xuid is not empty.
+func newTestSession(t *testing.T, xuid, name string, transport transport.Transport) (*session.Session, *minecraft.Conn) {
+	t.Helper()
+	l, err := minecraft.ListenConfig{AuthenticationDisabled: true, ErrorLog: slog.New(slog.DiscardHandler)}.Listen("raknet", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	clients := make(chan *minecraft.Conn, 1)
+	go func() {
+		dialer := minecraft.Dialer{IdentityData: login.IdentityData{XUID: xuid, DisplayName: name}, KeepXBLIdentityData: true, ErrorLog: slog.New(slog.DiscardHandler)}
+		client, err := dialer.Dial("raknet", l.Addr().String())
+		if err != nil {
+			t.Error(err)
+		}
+		clients <- client
+	}()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := c.(*minecraft.Conn)
+	if err := conn.StartGame(minecraft.GameData{}); err != nil {
+		t.Fatal(err)
+	}
+	client := <-clients
+	if client == nil {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	s := session.NewSession(conn, slog.New(slog.DiscardHandler), session.NewRegistry(), LobbyDiscovery{}, util.Opts{}, transport)
+	t.Cleanup(func() { _ = s.Close() })
+	return s, client
+}
+
+// nextMessage reads the packets sent to client until it receives a chat message or is disconnected, and
+// returns the message and whether it is the disconnect message. It fails the test if neither happens within
+// a few seconds.
+func nextMessage(t *testing.T, client *minecraft.Conn) (message string, disconnected bool) {
+	t.Helper()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		pk, err := client.ReadPacket()
+		if err != nil {
+			// The connection closed by a Disconnect packet fails reads with an error whose cause is a
+			// net.OpError with the disconnect message as its operation.
+			var readErr, cause *net.OpError
+			if errors.As(err, &readErr) && errors.As(readErr.Err, &cause) && errors.Is(cause.Err, net.ErrClosed) {
+				return cause.Op, true
+			}
+			t.Fatalf("read packet: %v", err)
+		}
+		if text, ok := pk.(*packet.Text); ok {
+			return text.Message, false
+		}
+	}
+}
+
+// completePendingTransfer waits until the transfer of s to addr was started and completes it as if the
+// player spawned on the server.
+func completePendingTransfer(t *testing.T, s *session.Session, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pendingTransfersMu.Lock()
+		pending, ok := pendingTransfers[s]
+		started := ok && pending.addr == addr && pending.started
+		pendingTransfersMu.Unlock()
+		if started {
+			completeTransfer(s, addr, nil)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no transfer to %s was started", addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleTransferFailure(t *testing.T) {
+	const lobby, island = "127.0.0.1:19133", "127.0.0.1:19134"
+	tests := []struct {
+		name       string
+		fallback   bool
+		lobbyDown  bool
+		wantDials  []string
+		wantKicked bool
+	}{
+		{name: "disconnect", wantDials: []string{island}, wantKicked: true},
+		{name: "fallback to the lobby", fallback: true, wantDials: []string{island, lobby}},
+		{name: "fallback fails", fallback: true, lobbyDown: true, wantDials: []string{island, lobby}, wantKicked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: lobby}, Server{Name: "island", Addr: island})
+			transport := &fakeTransport{}
+			transport.setDown(island, true)
+			transport.setDown(lobby, tt.lobbyDown)
+			s, client := newTestSession(t, "1", "Steve", transport)
+			p := &TransferProcessor{
+				s:        s,
+				conf:     &ServerConfig{TransferFailure: TransferFailure{Message: "island is unavailable", Fallback: tt.fallback}},
+				registry: session.NewRegistry(),
+				log:      slog.New(slog.DiscardHandler),
+			}
+			s.SetProcessor(p)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				p.transferWithRetries("island", island)
+			}()
+			if tt.fallback && !tt.lobbyDown {
+				completePendingTransfer(t, s, lobby)
+			}
+			message, kicked := nextMessage(t, client)
+			<-done
+
+			if message != "island is unavailable" || kicked != tt.wantKicked {
+				t.Errorf("player got %q (disconnected %v), want the failure message (disconnected %v)", message, kicked, tt.wantKicked)
+			}
+			if got := transport.dialed(); !slices.Equal(got, tt.wantDials) {
+				t.Errorf("dialed %v, want %v", got, tt.wantDials)
+			}
+		})
+	}
+}
+
+func TestReadConfigBroken(t *testing.T) {
+	const broken = "name = \"unterminated\n"
+	tests := []struct {
+		name       string
+		regenerate bool
+	}{
+		{name: "fail fast"},
+		{name: "back up and regenerate", regenerate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if err := os.WriteFile(configFile, []byte(broken), 0644); err != nil {
+				t.Fatal(err)
+			}
+			logs := captureLogs(t)
+
+			conf, err := readConfig(tt.regenerate)
+			if !tt.regenerate {
+				if err == nil {
+					t.Fatal("readConfig succeeded with a broken config")
+				}
+				if data, _ := os.ReadFile(configFile); string(data) != broken {
+					t.Errorf("the broken config was changed to %q", data)
+				}
+				if _, err := os.Stat(configFile + ".bak"); !os.IsNotExist(err) {
+					t.Error("the broken config was backed up without regenerating it")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backup, _ := os.ReadFile(configFile + ".bak"); string(backup) != broken {
+				t.Errorf("backup holds %q, want the broken config", backup)
+			}
+			regenerated, err := readConfig(false)
+			if err != nil {
+				t.Fatalf("the regenerated config can't be read: %v", err)
+			}
+			if !reflect.DeepEqual(conf, defaultConfig()) {
+				t.Error("readConfig didn't return the default configuration")
+			}
+			sameServer := func(a, b Server) bool { return a.Name == b.Name && a.Addr == b.Addr }
+			if regenerated.Name != conf.Name || !slices.EqualFunc(regenerated.Servers, conf.Servers, sameServer) {
+				t.Errorf("the regenerated config has name %q and servers %+v, want the default configuration", regenerated.Name, regenerated.Servers)
+			}
+			if !strings.Contains(logs.String(), "DEFAULT configuration") {
+				t.Errorf("regenerating the config wasn't logged, logs:\n%s", logs)
+			}
+		})
+	}
+}
+
+func TestCommandsAfterClose(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+	commands := consoleCommands
+	t.Cleanup(func() {
+		consoleCommands = commands
+		proxyClosing.Store(false)
+	})
+	consoleCommands = newConsoleCommands()
+
+	proxy := spectrum.NewSpectrum(LobbyDiscovery{}, slog.New(slog.DiscardHandler), &util.Opts{Addr: "127.0.0.1:0"}, &fakeTransport{})
+	if err := proxy.Listen(minecraft.ListenConfig{AuthenticationDisabled: true, ErrorLog: slog.New(slog.DiscardHandler)}); err != nil {
+		t.Fatal(err)
+	}
+	shutdownProxy(proxy)
+
+	for _, cmd := range consoleCommands.Commands() {
+		t.Run(cmd.Name(), func(t *testing.T) {
+			logs := captureLogs(t)
+			handleCommand(cmd.Name()+" Steve lobby", proxy)
+			if !strings.Contains(logs.String(), "The proxy is shutting down, ignoring command") {
+				t.Fatalf("%s ran after the proxy was closed, logs:\n%s", cmd.Name(), logs)
+			}
+		})
+	}
+}
+
+func TestSessionLogCorrelation(t *testing.T) {
+	const lobby, island = "127.0.0.1:19133", "127.0.0.1:19134"
+	useServers(t, Server{Name: "lobby", Addr: lobby, MaxPlayers: 1}, Server{Name: "island", Addr: island})
+	serverTracker.Set("0", lobby)
+	transport := &fakeTransport{}
+	transport.setDown(island, true)
+	transport.setDown(lobby, true)
+	conf := &ServerConfig{TransferFailure: TransferFailure{Message: "island is unavailable", Fallback: true}}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	ids := make(map[string]string)
+	for i, name := range []string{"Steve", "Alex"} {
+		id := newSessionID()
+		ids[name] = id
+		sessionLog := logger.With("session", id, "player", name)
+		s, _ := newTestSession(t, strconv.Itoa(i+1), name, transport)
+		if _, ok := checkJoinCapacity(conf, s, sessionLog); ok {
+			t.Fatalf("%s joined a full lobby", name)
+		}
+		p := &TransferProcessor{s: s, conf: conf, registry: session.NewRegistry(), log: sessionLog}
+		s.SetProcessor(p)
+		p.transferWithRetries("island", island)
+	}
+	if ids["Steve"] == ids["Alex"] {
+		t.Fatalf("both sessions got the ID %s", ids["Steve"])
+	}
+
+	lines := make(map[string]int)
+	for line := range strings.Lines(buf.String()) {
+		var entry struct {
+			Msg     string `json:"msg"`
+			Session string `json:"session"`
+			Player  string `json:"player"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Session != ids[entry.Player] {
+			t.Errorf("%q of %s logged with session %q, want %q", entry.Msg, entry.Player, entry.Session, ids[entry.Player])
+		}
+		lines[entry.Player]++
+	}
+	for name := range ids {
+		if lines[name] < 2 {
+			t.Errorf("%s has %d log lines, want the join and transfer handling logged", name, lines[name])
+		}
+	}
+}
+
+func TestTexturePacksRequired(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPack(t, dir, "pack", 1000)
+	pack, err := resource.ReadPath(filepath.Join(dir, "resource_packs", "pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		packs    []*resource.Pack
+		optional bool
+		want     bool
+	}{
+		{name: "no packs"},
+		{name: "no packs, optional", optional: true},
+		{name: "required packs", packs: []*resource.Pack{pack}, want: true},
+		{name: "optional packs", packs: []*resource.Pack{pack}, optional: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := texturePacksRequired(&ServerConfig{OptionalPacks: tt.optional}, tt.packs); got != tt.want {
+				t.Fatalf("texturePacksRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSkipsPacksWithoutManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPack(t, dir, "pack0", 1000)
+	writeTestPack(t, dir, "pack1", 1000)
+	for name, manifest := range map[string]string{"missing": "", "invalid": "{\"header\": "} {
+		packDir := filepath.Join(dir, "resource_packs", name)
+		if err := os.MkdirAll(filepath.Join(packDir, "textures"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if manifest != "" {
+			if err := os.WriteFile(filepath.Join(packDir, "manifest.json"), []byte(manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	t.Chdir(dir)
+
+	var logs strings.Builder
+	packs, err := parse(nil, PackLimits{}, slog.New(slog.NewTextHandler(&logs, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, pack := range packs {
+		names = append(names, pack.Name())
+	}
+	if want := []string{"pack0", "pack1"}; !slices.Equal(names, want) {
+		t.Fatalf("loaded packs %v, want %v", names, want)
+	}
+	for _, want := range []string{"Missing manifest in missing", "Invalid manifest in invalid"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("parse logged %q, want %q", logs.String(), want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// Maintenance configures maintenance mode, in which only whitelisted players can join the proxy.
+type Maintenance struct {
+	// Enabled is whether maintenance mode is on at startup. It is updated by the maintenance command, so
+	// save-config persists the current mode.
+	Enabled bool `toml:"enabled"`
+	// Whitelist holds the XUIDs and names of the players that can join during maintenance.
+	Whitelist []string `toml:"whitelist"`
+	// Message is the disconnect message shown to other players.
+	Message string `toml:"message"`
+	// Motd is shown as the sub name in the server list during maintenance.
+	Motd string `toml:"motd"`
+}
+
+// maintenance holds the current maintenance mode and whitelist.
+var maintenance = &MaintenanceState{}
+
+// MaintenanceState holds the maintenance mode and whitelist, which can be changed while the proxy is running.
+type MaintenanceState struct {
+	enabled atomic.Bool
+
+	mu        sync.RWMutex
+	whitelist []string
+}
+
+// Enabled reports if maintenance mode is on.
+func (m *MaintenanceState) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// SetEnabled turns maintenance mode on or off.
+func (m *MaintenanceState) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// SetWhitelist replaces the XUIDs and names of the players that can join during maintenance.
+func (m *MaintenanceState) SetWhitelist(whitelist []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.whitelist = slices.Clone(whitelist)
+}
+
+// Allowed reports if the player of s can join during maintenance. Observers can always join.
+func (m *MaintenanceState) Allowed(s *session.Session) bool {
+	if isObserver(s) {
+		return true
+	}
+	identity := s.Client().IdentityData()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Contains(m.whitelist, identity.XUID) || slices.Contains(m.whitelist, identity.DisplayName)
+}
+
+// handleMaintenanceCommand turns maintenance mode on or off, or prints the current mode. Players that are
+// already connected are not disconnected when it is turned on.
+func handleMaintenanceCommand(args []string, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		state := "off"
+		if maintenance.Enabled() {
+			state = "on"
+		}
+		logger.Info(fmt.Sprintf("Maintenance mode is %s, %d player(s) whitelisted", state, len(conf.Maintenance.Whitelist)))
+		return
+	}
+
+	switch args[0] {
+	case "on":
+		maintenance.SetEnabled(true)
+		updateConfig(func(conf *ServerConfig) { conf.Maintenance.Enabled = true })
+		logger.Info("Maintenance mode is on, only whitelisted players can join")
+	case "off":
+		maintenance.SetEnabled(false)
+		updateConfig(func(conf *ServerConfig) { conf.Maintenance.Enabled = false })
+		logger.Info("Maintenance mode is off")
+	default:
+		logger.Info("Usage: maintenance [on|off]")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/cooldogedev/spectrum"
+)
+
+// proxyCounters holds counters of events on the proxy since it started.
+var proxyCounters struct {
+	transfers       atomic.Int64
+	failedTransfers atomic.Int64
+	disconnects     atomic.Int64
+	// transferErrors counts failed transfers by the class returned by classifyTransferError.
+	transferErrors [transferErrorClasses]atomic.Int64
+}
+
+// ProxyStats is a snapshot of the proxy's state and counters.
+type ProxyStats struct {
+	Players         int              `json:"players"`
+	Servers         map[string]int   `json:"servers"`
+	Queued          int              `json:"queued"`
+	Transfers       int64            `json:"transfers"`
+	FailedTransfers int64            `json:"failed_transfers"`
+	TransferErrors  map[string]int64 `json:"transfer_errors"`
+	Disconnects     int64            `json:"disconnects"`
+	Goroutines      int              `json:"goroutines"`
+	CDN             *CDNStatsJSON    `json:"cdn,omitempty"`
+}
+
+// CDNStatsJSON is the JSON form of CDNStats.
+type CDNStatsJSON struct {
+	Requests          int64   `json:"requests"`
+	BytesServed       int64   `json:"bytes_served"`
+	AverageDurationMS float64 `json:"average_duration_ms"`
+	InFlight          int64   `json:"in_flight"`
+}
+
+// collectStats returns a snapshot of the proxy's state and counters.
+func collectStats(proxy *spectrum.Spectrum) ProxyStats {
+	stats := ProxyStats{
+		Players:         len(proxy.Registry().GetSessions()),
+		Servers:         make(map[string]int),
+		Transfers:       proxyCounters.transfers.Load(),
+		FailedTransfers: proxyCounters.failedTransfers.Load(),
+		TransferErrors:  make(map[string]int64),
+		Disconnects:     proxyCounters.disconnects.Load(),
+		Goroutines:      runtime.NumGoroutine(),
+	}
+	for class, name := range transferErrorNames {
+		stats.TransferErrors[name] = proxyCounters.transferErrors[class].Load()
+	}
+
+	for name, addr := range serverRegistry.All() {
+		stats.Servers[name] = serverTracker.Count(addr)
+		stats.Queued += len(joinQueue.List(name))
+	}
+
+	if resourcePackServer != nil {
+		cdn := resourcePackServer.Stats()
+		stats.CDN = &CDNStatsJSON{
+			Requests:          cdn.Requests,
+			BytesServed:       cdn.BytesServed,
+			AverageDurationMS: float64(cdn.AverageDuration.Microseconds()) / 1000,
+			InFlight:          cdn.InFlight,
+		}
+	}
+	return stats
+}
+
+// handleMetricsCommand writes the current proxy stats to stdout as a single line of JSON.
+func handleMetricsCommand(proxy *spectrum.Spectrum) {
+	b, err := json.Marshal(collectStats(proxy))
+	if err != nil {
+		slog.Default().Error("Failed to encode metrics", "error", err)
+		return
+	}
+	_, _ = fmt.Fprintln(os.Stdout, string(b))
+}
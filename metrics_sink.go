@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// MetricsSinkNone discards all metrics.
+	MetricsSinkNone = "none"
+	// MetricsSinkPrometheus exposes metrics in the Prometheus text format over HTTP.
+	MetricsSinkPrometheus = "prometheus"
+)
+
+// Names of the metrics emitted by the proxy.
+const (
+	metricTransfers            = "spectrum_transfers_total"
+	metricFailedTransfers      = "spectrum_transfer_failures_total"
+	metricDisconnects          = "spectrum_disconnects_total"
+	metricPlayers              = "spectrum_players"
+	metricCDNRequests          = "spectrum_cdn_requests_total"
+	metricCDNBytesServed       = "spectrum_cdn_bytes_served_total"
+	metricCDNInFlight          = "spectrum_cdn_in_flight_requests"
+	metricTransferErrorsFormat = "spectrum_transfer_errors_%s_total"
+)
+
+// Metrics configures where metrics are sent.
+type Metrics struct {
+	// Sink is the metrics backend, "none" or "prometheus".
+	Sink string `toml:"sink"`
+	// Addr is the address the Prometheus endpoint listens on, serving metrics at /metrics.
+	Addr string `toml:"addr"`
+}
+
+// MetricsSink receives the metrics emitted by the proxy. Embedders can set metricsSink to their own
+// implementation to send metrics to e.g. StatsD or OpenTelemetry.
+type MetricsSink interface {
+	// AddCounter adds delta to the counter with the given name.
+	AddCounter(name string, delta int64)
+	// SetGauge sets the gauge with the given name to value.
+	SetGauge(name string, value float64)
+}
+
+// metricsSink receives all metrics emitted by the proxy.
+var metricsSink MetricsSink = NopMetricsSink{}
+
+// NopMetricsSink is a MetricsSink discarding all metrics.
+type NopMetricsSink struct{}
+
+func (NopMetricsSink) AddCounter(string, int64) {}
+func (NopMetricsSink) SetGauge(string, float64) {}
+
+// PrometheusSink is a MetricsSink keeping the current value of every metric and serving them in the
+// Prometheus text exposition format.
+type PrometheusSink struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]float64
+}
+
+// NewPrometheusSink creates an empty PrometheusSink.
+func NewPrometheusSink() *PrometheusSink {
+	return &PrometheusSink{counters: make(map[string]int64), gauges: make(map[string]float64)}
+}
+
+func (p *PrometheusSink) AddCounter(name string, delta int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counters[name] += delta
+}
+
+func (p *PrometheusSink) SetGauge(name string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gauges[name] = value
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (p *PrometheusSink) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	var b strings.Builder
+	for _, name := range sortedKeys(p.counters) {
+		fmt.Fprintf(&b, "# TYPE %s counter\n%s %d\n", name, name, p.counters[name])
+	}
+	for _, name := range sortedKeys(p.gauges) {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n%s %g\n", name, name, p.gauges[name])
+	}
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// newMetricsSink creates the MetricsSink configured in conf. The returned server serves the Prometheus
+// endpoint and is nil for sinks without one.
+func newMetricsSink(conf Metrics) (MetricsSink, *http.Server, error) {
+	switch conf.Sink {
+	case MetricsSinkNone, "":
+		return NopMetricsSink{}, nil, nil
+	case MetricsSinkPrometheus:
+		sink := NewPrometheusSink()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", sink)
+		return sink, &http.Server{Addr: conf.Addr, Handler: mux}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown metrics sink %q", conf.Sink)
+	}
+}
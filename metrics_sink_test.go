@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// fakeSink is a MetricsSink capturing the emitted metrics.
+type fakeSink struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]float64
+}
+
+func (f *fakeSink) AddCounter(name string, delta int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counters[name] += delta
+}
+
+func (f *fakeSink) SetGauge(name string, value float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gauges[name] = value
+}
+
+// useFakeSink makes a fakeSink receive the metrics emitted for the duration of the test.
+func useFakeSink(t *testing.T) *fakeSink {
+	t.Helper()
+	sink := metricsSink
+	t.Cleanup(func() { metricsSink = sink })
+	f := &fakeSink{counters: make(map[string]int64), gauges: make(map[string]float64)}
+	metricsSink = f
+	return f
+}
+
+func TestMetricsEmitted(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+	useTransferHooks(t)
+	sink := useFakeSink(t)
+
+	// Two transfers succeed and one times out.
+	for _, err := range []error{nil, nil, context.DeadlineExceeded} {
+		pending := &pendingTransfer{name: "island", addr: "127.0.0.1:19134", done: make(chan error, 1)}
+		pendingTransfersMu.Lock()
+		pendingTransfers[nil] = pending
+		pendingTransfersMu.Unlock()
+		completeTransfer(nil, "127.0.0.1:19134", err)
+	}
+
+	// A pack is downloaded from the CDN.
+	s, pack := newTestPackServer(t, 1000)
+	getPack(t, s, pack, nil)
+
+	// A player that joined disconnects.
+	player, _ := newTestSession(t, "1", "Steve", &fakeTransport{})
+	p := &TransferProcessor{s: player, conf: &ServerConfig{}, registry: newRegistryWith(player), log: slog.New(slog.DiscardHandler), accepted: time.Now()}
+	p.joined.Store(true)
+	reason := "left"
+	p.ProcessDisconnection(nil, &reason)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	wantCounters := map[string]int64{
+		metricTransfers:                          2,
+		metricFailedTransfers:                    1,
+		"spectrum_transfer_errors_timeout_total": 1,
+		metricCDNRequests:                        1,
+		metricCDNBytesServed:                     int64(pack.Len()),
+		metricDisconnects:                        1,
+	}
+	for name, want := range wantCounters {
+		if got := sink.counters[name]; got != want {
+			t.Errorf("counter %s = %d, want %d", name, got, want)
+		}
+	}
+	wantGauges := map[string]float64{metricPlayers: 0, metricCDNInFlight: 0}
+	for name, want := range wantGauges {
+		if got, ok := sink.gauges[name]; !ok || got != want {
+			t.Errorf("gauge %s = %g (set: %v), want %g", name, got, ok, want)
+		}
+	}
+}
+
+// newRegistryWith returns a session registry holding s.
+func newRegistryWith(s *session.Session) *session.Registry {
+	registry := session.NewRegistry()
+	registry.AddSession(s.Client().IdentityData().XUID, s)
+	return registry
+}
+
+func TestPrometheusSink(t *testing.T) {
+	sink := NewPrometheusSink()
+	sink.AddCounter(metricTransfers, 2)
+	sink.AddCounter(metricTransfers, 1)
+	sink.SetGauge(metricPlayers, 5)
+	sink.SetGauge(metricPlayers, 4)
+
+	w := httptest.NewRecorder()
+	sink.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	want := "# TYPE spectrum_transfers_total counter\nspectrum_transfers_total 3\n# TYPE spectrum_players gauge\nspectrum_players 4\n"
+	if string(body) != want {
+		t.Fatalf("served %q, want %q", body, want)
+	}
+}
+
+func TestNewMetricsSink(t *testing.T) {
+	tests := []struct {
+		sink       string
+		wantServer bool
+		wantErr    bool
+	}{
+		{sink: ""},
+		{sink: MetricsSinkNone},
+		{sink: MetricsSinkPrometheus, wantServer: true},
+		{sink: "statsd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sink, func(t *testing.T) {
+			sink, server, err := newMetricsSink(Metrics{Sink: tt.sink, Addr: "127.0.0.1:9100"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newMetricsSink(%q) error = %v, wantErr %v", tt.sink, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (server != nil) != tt.wantServer {
+				t.Fatalf("newMetricsSink(%q) returned server %v, want a server: %v", tt.sink, server, tt.wantServer)
+			}
+			if _, prometheus := sink.(*PrometheusSink); prometheus != (tt.sink == MetricsSinkPrometheus) {
+				t.Fatalf("newMetricsSink(%q) = %T", tt.sink, sink)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/cooldogedev/spectrum"
+)
+
+func TestMetricsCommand(t *testing.T) {
+	keys := []string{"players", "servers", "queued", "transfers", "failed_transfers", "transfer_errors", "disconnects", "goroutines"}
+	tests := []struct {
+		name string
+		cdn  bool
+	}{
+		{name: "CDN disabled"},
+		{name: "CDN enabled", cdn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+			server := resourcePackServer
+			t.Cleanup(func() { resourcePackServer = server })
+			resourcePackServer = nil
+			if tt.cdn {
+				useCDN(t, false)
+			}
+			serverTracker.Set("1", "127.0.0.1:19134")
+			proxy := spectrum.NewSpectrum(LobbyDiscovery{}, slog.New(slog.DiscardHandler), nil, &fakeTransport{})
+
+			out := captureStdout(t, func() { handleMetricsCommand(proxy) })
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("output %q is not a JSON object: %v", out, err)
+			}
+			for _, key := range keys {
+				if _, ok := got[key]; !ok {
+					t.Errorf("metrics %s have no %q key", out, key)
+				}
+			}
+			if _, ok := got["cdn"]; ok != tt.cdn {
+				t.Errorf("metrics %s have a cdn key: %v, want %v", out, ok, tt.cdn)
+			}
+
+			var servers map[string]int
+			if err := json.Unmarshal(got["servers"], &servers); err != nil {
+				t.Fatal(err)
+			}
+			if servers["island"] != 1 || servers["lobby"] != 0 {
+				t.Errorf("servers = %v, want the player counts of the servers", servers)
+			}
+			var errs map[string]int64
+			if err := json.Unmarshal(got["transfer_errors"], &errs); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range transferErrorNames {
+				if _, ok := errs[name]; !ok {
+					t.Errorf("transfer errors %v have no %q class", errs, name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// handleMigrateCommand transfers every player on one server to another, e.g. to empty a server before
+// restarting it. Transfers run in the background and are paced by the transfer limit.
+func handleMigrateCommand(args []string, proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	if len(args) < 2 {
+		logger.Info("Usage: migrate <from-server> <to-server>")
+		return
+	}
+
+	from, to := args[0], args[1]
+	if from == to {
+		logger.Info("The source and target server must be different")
+		return
+	}
+	fromAddr, ok := serverRegistry.Lookup(from)
+	if !ok {
+		logger.Info(fmt.Sprintf("Server '%s' not found", from))
+		return
+	}
+	toAddr, ok := serverRegistry.Lookup(to)
+	if !ok {
+		logger.Info(fmt.Sprintf("Server '%s' not found", to))
+		return
+	}
+	if serverDown(toAddr) {
+		logger.Info(fmt.Sprintf("Server %s is down, not migrating players to it", to))
+		return
+	}
+
+	sessions := sessionsOnServer(proxy, fromAddr)
+	if len(sessions) == 0 {
+		logger.Info(fmt.Sprintf("No players on %s", from))
+		return
+	}
+	logger.Info(fmt.Sprintf("Migrating %d player(s) from %s to %s", len(sessions), from, to))
+	go func() {
+		moved, skipped, failed := migrateSessions(sessions, fromAddr, to, toAddr, logger)
+		logger.Info(fmt.Sprintf("Migrated %d player(s) from %s to %s, %d skipped, %d failed", moved, from, to, skipped, len(failed)))
+		if len(failed) > 0 {
+			logger.Info(fmt.Sprintf("- Failed: %s", strings.Join(failed, ", ")))
+		}
+	}()
+}
+
+// migrateSessions transfers the sessions that are still on the server at fromAddr to the named server at
+// toAddr and waits for all transfers to finish. Sessions that left the server in the meantime are skipped.
+// It returns the number of players moved and skipped, and the names of the players that failed to move.
+func migrateSessions(sessions []*session.Session, fromAddr, to, toAddr string, logger *slog.Logger) (moved, skipped int, failed []string) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, s := range sessions {
+		identity := s.Client().IdentityData()
+		if current, ok := serverTracker.Server(identity.XUID); !ok || current != fromAddr {
+			skipped++
+			continue
+		}
+
+		wg.Add(1)
+		go func(s *session.Session, name string) {
+			defer wg.Done()
+			err := transferSession(s, to, toAddr)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logger.Error("Failed to migrate player", "player", name, "server", to, "error", err)
+				failed = append(failed, name)
+				return
+			}
+			moved++
+		}(s, identity.DisplayName)
+	}
+	wg.Wait()
+	return moved, skipped, failed
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// startedTransfers waits until at least one transfer to addr was started and returns the sessions of all
+// started transfers to addr.
+func startedTransfers(t *testing.T, addr string) []*session.Session {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var started []*session.Session
+		pendingTransfersMu.Lock()
+		for s, pending := range pendingTransfers {
+			if pending.addr == addr && pending.started {
+				started = append(started, s)
+			}
+		}
+		pendingTransfersMu.Unlock()
+		if len(started) > 0 {
+			return started
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no transfer to %s was started", addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMigrateSessions(t *testing.T) {
+	const lobby, from, to = "127.0.0.1:19133", "127.0.0.1:19134", "127.0.0.1:19135"
+	useServers(t, Server{Name: "lobby", Addr: lobby}, Server{Name: "from", Addr: from}, Server{Name: "to", Addr: to})
+	useTransferHooks(t)
+	useMaxConcurrentTransfers(t, 1)
+	transport := &fakeTransport{}
+
+	var sessions []*session.Session
+	for _, p := range []struct{ xuid, name, addr string }{
+		{xuid: "1", name: "Steve", addr: from},
+		{xuid: "2", name: "Alex", addr: from},
+		{xuid: "3", name: "Bob", addr: lobby},
+	} {
+		s, _ := newTestSession(t, p.xuid, p.name, transport)
+		serverTracker.Set(p.xuid, p.addr)
+		sessions = append(sessions, s)
+	}
+
+	type result struct {
+		moved, skipped int
+		failed         []string
+	}
+	done := make(chan result, 1)
+	go func() {
+		moved, skipped, failed := migrateSessions(sessions, from, "to", to, slog.New(slog.DiscardHandler))
+		done <- result{moved: moved, skipped: skipped, failed: failed}
+	}()
+
+	// Only one transfer may be in progress at a time, the next one starts once it completed.
+	for range 2 {
+		started := startedTransfers(t, to)
+		if len(started) != 1 {
+			t.Fatalf("%d transfers were started at once, want 1", len(started))
+		}
+		completeTransfer(started[0], to, nil)
+	}
+	res := <-done
+	if res.moved != 2 || res.skipped != 1 || len(res.failed) != 0 {
+		t.Fatalf("migrateSessions() = %d moved, %d skipped, %v failed, want 2 moved and 1 skipped", res.moved, res.skipped, res.failed)
+	}
+	if got := transport.dialed(); !slices.Equal(got, []string{to, to}) {
+		t.Fatalf("dialed %v, want only the players on the source server moved", got)
+	}
+}
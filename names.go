@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// NamePolicyPass uses display names as they are.
+	NamePolicyPass = "pass"
+	// NamePolicySanitize keeps the display name for display, but uses a sanitized form of it for file names
+	// and logs.
+	NamePolicySanitize = "sanitize"
+	// NamePolicyReject disconnects players whose display name contains invalid characters.
+	NamePolicyReject = "reject"
+)
+
+// validNameRune reports if r may be used in a display name without being sanitized.
+func validNameRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-'
+}
+
+// sanitizeName returns name with every character that is not a letter, digit, underscore or hyphen replaced
+// with an underscore, making it safe to use in file names and logs.
+func sanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if validNameRune(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// validDisplayName reports if name only consists of letters, digits, spaces, underscores and hyphens.
+func validDisplayName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !validNameRune(r) && r != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+// applyNamePolicy returns the form of the display name that should be used for file names and logs under
+// policy, or an error if the name is rejected.
+func applyNamePolicy(policy, name string) (string, error) {
+	switch policy {
+	case NamePolicySanitize:
+		return sanitizeName(name), nil
+	case NamePolicyReject:
+		if !validDisplayName(name) {
+			return "", fmt.Errorf("display name %q contains invalid characters", name)
+		}
+		return name, nil
+	default:
+		return name, nil
+	}
+}
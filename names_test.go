@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestApplyNamePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		displayName string
+		want        string
+		wantErr     bool
+	}{
+		{name: "pass valid", policy: NamePolicyPass, displayName: "Steve 2", want: "Steve 2"},
+		{name: "pass invalid", policy: NamePolicyPass, displayName: "../St§ve", want: "../St§ve"},
+		{name: "sanitize valid", policy: NamePolicySanitize, displayName: "Steve_2-a", want: "Steve_2-a"},
+		{name: "sanitize space", policy: NamePolicySanitize, displayName: "Steve 2", want: "Steve_2"},
+		{name: "sanitize path", policy: NamePolicySanitize, displayName: "../St§ve", want: "___St_ve"},
+		{name: "sanitize empty", policy: NamePolicySanitize, displayName: "", want: "_"},
+		{name: "reject valid", policy: NamePolicyReject, displayName: "Steve 2", want: "Steve 2"},
+		{name: "reject invalid", policy: NamePolicyReject, displayName: "../St§ve", wantErr: true},
+		{name: "reject empty", policy: NamePolicyReject, displayName: "", wantErr: true},
+		{name: "unset policy", displayName: "../St§ve", want: "../St§ve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyNamePolicy(tt.policy, tt.displayName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyNamePolicy(%q, %q) error = %v, wantErr %v", tt.policy, tt.displayName, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("applyNamePolicy(%q, %q) = %q, want %q", tt.policy, tt.displayName, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// compressionThreshold is the size from which packets sent to clients are compressed. gophertunnel always
+// announces this threshold in the NetworkSettings packet, it can't be configured.
+const compressionThreshold = 512
+
+// compressions are the compression algorithms that can be configured, by name.
+var compressions = map[string]packet.Compression{
+	"flate":  packet.FlateCompression,
+	"snappy": packet.SnappyCompression,
+	"none":   packet.NopCompression,
+}
+
+// Network tunes how packets are batched on the connections of the proxy.
+//
+// Spectrum writes packets to backends as soon as they are received from the client, so only the client
+// side can be tuned. Packets from backends are flushed to the client whenever the backend sends a flush,
+// and additionally at the client flush interval.
+type Network struct {
+	// ClientFlushMillis is the interval at which packets are flushed to clients. Zero uses the default of
+	// 50ms, and -1 only flushes when the backend asks for it, trading throughput for latency. Oomph
+	// flushes by itself, so this is always -1 with Oomph enabled.
+	ClientFlushMillis int `toml:"client_flush_millis"`
+	// LatencyIntervalMillis is the interval at which backends report the latency of players. Lower values
+	// are more accurate but use more bandwidth.
+	LatencyIntervalMillis int64 `toml:"latency_interval_millis"`
+	// Compression is the compression algorithm clients are told to use: flate, snappy or none. Snappy is
+	// cheaper but crashes devices without AVX2 support.
+	Compression string `toml:"compression"`
+}
+
+// validateNetwork checks that the network settings are in range.
+func validateNetwork(conf Network) error {
+	if conf.ClientFlushMillis < -1 {
+		return fmt.Errorf("client_flush_millis must be -1 or more, got %d", conf.ClientFlushMillis)
+	}
+	if conf.LatencyIntervalMillis <= 0 {
+		return fmt.Errorf("latency_interval_millis must be positive, got %d", conf.LatencyIntervalMillis)
+	}
+	if _, ok := compressions[conf.Compression]; !ok {
+		return fmt.Errorf("unknown compression %q, expected flate, snappy or none", conf.Compression)
+	}
+	return nil
+}
+
+// logCompression logs the compression settings used with a client on the given protocol at debug level.
+func logCompression(log *slog.Logger, conf Network, protocol int32) {
+	log.Debug("Negotiated compression", "algorithm", conf.Compression, "threshold", compressionThreshold, "protocol", protocol)
+}
+
+// clientFlushRate returns the flush rate of client connections for the configuration.
+func clientFlushRate(conf *ServerConfig) time.Duration {
+	if conf.OomphEnabled || conf.Network.ClientFlushMillis == -1 {
+		return -1
+	}
+	return time.Duration(conf.Network.ClientFlushMillis) * time.Millisecond
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientFlushRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		oomph bool
+		flush int
+		want  time.Duration
+	}{
+		{name: "default", flush: 0, want: 0},
+		{name: "interval", flush: 20, want: 20 * time.Millisecond},
+		{name: "backend flushes only", flush: -1, want: -1},
+		{name: "oomph", oomph: true, flush: 0, want: -1},
+		{name: "oomph ignores interval", oomph: true, flush: 20, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := defaultConfig()
+			conf.OomphEnabled = tt.oomph
+			conf.Network.ClientFlushMillis = tt.flush
+			if got := clientFlushRate(conf); got != tt.want {
+				t.Fatalf("clientFlushRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyOptsNetwork(t *testing.T) {
+	conf := defaultConfig()
+	conf.Network.LatencyIntervalMillis = 250
+	if got := proxyOpts(conf, nil).LatencyInterval; got != 250 {
+		t.Fatalf("LatencyInterval = %d, want 250", got)
+	}
+}
+
+func TestValidateNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(n *Network)
+		wantErr bool
+	}{
+		{name: "default", change: func(n *Network) {}},
+		{name: "backend flushes only", change: func(n *Network) { n.ClientFlushMillis = -1 }},
+		{name: "negative flush", change: func(n *Network) { n.ClientFlushMillis = -2 }, wantErr: true},
+		{name: "zero latency interval", change: func(n *Network) { n.LatencyIntervalMillis = 0 }, wantErr: true},
+		{name: "unknown compression", change: func(n *Network) { n.Compression = "zstd" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := defaultConfig().Network
+			tt.change(&n)
+			if err := validateNetwork(n); (err != nil) != tt.wantErr {
+				t.Fatalf("validateNetwork() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogCompression(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})).With("player", "Steve")
+	logCompression(log, Network{Compression: "snappy"}, 766)
+	want := `msg="Negotiated compression" player=Steve algorithm=snappy threshold=512 protocol=766`
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("log does not contain %q:\n%s", want, buf)
+	}
+
+	buf.Reset()
+	logCompression(slog.New(slog.NewTextHandler(buf, nil)), Network{Compression: "flate"}, 766)
+	if buf.Len() != 0 {
+		t.Fatalf("compression was logged above debug level:\n%s", buf)
+	}
+}
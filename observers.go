@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// Observers configures staff accounts that may join any server to inspect it.
+//
+// Observers bypass the allow lists of servers, the player limits of the proxy and of servers, and the join
+// queue. They are still subject to the firewall, connection throttles, login rate limits and drains, and
+// can't join servers that are down. Observers are only recognised by the XUID of an Xbox Live authenticated
+// login, so the flag can't be claimed by spoofing a name or using a self-signed identity. The proxy does
+// not restrict what observers do on a server: backends should put them in spectator mode themselves.
+type Observers struct {
+	// XUIDs lists the XUIDs of the observer accounts.
+	XUIDs []string `toml:"xuids"`
+}
+
+// observers holds the XUIDs of the observer accounts.
+var observers = &ObserverList{}
+
+// ObserverList is a concurrency-safe list of observer XUIDs.
+type ObserverList struct {
+	mu    sync.RWMutex
+	xuids []string
+}
+
+// Set replaces the observer XUIDs.
+func (l *ObserverList) Set(xuids []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.xuids = slices.Clone(xuids)
+}
+
+// Contains reports if xuid is the XUID of an observer.
+func (l *ObserverList) Contains(xuid string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return xuid != "" && slices.Contains(l.xuids, xuid)
+}
+
+// isObserver reports if the player of s is an observer. Only Xbox Live authenticated players can be
+// observers, since the XUID of other players can't be trusted.
+func isObserver(s *session.Session) bool {
+	return observerXUID(s.Client().Authenticated(), s.Client().IdentityData().XUID)
+}
+
+// observerXUID reports if xuid is the XUID of an observer and can be trusted, because the player is Xbox
+// Live authenticated.
+func observerXUID(authenticated bool, xuid string) bool {
+	return authenticated && observers.Contains(xuid)
+}
+
+// serverFullFor reports if the named server is full for the player of s. Servers are never full for
+// observers.
+func serverFullFor(s *session.Session, name, addr string) bool {
+	return !isObserver(s) && serverFull(name, addr)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/oomph-ac/oconfig"
+)
+
+// OomphSettings holds the Oomph settings that are applied on top of Oomph's defaults.
+type OomphSettings struct {
+	// CorrectionThreshold is the distance in blocks between the client and the prediction that triggers a
+	// correction.
+	CorrectionThreshold float32 `toml:"correction_threshold"`
+	// PersuasionThreshold is the distance in blocks per tick the prediction moves towards the client.
+	PersuasionThreshold float32 `toml:"persuasion_threshold"`
+	// AcceptClientPosition accepts the client's position if it is within PositionAcceptanceThreshold.
+	AcceptClientPosition        bool    `toml:"accept_client_position"`
+	PositionAcceptanceThreshold float32 `toml:"position_acceptance_threshold"`
+	// AcceptClientVelocity accepts the client's velocity if it is within VelocityAcceptanceThreshold.
+	AcceptClientVelocity        bool    `toml:"accept_client_velocity"`
+	VelocityAcceptanceThreshold float32 `toml:"velocity_acceptance_threshold"`
+
+	// MaximumAttackAngle is the maximum angle in degrees of a valid attack.
+	MaximumAttackAngle float32 `toml:"maximum_attack_angle"`
+	// EnableClientEntityTracking lag compensates attacks for the client's view of entities.
+	EnableClientEntityTracking bool `toml:"enable_client_entity_tracking"`
+
+	// The following limits can be set to -1 to disable them.
+	GlobalMovementCutoffThreshold int `toml:"global_movement_cutoff_threshold"`
+	MaxEntityRewind               int `toml:"max_entity_rewind"`
+	MaxGhostBlockChain            int `toml:"max_ghost_block_chain"`
+	MaxKnockbackDelay             int `toml:"max_knockback_delay"`
+	MaxBlockUpdateDelay           int `toml:"max_block_update_delay"`
+}
+
+// applyOomphSettings resets the global Oomph config to Oomph's defaults and applies s to it. Oomph copies
+// the global config when a player is created, so only sessions started afterwards use the new settings.
+func applyOomphSettings(s OomphSettings) {
+	oconfig.Global = oconfig.DefaultConfig
+	//oconfig.Global.Network.Transport = oconfig.NetworkTransportSpectral
+
+	oconfig.Global.Movement.AcceptClientPosition = s.AcceptClientPosition
+	oconfig.Global.Movement.PositionAcceptanceThreshold = s.PositionAcceptanceThreshold
+	oconfig.Global.Movement.AcceptClientVelocity = s.AcceptClientVelocity
+	oconfig.Global.Movement.VelocityAcceptanceThreshold = s.VelocityAcceptanceThreshold
+
+	oconfig.Global.Movement.PersuasionThreshold = s.PersuasionThreshold
+	oconfig.Global.Movement.CorrectionThreshold = s.CorrectionThreshold
+
+	oconfig.Global.Combat.MaximumAttackAngle = s.MaximumAttackAngle
+	oconfig.Global.Combat.EnableClientEntityTracking = s.EnableClientEntityTracking
+
+	oconfig.Global.Network.GlobalMovementCutoffThreshold = s.GlobalMovementCutoffThreshold
+	oconfig.Global.Network.MaxEntityRewind = s.MaxEntityRewind
+	oconfig.Global.Network.MaxGhostBlockChain = s.MaxGhostBlockChain
+	oconfig.Global.Network.MaxKnockbackDelay = s.MaxKnockbackDelay
+	oconfig.Global.Network.MaxBlockUpdateDelay = s.MaxBlockUpdateDelay
+}
+
+// handleOomphCommand processes the subcommands of the oomph command. 'oomph reload' reads the Oomph
+// settings from the config file again. Players that are already connected keep the settings they joined
+// with, only players joining afterwards use the reloaded settings.
+func handleOomphCommand(args []string, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 || args[0] != "reload" {
+		logger.Info("Usage: oomph reload")
+		return
+	}
+	if !conf.OomphEnabled {
+		logger.Info("Oomph is disabled, its settings are not used")
+		return
+	}
+
+	newConf, err := loadConfig(false)
+	if err != nil {
+		logger.Error("Failed to read config", "error", err)
+		return
+	}
+	applyOomphSettings(newConf.Oomph)
+	updateConfig(func(conf *ServerConfig) { conf.Oomph = newConf.Oomph })
+	logger.Info("Reloaded Oomph settings, they apply to players joining from now on")
+}
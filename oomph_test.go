@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oomph-ac/oconfig"
+)
+
+func TestOomphReload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	global := oconfig.Global
+	t.Cleanup(func() { oconfig.Global = global })
+
+	conf := defaultConfig()
+	conf.OomphEnabled = true
+	useServers(t, conf.Servers...)
+	useConfig(t, conf)
+	applyOomphSettings(conf.Oomph)
+
+	newConf := defaultConfig()
+	newConf.Oomph.CorrectionThreshold = 0.75
+	newConf.Oomph.AcceptClientPosition = true
+	newConf.Oomph.PositionAcceptanceThreshold = 0.2
+	newConf.Oomph.MaximumAttackAngle = 110
+	newConf.Oomph.MaxKnockbackDelay = -1
+	if err := writeConfig(newConf); err != nil {
+		t.Fatal(err)
+	}
+	handleOomphCommand([]string{"reload"}, conf)
+
+	g := oconfig.Global
+	if g.Movement.CorrectionThreshold != 0.75 || !g.Movement.AcceptClientPosition || g.Movement.PositionAcceptanceThreshold != 0.2 {
+		t.Errorf("reloaded movement settings are %+v", g.Movement)
+	}
+	if g.Combat.MaximumAttackAngle != 110 {
+		t.Errorf("reloaded maximum attack angle is %v, want 110", g.Combat.MaximumAttackAngle)
+	}
+	if g.Network.MaxKnockbackDelay != -1 {
+		t.Errorf("reloaded max knockback delay is %d, want -1", g.Network.MaxKnockbackDelay)
+	}
+	// Settings not set in the config keep their values.
+	if g.Movement.PersuasionThreshold != newConf.Oomph.PersuasionThreshold || g.Network.MaxEntityRewind != newConf.Oomph.MaxEntityRewind {
+		t.Errorf("reloading changed settings that were not changed in the config: %+v", g)
+	}
+	if got := currentConfig().Oomph; got != newConf.Oomph {
+		t.Errorf("live config has Oomph settings %+v, want %+v", got, newConf.Oomph)
+	}
+}
+
+func TestOomphReloadDisabled(t *testing.T) {
+	t.Chdir(t.TempDir())
+	global := oconfig.Global
+	t.Cleanup(func() { oconfig.Global = global })
+
+	conf := defaultConfig()
+	useServers(t, conf.Servers...)
+	useConfig(t, conf)
+	applyOomphSettings(conf.Oomph)
+
+	newConf := defaultConfig()
+	newConf.Oomph.CorrectionThreshold = 0.75
+	if err := writeConfig(newConf); err != nil {
+		t.Fatal(err)
+	}
+	logs := captureLogs(t)
+	handleOomphCommand([]string{"reload"}, conf)
+	if oconfig.Global.Movement.CorrectionThreshold == 0.75 {
+		t.Error("the Oomph settings were reloaded while Oomph is disabled")
+	}
+	if !strings.Contains(logs.String(), "Oomph is disabled") {
+		t.Errorf("reloading while Oomph is disabled was not reported:\n%s", logs)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+const packsCommandUsage = "Usage: packs <urls|reload [server]|notify> ..."
+
+// packListener is the listener resource packs are handed out to joining players by.
+type packListener interface {
+	AddResourcePack(pack *resource.Pack)
+	RemoveResourcePack(uuid string)
+}
+
+// handlePacksCommand processes the subcommands of the packs command.
+func handlePacksCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		logger.Info(packsCommandUsage)
+		return
+	}
+
+	switch args[0] {
+	case "reload":
+		var server string
+		if len(args) >= 2 {
+			server = args[1]
+		}
+		added, removed, updated, err := reloadPacks(proxy.Listener(), conf, server, logger)
+		if err != nil {
+			logger.Error("Failed to reload resource packs, keeping the current packs", "error", err)
+			return
+		}
+		if server != "" {
+			logger.Info(fmt.Sprintf("Reloaded resource packs of %s (%d loaded)", server, len(loadedPacks)))
+		} else {
+			logger.Info(fmt.Sprintf("Reloaded resource packs (%d loaded)", len(loadedPacks)))
+		}
+		if len(added)+len(removed)+len(updated) == 0 {
+			logger.Info("No resource packs changed")
+			return
+		}
+		if len(added) > 0 {
+			logger.Info(fmt.Sprintf("- Added: %s", strings.Join(added, ", ")))
+		}
+		if len(removed) > 0 {
+			logger.Info(fmt.Sprintf("- Removed: %s", strings.Join(removed, ", ")))
+		}
+		if len(updated) > 0 {
+			logger.Info(fmt.Sprintf("- Updated: %s", strings.Join(updated, ", ")))
+		}
+		logger.Info("Players need to reconnect to receive the new resource packs, use 'packs notify' to tell them")
+
+	case "notify":
+		var sent int
+		if len(args) >= 2 {
+			sent = broadcastMessage(proxy.Registry().GetSessions(), strings.Join(args[1:], " "))
+		} else {
+			sent = notifyPackRefresh(proxy.Registry().GetSessions(), conf.PackRefreshMessage)
+		}
+		logger.Info(fmt.Sprintf("Sent resource pack refresh prompt to %d player(s)", sent))
+
+	case "urls":
+		if len(loadedPacks) == 0 {
+			logger.Info("No resource packs loaded")
+			return
+		}
+		if cdnBaseURL == "" {
+			logger.Info("CDN is disabled, resource packs are sent to clients directly")
+			for _, pack := range loadedPacks {
+				logger.Info(fmt.Sprintf("- %s (%s)", pack.Name(), pack.UUID()))
+			}
+			return
+		}
+
+		logger.Info(fmt.Sprintf("Resource pack URLs (%d)", len(loadedPacks)))
+		for _, pack := range loadedPacks {
+			logger.Info(fmt.Sprintf("- %s (%s): %s", pack.Name(), pack.UUID(), packURL(cdnBaseURL, pack)))
+		}
+
+	default:
+		logger.Info(fmt.Sprintf("Unknown packs subcommand: %s", args[0]))
+		logger.Info(packsCommandUsage)
+	}
+}
+
+// notifyPackRefresh asks the given sessions to reconnect to receive updated resource packs, since packs
+// can't be changed for players that are already connected. It returns how many players were notified.
+func notifyPackRefresh(sessions []*session.Session, message string) int {
+	sent := 0
+	for _, s := range sessions {
+		if err := sendMessage(s, localize(s, "pack_refresh", message)); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// reloadPacks reads the resource packs from disk again and applies them to the listener and the CDN. If
+// server isn't empty, only the packs listed for that server are reloaded and the other packs are kept as
+// they are. The current packs are kept if the new ones can't be applied. It returns the UUIDs of the packs
+// that were added, removed and updated (changed content).
+func reloadPacks(listener packListener, conf *ServerConfig, server string, logger *slog.Logger) (added, removed, updated []string, err error) {
+	packs, err := parse(conf.ContentKeys, conf.PackLimits, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if server != "" {
+		srv, ok := serverRegistry.Get(server)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("unknown server %s", server)
+		}
+		if len(srv.Packs) == 0 {
+			return nil, nil, nil, fmt.Errorf("no resource packs are listed for %s", server)
+		}
+		packs = mergePacks(loadedPacks, packs, srv.Packs)
+	}
+
+	old := make(map[string]*resource.Pack, len(loadedPacks))
+	for _, pack := range loadedPacks {
+		old[pack.UUID().String()] = pack
+	}
+	current := make(map[string]*resource.Pack, len(packs))
+	for _, pack := range packs {
+		uuid := pack.UUID().String()
+		current[uuid] = pack
+		if prev, ok := old[uuid]; !ok {
+			added = append(added, uuid)
+		} else if prev.Checksum() != pack.Checksum() {
+			updated = append(updated, uuid)
+		}
+	}
+	for uuid := range old {
+		if _, ok := current[uuid]; !ok {
+			removed = append(removed, uuid)
+		}
+	}
+
+	listenerPacks := packs
+	if resourcePackServer != nil {
+		// The listener hands out packs downloaded from the CDN, so the CDN must serve the new packs first.
+		resourcePackServer.UpdatePacks(packs)
+		if listenerPacks, err = ModifyResourcePackForCDN(packs, cdnBaseURL); err != nil {
+			resourcePackServer.UpdatePacks(loadedPacks)
+			return nil, nil, nil, err
+		}
+	}
+	for _, uuid := range removed {
+		listener.RemoveResourcePack(uuid)
+	}
+	for _, uuid := range updated {
+		listener.RemoveResourcePack(uuid)
+	}
+	for _, pack := range listenerPacks {
+		uuid := pack.UUID().String()
+		if _, ok := old[uuid]; !ok || slices.Contains(updated, uuid) {
+			listener.AddResourcePack(pack)
+		}
+	}
+	loadedPacks = packs
+	return added, removed, updated, nil
+}
+
+// recachePack reads the loaded pack with the given UUID from disk again and swaps it in for the listener
+// and the CDN, replacing only its cached content. The other packs are neither read nor changed. It returns
+// the new cached size of the pack.
+func recachePack(listener packListener, conf *ServerConfig, uuid string) (int, error) {
+	i := slices.IndexFunc(loadedPacks, func(pack *resource.Pack) bool { return pack.UUID().String() == uuid })
+	if i < 0 {
+		return 0, fmt.Errorf("resource pack %s is not loaded", uuid)
+	}
+	pack, err := readPack(uuid, conf.ContentKeys)
+	if err != nil {
+		return 0, err
+	}
+	size, err := resourcePackServer.ReplacePack(pack)
+	if err != nil {
+		return 0, err
+	}
+	// The listener hands out the pack downloaded from the CDN, so the CDN must serve the new pack first.
+	listenerPacks, err := ModifyResourcePackForCDN([]*resource.Pack{pack}, cdnBaseURL)
+	if err != nil {
+		_, _ = resourcePackServer.ReplacePack(loadedPacks[i])
+		return 0, err
+	}
+	listener.RemoveResourcePack(uuid)
+	listener.AddResourcePack(listenerPacks[0])
+	packs := slices.Clone(loadedPacks)
+	packs[i] = pack
+	loadedPacks = packs
+	return size, nil
+}
+
+// readPack reads the resource pack with the given UUID from the resource_packs directory and applies its
+// content key. Only the manifests of the other packs are read to find it.
+func readPack(uuid string, keys map[string]string) (*resource.Pack, error) {
+	dir := "resource_packs"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		packPath := filepath.Join(dir, entry.Name())
+		if id, err := manifestUUID(packPath, entry.IsDir()); err != nil || id != uuid {
+			continue
+		}
+		pack, err := resource.ReadPath(packPath)
+		if err != nil {
+			return nil, err
+		}
+		if key, ok := keys[uuid]; ok {
+			pack = pack.WithContentKey(key)
+		}
+		return pack, nil
+	}
+	return nil, fmt.Errorf("resource pack %s not found in %s", uuid, dir)
+}
+
+// manifestUUID returns the UUID in the header of the manifest of the pack at packPath, which is either a
+// directory or an archive. The manifest of an archive may be in a sub directory.
+func manifestUUID(packPath string, isDir bool) (string, error) {
+	var data []byte
+	if isDir {
+		b, err := os.ReadFile(filepath.Join(packPath, "manifest.json"))
+		if err != nil {
+			return "", err
+		}
+		data = b
+	} else {
+		r, err := zip.OpenReader(packPath)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		var manifest *zip.File
+		for _, f := range r.File {
+			if path.Base(f.Name) == "manifest.json" && (manifest == nil || strings.Count(f.Name, "/") < strings.Count(manifest.Name, "/")) {
+				manifest = f
+			}
+		}
+		if manifest == nil {
+			return "", fmt.Errorf("%s has no manifest", packPath)
+		}
+		rc, err := manifest.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		if data, err = io.ReadAll(rc); err != nil {
+			return "", err
+		}
+	}
+	var m struct {
+		Header struct {
+			UUID string `json:"uuid"`
+		} `json:"header"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", err
+	}
+	return m.Header.UUID, nil
+}
+
+// mergePacks returns the packs in current with the packs whose UUID is in uuids replaced by their version
+// in parsed. Packs in uuids that are missing from parsed are dropped, and those that are new are added.
+func mergePacks(current, parsed []*resource.Pack, uuids []string) []*resource.Pack {
+	listed := func(pack *resource.Pack) bool {
+		return slices.Contains(uuids, pack.UUID().String())
+	}
+	packs := slices.DeleteFunc(slices.Clone(current), listed)
+	for _, pack := range parsed {
+		if listed(pack) {
+			packs = append(packs, pack)
+		}
+	}
+	return packs
+}
+
+// handleCDNCommand processes the subcommands of the cdn command.
+func handleCDNCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		logger.Info("Usage: cdn <stats|warm|recache|flush-all|reload-cert> ...")
+		return
+	}
+	if resourcePackServer == nil {
+		logger.Info("CDN is disabled")
+		return
+	}
+
+	switch args[0] {
+	case "stats":
+		if len(args) >= 2 && args[1] == "reset" {
+			resourcePackServer.ResetStats()
+			logger.Info("Reset CDN statistics")
+			return
+		}
+
+		stats := resourcePackServer.Stats()
+		logger.Info("CDN Statistics")
+		logger.Info(fmt.Sprintf("- Requests: %d", stats.Requests))
+		logger.Info(fmt.Sprintf("- Bytes Served: %.2f MB", float64(stats.BytesServed)/1024/1024))
+		logger.Info(fmt.Sprintf("- Average Response Time: %s", stats.AverageDuration))
+		logger.Info(fmt.Sprintf("- In-flight Downloads: %d", stats.InFlight))
+
+	case "warm":
+		total, skipped, err := resourcePackServer.Warm()
+		if err != nil {
+			logger.Error("Failed to warm the CDN cache", "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Warmed the CDN cache, %.2f MB cached", float64(total)/1024/1024))
+		for _, uuid := range skipped {
+			logger.Info(fmt.Sprintf("- Skipped %s (served from an external URL)", uuid))
+		}
+
+	case "reload-cert":
+		if err := resourcePackServer.ReloadCertificate(); err != nil {
+			logger.Error("Failed to reload CDN certificate, keeping the current one", "error", err)
+			return
+		}
+		logger.Info("Reloaded CDN certificate, it is used from the next connection")
+
+	case "recache":
+		if len(args) >= 2 {
+			size, err := recachePack(proxy.Listener(), conf, args[1])
+			if err != nil {
+				logger.Error("Failed to recache resource pack, keeping the current pack", "uuid", args[1], "error", err)
+				return
+			}
+			logger.Info(fmt.Sprintf("Recached %s (%.2f MB)", args[1], float64(size)/1024/1024))
+			return
+		}
+		// Packs are loaded the same way as on startup, so that content keys and skipped packs are
+		// handled alike and the listener hands out the changed packs to new players.
+		if _, _, _, err := reloadPacks(proxy.Listener(), conf, "", logger); err != nil {
+			logger.Error("Failed to reload resource packs, keeping the current packs", "error", err)
+			return
+		}
+		sizes, err := resourcePackServer.Recache("")
+		if err != nil {
+			logger.Error("Failed to recache resource packs", "error", err)
+			return
+		}
+		for uuid, size := range sizes {
+			logger.Info(fmt.Sprintf("- Recached %s (%.2f MB)", uuid, float64(size)/1024/1024))
+		}
+		logger.Info(fmt.Sprintf("Recached %d resource pack(s)", len(sizes)))
+
+	case "flush-all":
+		before := len(loadedPacks)
+		logger.Info(fmt.Sprintf("Flushing the CDN: %d pack(s) loaded, %.2f MB heap in use", before, heapInUseMB()))
+		cached, err := flushCDN(proxy.Listener(), conf, logger)
+		if err != nil {
+			logger.Error("Failed to reload resource packs, keeping the current packs, the CDN cache is empty and refilled on demand", "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Flushed the CDN: dropped %d cached pack(s), %d pack(s) loaded (was %d), %.2f MB heap in use", cached, len(loadedPacks), before, heapInUseMB()))
+
+	default:
+		logger.Info(fmt.Sprintf("Unknown cdn subcommand: %s", args[0]))
+		logger.Info("Usage: cdn <stats|warm|recache|flush-all|reload-cert> ...")
+	}
+}
+
+// flushCDN drops all content cached by the CDN and reads the resource packs from disk again. It returns
+// the number of packs that were cached.
+func flushCDN(listener packListener, conf *ServerConfig, logger *slog.Logger) (int, error) {
+	cached := resourcePackServer.Flush()
+	if _, _, _, err := reloadPacks(listener, conf, "", logger); err != nil {
+		return cached, err
+	}
+	return cached, nil
+}
+
+// heapInUseMB returns the heap memory in use after a garbage collection, in megabytes.
+func heapInUseMB() float64 {
+	runtime.GC()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return float64(memStats.HeapInuse) / 1024 / 1024
+}
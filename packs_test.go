@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+// fakePackListener records the resource packs added to and removed from it.
+type fakePackListener struct {
+	added, removed []string
+}
+
+func (l *fakePackListener) AddResourcePack(pack *resource.Pack) {
+	l.added = append(l.added, pack.UUID().String())
+}
+
+func (l *fakePackListener) RemoveResourcePack(uuid string) {
+	l.removed = append(l.removed, uuid)
+}
+
+// useLoadedPacks loads the packs in the working directory as the packs of the proxy for the duration of
+// the test and returns their UUIDs by name.
+func useLoadedPacks(t *testing.T) map[string]string {
+	t.Helper()
+	previous := loadedPacks
+	t.Cleanup(func() { loadedPacks = previous })
+
+	packs, err := parse(nil, PackLimits{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedPacks = packs
+	uuids := make(map[string]string, len(packs))
+	for _, pack := range packs {
+		uuids[pack.Name()] = pack.UUID().String()
+	}
+	return uuids
+}
+
+// changeTestPack changes the content of a pack written by writeTestPack in dir, keeping its UUID.
+func changeTestPack(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "resource_packs", name, "content.bin"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checksums returns the checksums of the loaded packs by name.
+func checksums() map[string][32]byte {
+	sums := make(map[string][32]byte, len(loadedPacks))
+	for _, pack := range loadedPacks {
+		sums[pack.Name()] = pack.Checksum()
+	}
+	return sums
+}
+
+func TestReloadPacks(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      string
+		wantAdded   []string
+		wantUpdated []string
+		wantErr     bool
+	}{
+		{name: "all servers", wantAdded: []string{"pack2"}, wantUpdated: []string{"pack0", "pack1"}},
+		{name: "single server", server: "island", wantUpdated: []string{"pack1"}},
+		{name: "server without packs", server: "lobby", wantErr: true},
+		{name: "unknown server", server: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestPack(t, dir, "pack0", 1000)
+			writeTestPack(t, dir, "pack1", 1000)
+			t.Chdir(dir)
+			uuids := useLoadedPacks(t)
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134", Packs: []string{uuids["pack1"]}})
+
+			before := checksums()
+			changeTestPack(t, dir, "pack0")
+			changeTestPack(t, dir, "pack1")
+			writeTestPack(t, dir, "pack2", 1000)
+
+			listener := &fakePackListener{}
+			added, removed, updated, err := reloadPacks(listener, &ServerConfig{}, tt.server, slog.New(slog.DiscardHandler))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("reloadPacks succeeded, want an error")
+				}
+				if !maps.Equal(checksums(), before) || len(listener.added)+len(listener.removed) != 0 {
+					t.Fatal("packs changed after a failed reload")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// pack2 was written after the packs were loaded, its UUID is known once it is loaded.
+			for _, pack := range loadedPacks {
+				uuids[pack.Name()] = pack.UUID().String()
+			}
+			var wantAdded, wantUpdated []string
+			for _, name := range tt.wantAdded {
+				wantAdded = append(wantAdded, uuids[name])
+			}
+			for _, name := range tt.wantUpdated {
+				wantUpdated = append(wantUpdated, uuids[name])
+			}
+			if len(loadedPacks) != 2+len(tt.wantAdded) {
+				t.Fatalf("%d pack(s) loaded, want %d", len(loadedPacks), 2+len(tt.wantAdded))
+			}
+			slices.Sort(added)
+			slices.Sort(updated)
+			slices.Sort(wantUpdated)
+			if !slices.Equal(added, wantAdded) || len(removed) != 0 || !slices.Equal(updated, wantUpdated) {
+				t.Fatalf("reloadPacks() added %v, removed %v, updated %v, want added %v, updated %v", added, removed, updated, wantAdded, wantUpdated)
+			}
+
+			after := checksums()
+			for name, sum := range before {
+				if changed, want := after[name] != sum, slices.Contains(tt.wantUpdated, name); changed != want {
+					t.Errorf("%s changed = %v, want %v", name, changed, want)
+				}
+			}
+			wantListener := append(slices.Clone(wantUpdated), wantAdded...)
+			slices.Sort(wantListener)
+			slices.Sort(listener.added)
+			slices.Sort(listener.removed)
+			if !slices.Equal(listener.added, wantListener) || !slices.Equal(listener.removed, wantUpdated) {
+				t.Fatalf("listener got packs %v added and %v removed, want %v and %v", listener.added, listener.removed, wantListener, wantUpdated)
+			}
+		})
+	}
+}
+
+// useCDN serves the loaded packs from a CDN for the duration of the test. Downloads from the CDN fail if
+// failing is true.
+func useCDN(t *testing.T, failing bool) {
+	t.Helper()
+	server, baseURL := resourcePackServer, cdnBaseURL
+	t.Cleanup(func() { resourcePackServer, cdnBaseURL = server, baseURL })
+
+	s, err := NewResourcePackServer(loadedPacks, 0, nil, CdnSocket{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(s.handleRequest)
+	if failing {
+		handler = func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) }
+	}
+	cdn := httptest.NewServer(handler)
+	t.Cleanup(cdn.Close)
+	resourcePackServer, cdnBaseURL = s, cdn.URL
+}
+
+func TestReloadPacksThroughCDN(t *testing.T) {
+	tests := []struct {
+		name    string
+		failing bool
+	}{
+		{name: "CDN reachable"},
+		{name: "CDN unreachable", failing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestPack(t, dir, "pack0", 1000)
+			t.Chdir(dir)
+			uuids := useLoadedPacks(t)
+			useCDN(t, tt.failing)
+
+			before := checksums()
+			changeTestPack(t, dir, "pack0")
+			listener := &fakePackListener{}
+			_, _, updated, err := reloadPacks(listener, &ServerConfig{}, "", slog.New(slog.DiscardHandler))
+			if tt.failing {
+				if err == nil {
+					t.Fatal("reloadPacks succeeded, want an error")
+				}
+				if !maps.Equal(checksums(), before) || len(listener.added)+len(listener.removed) != 0 {
+					t.Fatal("packs changed after the CDN failed")
+				}
+				resourcePackServer.packMutex.RLock()
+				defer resourcePackServer.packMutex.RUnlock()
+				if resourcePackServer.packs[uuids["pack0"]].Checksum() != before["pack0"] {
+					t.Fatal("the CDN serves the new pack after the CDN failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(updated, []string{uuids["pack0"]}) || !slices.Equal(listener.added, updated) {
+				t.Fatalf("reloadPacks() updated %v and added %v to the listener, want pack0", updated, listener.added)
+			}
+		})
+	}
+}
+
+func TestRecachePack(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPack(t, dir, "pack0", 1000)
+	writeTestPack(t, dir, "pack1", 1000)
+	t.Chdir(dir)
+	uuids := useLoadedPacks(t)
+	useCDN(t, false)
+	if _, _, err := resourcePackServer.Warm(); err != nil {
+		t.Fatal(err)
+	}
+	cached := func(uuid string) []byte {
+		resourcePackServer.contentCacheMutex.RLock()
+		defer resourcePackServer.contentCacheMutex.RUnlock()
+		return resourcePackServer.contentCache[uuid]
+	}
+	before := checksums()
+	unchanged := cached(uuids["pack1"])
+
+	changeTestPack(t, dir, "pack0")
+	changeTestPack(t, dir, "pack1")
+	listener := &fakePackListener{}
+	size, err := recachePack(listener, &ServerConfig{}, uuids["pack0"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := checksums()
+	if after["pack0"] == before["pack0"] || after["pack1"] != before["pack1"] {
+		t.Fatal("recachePack didn't reload only pack0")
+	}
+	var pack *resource.Pack
+	for _, p := range loadedPacks {
+		if p.Name() == "pack0" {
+			pack = p
+		}
+	}
+	want := make([]byte, pack.Len())
+	if _, err := pack.ReadAt(want, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := cached(uuids["pack0"]); !slices.Equal(got, want) || size != len(want) {
+		t.Fatalf("cached %d bytes of pack0 and reported %d, want the %d bytes of the changed pack", len(got), size, len(want))
+	}
+	if got := cached(uuids["pack1"]); &got[0] != &unchanged[0] {
+		t.Error("recachePack replaced the cached content of pack1")
+	}
+	if !slices.Equal(listener.added, []string{uuids["pack0"]}) || !slices.Equal(listener.removed, []string{uuids["pack0"]}) {
+		t.Fatalf("listener got packs %v added and %v removed, want pack0", listener.added, listener.removed)
+	}
+
+	if _, err := recachePack(listener, &ServerConfig{}, "00000000-0000-4000-8000-000000000000"); err == nil {
+		t.Fatal("recachePack succeeded for a pack that is not loaded")
+	}
+}
+
+func TestPackURLs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPack(t, dir, "pack0", 1000)
+	writeTestPack(t, dir, "pack1", 1000)
+	t.Chdir(dir)
+	uuids := useLoadedPacks(t)
+
+	t.Run("CDN disabled", func(t *testing.T) {
+		baseURL := cdnBaseURL
+		t.Cleanup(func() { cdnBaseURL = baseURL })
+		cdnBaseURL = ""
+		logs := captureLogs(t)
+		handlePacksCommand([]string{"urls"}, nil, &ServerConfig{})
+		if !strings.Contains(logs.String(), "sent to clients directly") || strings.Contains(logs.String(), "http") {
+			t.Fatalf("packs urls logged %q, want the packs reported as sent directly", logs.String())
+		}
+	})
+	t.Run("CDN enabled", func(t *testing.T) {
+		useCDN(t, false)
+		modified, err := ModifyResourcePackForCDN(loadedPacks, cdnBaseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pack := range modified {
+			if want := cdnBaseURL + "/" + uuids[pack.Name()]; pack.DownloadURL() != want {
+				t.Errorf("pack %s is downloaded from %s, want %s", pack.Name(), pack.DownloadURL(), want)
+			}
+		}
+
+		logs := captureLogs(t)
+		handlePacksCommand([]string{"urls"}, nil, &ServerConfig{})
+		for name, uuid := range uuids {
+			if want := fmt.Sprintf("%s (%s): %s/%s", name, uuid, cdnBaseURL, uuid); !strings.Contains(logs.String(), want) {
+				t.Errorf("packs urls logged %q, want %q", logs.String(), want)
+			}
+		}
+	})
+}
+
+func TestNotifyPackRefresh(t *testing.T) {
+	const message = "Reconnect to get the updated resource packs"
+	transport := &fakeTransport{}
+	steve, steveClient := newTestSession(t, "1", "Steve", transport)
+	alex, alexClient := newTestSession(t, "2", "Alex", transport)
+	left, _ := newTestSession(t, "3", "Herobrine", transport)
+	left.Disconnect("left")
+
+	if sent := notifyPackRefresh([]*session.Session{steve, alex, left}, message); sent != 2 {
+		t.Errorf("notified %d players, want the 2 players still connected", sent)
+	}
+	for name, client := range map[string]*minecraft.Conn{"Steve": steveClient, "Alex": alexClient} {
+		if got, _ := nextMessage(t, client); got != message {
+			t.Errorf("%s got %q, want the refresh prompt", name, got)
+		}
+	}
+}
+
+func TestContentKeys(t *testing.T) {
+	const key = "0123456789abcdef0123456789abcdef"
+	dir := t.TempDir()
+	writeTestPack(t, dir, "keyed", 1000)
+	writeTestPack(t, dir, "plain", 1000)
+	t.Chdir(dir)
+	uuids := useLoadedPacks(t)
+
+	packs, err := parse(map[string]string{uuids["keyed"]: key}, PackLimits{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedPacks = packs
+	for _, pack := range packs {
+		if want := pack.Name() == "keyed"; pack.Encrypted() != want || (want && pack.ContentKey() != key) {
+			t.Errorf("pack %s is encrypted: %v with key %q, want the configured key applied to keyed only", pack.Name(), pack.Encrypted(), pack.ContentKey())
+		}
+	}
+
+	// Packs downloaded from the CDN are still encrypted, so clients need the key of the original pack.
+	useCDN(t, false)
+	modified, err := ModifyResourcePackForCDN(packs, cdnBaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pack := range modified {
+		if want := pack.Name() == "keyed"; pack.Encrypted() != want || (want && pack.ContentKey() != key) {
+			t.Errorf("CDN pack %s is encrypted: %v with key %q, want the key kept for keyed only", pack.Name(), pack.Encrypted(), pack.ContentKey())
+		}
+	}
+	for _, pack := range packs {
+		resp := getPack(t, resourcePackServer, pack, nil)
+		if want := fmt.Sprintf("attachment; filename=%s.mcpack", pack.UUID()); resp.Header.Get("Content-Disposition") != want {
+			t.Errorf("pack %s served as %q, want %q", pack.Name(), resp.Header.Get("Content-Disposition"), want)
+		}
+	}
+}
+
+func TestFlushCDN(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPack(t, dir, "pack0", 1000)
+	writeTestPack(t, dir, "pack1", 1000)
+	t.Chdir(dir)
+	useLoadedPacks(t)
+	useCDN(t, false)
+	if _, _, err := resourcePackServer.Warm(); err != nil {
+		t.Fatal(err)
+	}
+
+	changeTestPack(t, dir, "pack0")
+	if err := os.RemoveAll(filepath.Join(dir, "resource_packs", "pack1")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestPack(t, dir, "pack2", 1000)
+	cached, err := flushCDN(&fakePackListener{}, &ServerConfig{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != 2 {
+		t.Errorf("flushed %d cached packs, want 2", cached)
+	}
+
+	// The cache is rebuilt from the packs read from disk, holding nothing of the packs before the flush.
+	resourcePackServer.contentCacheMutex.RLock()
+	defer resourcePackServer.contentCacheMutex.RUnlock()
+	if len(resourcePackServer.contentCache) != len(loadedPacks) {
+		t.Fatalf("%d packs cached after the flush, want the %d loaded packs", len(resourcePackServer.contentCache), len(loadedPacks))
+	}
+	for _, pack := range loadedPacks {
+		want := make([]byte, pack.Len())
+		if _, err := pack.ReadAt(want, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := resourcePackServer.contentCache[pack.UUID().String()]; !slices.Equal(got, want) {
+			t.Errorf("cached %d bytes of %s, want the %d bytes read from disk", len(got), pack.Name(), len(want))
+		}
+		if resourcePackServer.packs[pack.UUID().String()] != pack {
+			t.Errorf("the CDN doesn't serve the loaded pack %s", pack.Name())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// defaultDenyMessage is sent to players denied access to a server without a deny message configured.
+const defaultDenyMessage = "§cYou don't have permission to join {server}."
+
+// errTransferDenied is returned by transfers to a server the player is not allowed to join.
+var errTransferDenied = errors.New("player is not allowed to join this server")
+
+// canJoinServer reports if the player with the given XUID and display name may join the named server,
+// and returns the message to show the player if not. Servers without an allow list can be joined by
+// everyone.
+func canJoinServer(name, xuid, displayName string) (bool, string) {
+	srv, ok := serverRegistry.Get(name)
+	if !ok || len(srv.Allowed) == 0 || slices.Contains(srv.Allowed, xuid) || slices.Contains(srv.Allowed, displayName) {
+		return true, ""
+	}
+	message := srv.DenyMessage
+	if message == "" {
+		message = defaultDenyMessage
+	}
+	return false, strings.ReplaceAll(message, "{server}", name)
+}
+
+// sessionCanJoinServer is canJoinServer for the player of a session, who may be an observer. Observers
+// can join every server.
+func sessionCanJoinServer(name string, authenticated bool, xuid, displayName string) (bool, string) {
+	if observerXUID(authenticated, xuid) {
+		return true, ""
+	}
+	return canJoinServer(name, xuid, displayName)
+}
+
+// denyIfNotAllowed tells the player of s why they can't join the named server and returns true if they
+// are not allowed to join it. Observers are allowed to join every server.
+func denyIfNotAllowed(s *session.Session, server string) bool {
+	identity := s.Client().IdentityData()
+	ok, message := sessionCanJoinServer(server, s.Client().Authenticated(), identity.XUID, identity.DisplayName)
+	if !ok {
+		_ = sendMessage(s, localize(s, "join_denied", message, "{server}", server))
+	}
+	return !ok
+}
+
+// permissionHook returns a PreTransferHook that cancels transfers to servers the player is not allowed to
+// join, telling the player why.
+func permissionHook() PreTransferHook {
+	return func(s *session.Session, server string) error {
+		if denyIfNotAllowed(s, server) {
+			return errTransferDenied
+		}
+		return nil
+	}
+}
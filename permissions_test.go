@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestObserverBypassesDenial(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticated bool
+		xuid          string
+		want          bool
+	}{
+		{name: "observer", authenticated: true, xuid: "1", want: true},
+		{name: "regular player", authenticated: true, xuid: "2"},
+		{name: "unauthenticated observer XUID", xuid: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "staff", Addr: "127.0.0.1:19134", Allowed: []string{"3"}, DenyMessage: "No access to {server}"})
+			t.Cleanup(func() { observers.Set(nil) })
+			observers.Set([]string{"1"})
+
+			ok, message := sessionCanJoinServer("staff", tt.authenticated, tt.xuid, "Steve")
+			if ok != tt.want {
+				t.Fatalf("sessionCanJoinServer(staff) = %v, want %v", ok, tt.want)
+			}
+			if !ok && message != "No access to staff" {
+				t.Errorf("denied with message %q, want the deny message of the server", message)
+			}
+			if ok, _ := sessionCanJoinServer("lobby", tt.authenticated, tt.xuid, "Steve"); !ok {
+				t.Error("denied joining a server without an allow list")
+			}
+		})
+	}
+}
+
+func TestTransferEntryPointsDenied(t *testing.T) {
+	const staff = "127.0.0.1:19134"
+	tests := []struct {
+		name     string
+		transfer func(s *session.Session) error
+	}{
+		{name: "player command", transfer: func(s *session.Session) error {
+			NewPlayerCommandProcessor(s, &ServerConfig{}, slog.New(slog.DiscardHandler)).handle([]string{"server", "staff"})
+			return nil
+		}},
+		{name: "backend transfer", transfer: func(s *session.Session) error {
+			p := &TransferProcessor{s: s, conf: &ServerConfig{}, registry: session.NewRegistry(), log: slog.New(slog.DiscardHandler)}
+			var pk packet.Packet = &packet.Transfer{Address: "staff"}
+			ctx := session.NewContext()
+			p.ProcessServer(ctx, &pk)
+			if !ctx.Cancelled() {
+				t.Error("the transfer packet was forwarded to the client")
+			}
+			return nil
+		}},
+		{name: "console or API transfer", transfer: func(s *session.Session) error {
+			return transferSession(s, "staff", staff)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "staff", Addr: staff, Allowed: []string{"3"}, DenyMessage: "No access to {server}"})
+			useTransferHooks(t)
+			RegisterPreTransferHook(permissionHook())
+			transport := &fakeTransport{}
+			s, client := newTestSession(t, "2", "Steve", transport)
+
+			if err := tt.transfer(s); err != nil && !errors.Is(err, errTransferDenied) {
+				t.Fatalf("transfer failed with %v, want it denied", err)
+			}
+			if message, _ := nextMessage(t, client); message != "No access to staff" {
+				t.Errorf("player got %q, want the deny message of the server", message)
+			}
+			if got := transport.dialed(); len(got) != 0 {
+				t.Errorf("dialed %v, want no connection to the denied server", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// PlayerCommands configures the commands players can run on the proxy from chat.
+type PlayerCommands struct {
+	// Enabled enables player commands.
+	Enabled bool `toml:"enabled"`
+	// Prefix is the prefix of proxy commands, e.g. "#" for "#server" or "/proxy " for "/proxy server".
+	// Messages without the prefix are passed on to the backend.
+	Prefix string `toml:"prefix"`
+}
+
+// backendCommands are common backend commands that a command prefix must not shadow.
+var backendCommands = []string{
+	"help", "list", "me", "msg", "tell", "w", "say", "tp", "teleport", "give", "gamemode", "kill", "kick",
+	"ban", "op", "deop", "stop", "time", "weather", "effect", "enchant", "spawn", "home", "server",
+}
+
+// validateCommandPrefix checks that prefix is not empty and doesn't catch commands meant for the backend.
+func validateCommandPrefix(prefix string) error {
+	if strings.TrimSpace(prefix) == "" {
+		return errors.New("command prefix must not be empty")
+	}
+	if name, ok := strings.CutPrefix(prefix, "/"); ok {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return errors.New("command prefix \"/\" would catch every backend command")
+		}
+		for _, cmd := range backendCommands {
+			if strings.HasPrefix(cmd, name) || strings.HasPrefix(name, cmd) {
+				return fmt.Errorf("command prefix %q clashes with the backend command /%s", prefix, cmd)
+			}
+		}
+	}
+	return nil
+}
+
+// PlayerCommandProcessor implements session.Processor by intercepting chat messages and commands starting
+// with the configured prefix and running them as proxy commands. Everything else is passed to the backend.
+type PlayerCommandProcessor struct {
+	session.NopProcessor
+	s    *session.Session
+	conf *ServerConfig
+	log  *slog.Logger
+}
+
+// NewPlayerCommandProcessor creates a PlayerCommandProcessor for the session s.
+func NewPlayerCommandProcessor(s *session.Session, conf *ServerConfig, log *slog.Logger) *PlayerCommandProcessor {
+	return &PlayerCommandProcessor{s: s, conf: conf, log: log}
+}
+
+// ProcessClient is called before forwarding the client-sent packets to the server.
+func (p *PlayerCommandProcessor) ProcessClient(ctx *session.Context, pk *packet.Packet) {
+	var line string
+	switch pk := (*pk).(type) {
+	case *packet.Text:
+		line = pk.Message
+	case *packet.CommandRequest:
+		line = pk.CommandLine
+	default:
+		return
+	}
+
+	command, ok := strings.CutPrefix(line, p.conf.PlayerCommands.Prefix)
+	if !ok {
+		return
+	}
+	ctx.Cancel()
+	go p.handle(strings.Fields(command))
+}
+
+// handle runs the proxy command with the given arguments for the player.
+func (p *PlayerCommandProcessor) handle(args []string) {
+	prefix := p.conf.PlayerCommands.Prefix
+	if len(args) == 0 || args[0] != "server" {
+		_ = sendMessage(p.s, fmt.Sprintf("§cUnknown command, use %sserver [name]", prefix))
+		return
+	}
+
+	if len(args) == 1 {
+		current := currentServerName(p.s.Client().IdentityData().XUID)
+		_ = sendMessage(p.s, fmt.Sprintf("§eYou are connected to %s", current))
+		return
+	}
+
+	name, addr, err := resolveTarget(args[1])
+	if err != nil {
+		_ = sendMessage(p.s, fmt.Sprintf("§c%s", err))
+		return
+	}
+	if denyIfNotAllowed(p.s, name) {
+		return
+	}
+	if serverFullFor(p.s, name, addr) {
+		pos := joinQueue.Enqueue(name, p.s)
+		_ = sendMessage(p.s, queuedMessage(p.s, name, pos))
+		return
+	}
+	// The command is handled on the packet loop of the client, which must not wait for the transfer.
+	go func() {
+		if err := transferSession(p.s, name, addr); err != nil {
+			p.log.Error("failed to transfer", "err", err, "server", name)
+			_ = sendMessage(p.s, fmt.Sprintf("§cCould not connect you to %s", name))
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestValidateCommandPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		wantErr bool
+	}{
+		{prefix: "#"},
+		{prefix: "/proxy "},
+		{prefix: "!p "},
+		{prefix: "", wantErr: true},
+		{prefix: " ", wantErr: true},
+		{prefix: "/", wantErr: true},
+		{prefix: "/ ", wantErr: true},
+		{prefix: "/server ", wantErr: true},
+		{prefix: "/tpa", wantErr: true},
+		{prefix: "/h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if err := validateCommandPrefix(tt.prefix); (err != nil) != tt.wantErr {
+				t.Fatalf("validateCommandPrefix(%q) error = %v, wantErr %v", tt.prefix, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlayerCommandProcessorIntercepts(t *testing.T) {
+	tests := []struct {
+		name          string
+		prefix        string
+		pk            packet.Packet
+		wantIntercept bool
+	}{
+		{name: "prefixed chat", prefix: "#", pk: &packet.Text{Message: "#server"}, wantIntercept: true},
+		{name: "chat", prefix: "#", pk: &packet.Text{Message: "hello #server"}},
+		{name: "backend command", prefix: "#", pk: &packet.CommandRequest{CommandLine: "/server"}},
+		{name: "prefixed command", prefix: "/proxy ", pk: &packet.CommandRequest{CommandLine: "/proxy server"}, wantIntercept: true},
+		{name: "command sharing the start of the prefix", prefix: "/proxy ", pk: &packet.CommandRequest{CommandLine: "/proxyinfo"}},
+		{name: "other packet", prefix: "#", pk: &packet.Animate{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+			serverTracker.Set("1", "127.0.0.1:19133")
+			s, client := newTestSession(t, "1", "Steve", &fakeTransport{})
+			conf := &ServerConfig{PlayerCommands: PlayerCommands{Enabled: true, Prefix: tt.prefix}}
+			p := NewPlayerCommandProcessor(s, conf, slog.New(slog.DiscardHandler))
+
+			ctx := session.NewContext()
+			p.ProcessClient(ctx, &tt.pk)
+			if ctx.Cancelled() != tt.wantIntercept {
+				t.Fatalf("intercepted: %v, want %v", ctx.Cancelled(), tt.wantIntercept)
+			}
+			if tt.wantIntercept {
+				if message, _ := nextMessage(t, client); message != "§eYou are connected to lobby" {
+					t.Fatalf("player got %q, want the reply of the proxy command", message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// disconnectMessage is a message shown on the disconnect screen.
+type disconnectMessage struct {
+	// key is the key of the message in the message catalog.
+	key string
+	// template is the configured message, used if the catalog has no message for the key.
+	template string
+	// sample holds example values for the placeholders of the message, as placeholder and value pairs.
+	sample []string
+}
+
+// disconnectMessages returns the disconnect messages players may see, by scenario.
+func disconnectMessages(conf *ServerConfig) map[string]disconnectMessage {
+	return map[string]disconnectMessage{
+		"full":                {key: "proxy_full", template: conf.JoinFull.ProxyFullMessage},
+		"lobby-full":          {key: "lobby_full", template: conf.JoinFull.LobbyFullMessage},
+		"lobby-down":          {key: "lobby_down", template: conf.LobbyFailover.Message},
+		"banned":              {key: "firewall_blocked", template: conf.Firewall.Message},
+		"throttled":           {key: "connection_throttled", template: conf.ConnectionThrottle.Message, sample: []string{"{cooldown}", "7"}},
+		"login-rate":          {key: "login_rate", template: conf.LoginRate.Message},
+		"name-rejected":       {key: "name_rejected", template: conf.DisplayNames.RejectMessage},
+		"unsupported-version": {key: "unsupported_version", template: conf.UnsupportedVersion.Message, sample: []string{"{client}", "1.20.80", "{required}", protocol.CurrentVersion}},
+		"transfer-failed":     {key: "transfer_failed", template: conf.TransferFailure.Message},
+		"draining":            {key: "draining", template: conf.Drain.JoinMessage},
+		"maintenance":         {key: "maintenance", template: conf.Maintenance.Message},
+		"not-whitelisted":     {key: "not_whitelisted", template: conf.Whitelist.Message},
+		"player-banned":       {key: "banned", template: conf.Bans.Message, sample: []string{"{reason}", "Cheating", "{expires}", "72h0m0s"}},
+		"shutdown":            {template: conf.ShutdownMessage},
+	}
+}
+
+// handlePreviewDisconnectCommand prints the disconnect message of a scenario as a player would see it,
+// in the given language or the default language.
+func handlePreviewDisconnectCommand(args []string, conf *ServerConfig) {
+	logger := slog.Default()
+	messages := disconnectMessages(conf)
+	types := slices.Sorted(maps.Keys(messages))
+	if len(args) == 0 {
+		logger.Info("Usage: preview-disconnect <type> [language]")
+		logger.Info(fmt.Sprintf("Types: %s", strings.Join(types, ", ")))
+		return
+	}
+
+	m, ok := messages[args[0]]
+	if !ok {
+		logger.Info(fmt.Sprintf("Unknown disconnect type: %s", args[0]))
+		logger.Info(fmt.Sprintf("Types: %s", strings.Join(types, ", ")))
+		return
+	}
+	lang := conf.Locale.DefaultLanguage
+	if len(args) >= 2 {
+		lang = args[1]
+	}
+
+	message := m.template
+	if m.key != "" {
+		message = localizeLang(lang, m.key, m.template, m.sample...)
+	}
+	logger.Info(fmt.Sprintf("Disconnect message for %s (%s):", args[0], lang))
+	for _, line := range strings.Split(message, "\n") {
+		logger.Info(line)
+	}
+}
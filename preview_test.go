@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreviewDisconnect(t *testing.T) {
+	catalog := messageCatalog
+	t.Cleanup(func() { messageCatalog = catalog })
+	messageCatalog = nil
+
+	conf := defaultConfig()
+	for name, m := range disconnectMessages(conf) {
+		t.Run(name, func(t *testing.T) {
+			if m.template == "" {
+				t.Fatal("the default config has no message")
+			}
+			logs := captureLogs(t)
+			handlePreviewDisconnectCommand([]string{name}, conf)
+			out := logs.String()
+			if !strings.Contains(out, "Disconnect message for "+name+" ("+conf.Locale.DefaultLanguage+")") {
+				t.Fatalf("the message was not previewed:\n%s", out)
+			}
+			if strings.Contains(out, "{") {
+				t.Fatalf("the message has placeholders left:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestPreviewDisconnectLanguage(t *testing.T) {
+	catalog := messageCatalog
+	t.Cleanup(func() { messageCatalog = catalog })
+	c, err := LoadMessageCatalog(writeTestCatalog(t, "[de]\nconnection_throttled = \"Warte {cooldown} Sekunden\""), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageCatalog = c
+
+	logs := captureLogs(t)
+	handlePreviewDisconnectCommand([]string{"throttled", "de_DE"}, defaultConfig())
+	if !strings.Contains(logs.String(), "Warte 7 Sekunden") {
+		t.Fatalf("the localized message was not previewed:\n%s", logs)
+	}
+}
+
+func TestPreviewDisconnectUnknownType(t *testing.T) {
+	logs := captureLogs(t)
+	handlePreviewDisconnectCommand([]string{"kicked"}, defaultConfig())
+	if !strings.Contains(logs.String(), "Unknown disconnect type: kicked") {
+		t.Fatalf("the unknown type was not reported:\n%s", logs)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ProcessorChain implements session.Processor by forwarding every call to a list of processors in order.
+// Spectrum only allows a single processor per session, so the chain is used to combine e.g. Oomph and the
+// TransferProcessor. Once a processor cancels the context, the remaining processors are skipped.
+type ProcessorChain struct {
+	processors []session.Processor
+}
+
+// NewProcessorChain creates a new ProcessorChain calling the given processors in order.
+func NewProcessorChain(processors ...session.Processor) *ProcessorChain {
+	return &ProcessorChain{processors: processors}
+}
+
+func (c *ProcessorChain) ProcessStartGame(ctx *session.Context, data *minecraft.GameData) {
+	for _, p := range c.processors {
+		if p.ProcessStartGame(ctx, data); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessServer(ctx *session.Context, pk *packet.Packet) {
+	for _, p := range c.processors {
+		if p.ProcessServer(ctx, pk); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessServerEncoded(ctx *session.Context, pk *[]byte) {
+	for _, p := range c.processors {
+		if p.ProcessServerEncoded(ctx, pk); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessClient(ctx *session.Context, pk *packet.Packet) {
+	for _, p := range c.processors {
+		if p.ProcessClient(ctx, pk); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessClientEncoded(ctx *session.Context, pk *[]byte) {
+	for _, p := range c.processors {
+		if p.ProcessClientEncoded(ctx, pk); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessFlush(ctx *session.Context) {
+	for _, p := range c.processors {
+		if p.ProcessFlush(ctx); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessPreTransfer(ctx *session.Context, origin *string, target *string) {
+	for _, p := range c.processors {
+		if p.ProcessPreTransfer(ctx, origin, target); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessTransferFailure(ctx *session.Context, origin *string, target *string) {
+	for _, p := range c.processors {
+		if p.ProcessTransferFailure(ctx, origin, target); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessPostTransfer(ctx *session.Context, origin *string, target *string) {
+	for _, p := range c.processors {
+		if p.ProcessPostTransfer(ctx, origin, target); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessCache(ctx *session.Context, new *[]byte) {
+	for _, p := range c.processors {
+		if p.ProcessCache(ctx, new); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+func (c *ProcessorChain) ProcessDisconnection(ctx *session.Context, message *string) {
+	for _, p := range c.processors {
+		if p.ProcessDisconnection(ctx, message); ctx.Cancelled() {
+			return
+		}
+	}
+}
+
+var _ session.Processor = &ProcessorChain{}
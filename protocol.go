@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// handleProtocolCommand prints the protocol version the proxy accepts and the versions of clients turned
+// away for their version, which is the first thing to check after a game update. Backends are reached
+// through the spectrum transport, which doesn't exchange protocol versions. They always receive the
+// packets of the protocol version the proxy accepts, so for backends only reachability can be shown.
+func handleProtocolCommand() {
+	logger := slog.Default()
+	logger.Info(fmt.Sprintf("Protocol: %d (Minecraft %s)", protocol.CurrentProtocol, protocol.CurrentVersion))
+
+	if rejections := rejectedVersions.All(); len(rejections) > 0 {
+		logger.Info("Clients turned away for their version:")
+		for _, r := range rejections {
+			logger.Warn(fmt.Sprintf("- protocol %d (Minecraft %s): %d client(s), last %s ago, %s",
+				r.Protocol, r.Version, r.Count, time.Since(r.Last).Round(time.Second), versionMismatch(r.Protocol)))
+		}
+	}
+
+	if healthChecker == nil {
+		return
+	}
+
+	servers := serverRegistry.All()
+
+	logger.Info("Backend protocol versions are not reported over the spectrum transport")
+	for _, result := range healthChecker.ProbeAll(servers, len(servers)) {
+		if result.Err != nil {
+			logger.Warn(fmt.Sprintf("- %s (%s): unreachable", result.Name, result.Addr), "error", result.Err)
+			continue
+		}
+		logger.Info(fmt.Sprintf("- %s (%s): reachable, protocol unknown", result.Name, result.Addr))
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// joinQueue holds the players waiting for a slot on a full server.
+var joinQueue = NewQueueManager()
+
+// QueueManager manages per-server FIFO queues of sessions waiting to join a full server.
+type QueueManager struct {
+	mu     sync.Mutex
+	queues map[string][]queuedSession
+}
+
+// queuedSession is a session waiting in a queue, with the XUID it is looked up by.
+type queuedSession struct {
+	xuid string
+	s    *session.Session
+}
+
+// NewQueueManager creates a new, empty QueueManager.
+func NewQueueManager() *QueueManager {
+	return &QueueManager{queues: make(map[string][]queuedSession)}
+}
+
+// Enqueue adds the session to the queue of the named server and returns its 1-based position. A session
+// can only wait for one server at a time, so it is removed from any other queue first.
+func (q *QueueManager) Enqueue(server string, s *session.Session) int {
+	return q.enqueue(server, s.Client().IdentityData().XUID, s)
+}
+
+// enqueue adds the session with the given XUID to the queue of the named server and returns its position.
+func (q *QueueManager) enqueue(server, xuid string, s *session.Session) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(xuid)
+	q.queues[server] = append(q.queues[server], queuedSession{xuid: xuid, s: s})
+	return len(q.queues[server])
+}
+
+// Rename moves the queue of the server named old to the name new.
+func (q *QueueManager) Rename(old, new string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queue, ok := q.queues[old]; ok {
+		q.queues[new] = queue
+		delete(q.queues, old)
+	}
+}
+
+// Remove removes the session with the given XUID from whichever queue it is in and returns the name of
+// that server.
+func (q *QueueManager) Remove(xuid string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.remove(xuid)
+}
+
+// remove removes the session with the given XUID from its queue. q.mu must be held.
+func (q *QueueManager) remove(xuid string) (string, bool) {
+	for server, queue := range q.queues {
+		i := slices.IndexFunc(queue, func(queued queuedSession) bool { return queued.xuid == xuid })
+		if i == -1 {
+			continue
+		}
+		q.queues[server] = slices.Delete(queue, i, i+1)
+		if len(q.queues[server]) == 0 {
+			delete(q.queues, server)
+		}
+		return server, true
+	}
+	return "", false
+}
+
+// Clear empties the queue of the named server and returns the sessions that were in it.
+func (q *QueueManager) Clear(server string) []*session.Session {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queue := q.queues[server]
+	delete(q.queues, server)
+	return queueSessions(queue)
+}
+
+// List returns the sessions queued for the named server, in order.
+func (q *QueueManager) List(server string) []*session.Session {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return queueSessions(q.queues[server])
+}
+
+// queueSessions returns the sessions of a queue.
+func queueSessions(queue []queuedSession) []*session.Session {
+	sessions := make([]*session.Session, len(queue))
+	for i, queued := range queue {
+		sessions[i] = queued.s
+	}
+	return sessions
+}
+
+// Servers returns the names of all servers that currently have a non-empty queue.
+func (q *QueueManager) Servers() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	servers := make([]string, 0, len(q.queues))
+	for server := range q.queues {
+		servers = append(servers, server)
+	}
+	slices.Sort(servers)
+	return servers
+}
+
+// Pop removes and returns the first session in the queue of the named server.
+func (q *QueueManager) Pop(server string) (*session.Session, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queue := q.queues[server]
+	if len(queue) == 0 {
+		return nil, false
+	}
+	q.queues[server] = queue[1:]
+	if len(q.queues[server]) == 0 {
+		delete(q.queues, server)
+	}
+	return queue[0].s, true
+}
+
+// Run moves queued players to their server whenever a slot frees up, checking at the given interval
+// until ctx is done.
+func (q *QueueManager) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, name := range q.Servers() {
+			addr, ok := serverRegistry.Lookup(name)
+			if !ok {
+				for _, s := range q.Clear(name) {
+					_ = sendMessage(s, localize(s, "queue_server_removed", "{server} is no longer available, you have been removed from the queue", "{server}", name))
+				}
+				continue
+			}
+
+			for !serverFull(name, addr) {
+				s, ok := q.Pop(name)
+				if !ok {
+					break
+				}
+				xuid := s.Client().IdentityData().XUID
+				playerName := s.Client().IdentityData().DisplayName
+				// Count the player as connected right away so that the slot isn't handed out twice.
+				previous, _ := serverTracker.Server(xuid)
+				serverTracker.Set(xuid, addr)
+				go func() {
+					if err := transferSession(s, name, addr); err != nil {
+						if previous != "" {
+							serverTracker.Set(xuid, previous)
+						} else {
+							serverTracker.Remove(xuid)
+						}
+						logger.Error("Failed to transfer queued player", "player", playerName, "server", name, "error", err)
+					}
+				}()
+				logger.Info(fmt.Sprintf("Moved %s from the queue to %s", playerName, name))
+			}
+		}
+	}
+}
+
+// queuedMessage returns the message telling the player of s that they were queued for the full server at
+// the given position.
+func queuedMessage(s *session.Session, server string, pos int) string {
+	return localize(s, "queued", "{server} is full, you are #{position} in the queue", "{server}", server, "{position}", strconv.Itoa(pos))
+}
+
+// serverFull returns true if the named server has a player limit that has been reached.
+func serverFull(name, addr string) bool {
+	srv, ok := serverRegistry.Get(name)
+	return ok && srv.MaxPlayers > 0 && serverTracker.Count(addr) >= srv.MaxPlayers
+}
+
+// handleQueueCommand processes the subcommands of the queue command.
+func handleQueueCommand(args []string) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		logger.Info("Usage: queue <list|kick|clear> ...")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		servers := joinQueue.Servers()
+		if len(args) >= 2 {
+			servers = []string{args[1]}
+		}
+		if len(servers) == 0 {
+			logger.Info("No players are queued")
+			return
+		}
+		for _, server := range servers {
+			queue := joinQueue.List(server)
+			logger.Info(fmt.Sprintf("Queue for %s (%d)", server, len(queue)))
+			for i, s := range queue {
+				logger.Info(fmt.Sprintf("%d. %s", i+1, s.Client().IdentityData().DisplayName))
+			}
+		}
+
+	case "kick":
+		if len(args) < 2 {
+			logger.Info("Usage: queue kick <player>")
+			return
+		}
+
+		playerName := args[1]
+		for _, server := range joinQueue.Servers() {
+			for _, s := range joinQueue.List(server) {
+				if s.Client().IdentityData().DisplayName != playerName {
+					continue
+				}
+				joinQueue.Remove(s.Client().IdentityData().XUID)
+				_ = sendMessage(s, localize(s, "queue_kicked", "You have been removed from the queue for {server}", "{server}", server))
+				logger.Info(fmt.Sprintf("Removed %s from the queue for %s", playerName, server))
+				return
+			}
+		}
+		logger.Info(fmt.Sprintf("Player '%s' is not queued", playerName))
+
+	case "clear":
+		if len(args) < 2 {
+			logger.Info("Usage: queue clear <server>")
+			return
+		}
+
+		removed := joinQueue.Clear(args[1])
+		for _, s := range removed {
+			_ = sendMessage(s, localize(s, "queue_cleared", "The queue for {server} has been cleared", "{server}", args[1]))
+		}
+		logger.Info(fmt.Sprintf("Removed %d player(s) from the queue for %s", len(removed), args[1]))
+
+	default:
+		logger.Info(fmt.Sprintf("Unknown queue subcommand: %s", args[0]))
+		logger.Info("Usage: queue <list|kick|clear> ...")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+// queued returns the XUIDs of the sessions queued for the named server, in order.
+func (q *QueueManager) queued(server string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var xuids []string
+	for _, queued := range q.queues[server] {
+		xuids = append(xuids, queued.xuid)
+	}
+	return xuids
+}
+
+func TestQueueManagerEnqueue(t *testing.T) {
+	q := NewQueueManager()
+	tests := []struct {
+		name    string
+		server  string
+		xuid    string
+		wantPos int
+		want    map[string][]string
+	}{
+		{name: "first", server: "island", xuid: "1", wantPos: 1, want: map[string][]string{"island": {"1"}}},
+		{name: "second", server: "island", xuid: "2", wantPos: 2, want: map[string][]string{"island": {"1", "2"}}},
+		{name: "other server", server: "arena", xuid: "3", wantPos: 1, want: map[string][]string{"island": {"1", "2"}, "arena": {"3"}}},
+		{name: "moves to another queue", server: "arena", xuid: "1", wantPos: 2, want: map[string][]string{"island": {"2"}, "arena": {"3", "1"}}},
+		{name: "requeue goes to the back", server: "arena", xuid: "3", wantPos: 2, want: map[string][]string{"island": {"2"}, "arena": {"1", "3"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if pos := q.enqueue(tt.server, tt.xuid, nil); pos != tt.wantPos {
+				t.Fatalf("enqueue(%q, %q) = %d, want %d", tt.server, tt.xuid, pos, tt.wantPos)
+			}
+			for server, want := range tt.want {
+				if got := q.queued(server); !slices.Equal(got, want) {
+					t.Errorf("queue of %s = %v, want %v", server, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueManagerRemove(t *testing.T) {
+	tests := []struct {
+		name        string
+		xuid        string
+		wantServer  string
+		wantOK      bool
+		wantServers []string
+	}{
+		{name: "from the middle", xuid: "2", wantServer: "island", wantOK: true, wantServers: []string{"arena", "island"}},
+		{name: "last of a queue", xuid: "4", wantServer: "arena", wantOK: true, wantServers: []string{"island"}},
+		{name: "not queued", xuid: "5", wantServers: []string{"arena", "island"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueueManager()
+			q.enqueue("island", "1", nil)
+			q.enqueue("island", "2", nil)
+			q.enqueue("island", "3", nil)
+			q.enqueue("arena", "4", nil)
+
+			server, ok := q.Remove(tt.xuid)
+			if server != tt.wantServer || ok != tt.wantOK {
+				t.Fatalf("Remove(%q) = %q, %v, want %q, %v", tt.xuid, server, ok, tt.wantServer, tt.wantOK)
+			}
+			if got := q.Servers(); !slices.Equal(got, tt.wantServers) {
+				t.Fatalf("Servers() = %v, want %v", got, tt.wantServers)
+			}
+			for _, server := range q.Servers() {
+				if slices.Contains(q.queued(server), tt.xuid) {
+					t.Fatalf("%s is still queued for %s", tt.xuid, server)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueManagerPopClearRename(t *testing.T) {
+	q := NewQueueManager()
+	q.enqueue("island", "1", nil)
+	q.enqueue("island", "2", nil)
+	q.enqueue("arena", "3", nil)
+
+	if _, ok := q.Pop("island"); !ok {
+		t.Fatal("Pop found no session in a queue")
+	}
+	if got := q.queued("island"); !slices.Equal(got, []string{"2"}) {
+		t.Fatalf("queue after Pop = %v, want [2]", got)
+	}
+	if removed := q.Clear("arena"); len(removed) != 1 {
+		t.Fatalf("Clear removed %d session(s), want 1", len(removed))
+	}
+	if _, ok := q.Pop("arena"); ok {
+		t.Fatal("Pop found a session in a cleared queue")
+	}
+
+	q.Rename("island", "skyblock")
+	if got := q.Servers(); !slices.Equal(got, []string{"skyblock"}) {
+		t.Fatalf("Servers() after Rename = %v, want [skyblock]", got)
+	}
+	if got := len(q.List("skyblock")); got != 1 {
+		t.Fatalf("%d session(s) in the renamed queue, want 1", got)
+	}
+}
+
+func TestQueueManagerRunFailedTransfer(t *testing.T) {
+	const lobby, island = "127.0.0.1:19133", "127.0.0.1:19134"
+	useServers(t, Server{Name: "lobby", Addr: lobby}, Server{Name: "island", Addr: island, MaxPlayers: 5})
+	useTransferHooks(t)
+	transport := &fakeTransport{}
+	transport.setDown(island, true)
+	joining, _ := newTestSession(t, "1", "Steve", transport)
+	playing, _ := newTestSession(t, "2", "Alex", transport)
+	serverTracker.Set("2", lobby)
+
+	q := NewQueueManager()
+	q.Enqueue("island", joining)
+	q.Enqueue("island", playing)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, 10*time.Millisecond, slog.New(slog.DiscardHandler))
+
+	// The failed transfers restore the players' previous servers, without making up one for players that
+	// weren't on a server yet.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, tracked := serverTracker.Server("1")
+		previous, _ := serverTracker.Server("2")
+		if len(transport.dialed()) == 2 && !tracked && previous == lobby {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("player 1 tracked: %v, player 2 on %q after the transfers failed", tracked, previous)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueueMessagesLocalized(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+	catalog := messageCatalog
+	t.Cleanup(func() { messageCatalog = catalog })
+	c, err := LoadMessageCatalog(writeTestCatalog(t, "[en]\nqueue_cleared = \"Warteschlange für {server} geleert\""), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageCatalog = c
+	queue := joinQueue
+	t.Cleanup(func() { joinQueue = queue })
+	joinQueue = NewQueueManager()
+
+	s, client := newTestSession(t, "1", "Steve", &fakeTransport{})
+	joinQueue.Enqueue("island", s)
+	handleQueueCommand([]string{"clear", "island"})
+	if text, _ := nextMessage(t, client); text != "Warteschlange für island geleert" {
+		t.Fatalf("player was sent %q, want the localized message", text)
+	}
+}
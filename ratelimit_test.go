@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		taken    int
+		elapsed  time.Duration
+		maxWait  time.Duration
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{name: "full bucket", rate: 1, burst: 3, wantOK: true},
+		{name: "last token of burst", rate: 1, burst: 3, taken: 2, wantOK: true},
+		{name: "empty bucket waits", rate: 2, burst: 1, taken: 1, maxWait: time.Second, wantOK: true, wantWait: 500 * time.Millisecond},
+		{name: "empty bucket rejects beyond max wait", rate: 2, burst: 1, taken: 1, maxWait: 100 * time.Millisecond},
+		{name: "empty bucket without waiting", rate: 2, burst: 1, taken: 1},
+		{name: "refilled after elapsed time", rate: 2, burst: 1, taken: 1, elapsed: time.Second, wantOK: true},
+		{name: "refill is capped at burst", rate: 10, burst: 2, taken: 2, elapsed: time.Hour, wantOK: true},
+		{name: "queued waits add up", rate: 1, burst: 1, taken: 2, maxWait: 3 * time.Second, wantOK: true, wantWait: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewTokenBucket(tt.rate, tt.burst)
+			for range tt.taken {
+				if _, ok := b.Reserve(time.Hour); !ok {
+					t.Fatal("failed to take a token while setting up")
+				}
+			}
+			b.last = b.last.Add(-tt.elapsed)
+
+			wait, ok := b.Reserve(tt.maxWait)
+			if ok != tt.wantOK {
+				t.Fatalf("Reserve(%s) ok = %v, want %v", tt.maxWait, ok, tt.wantOK)
+			}
+			// Allow for the time passing between the reservations of the test.
+			if diff := tt.wantWait - wait; diff < 0 || diff > 50*time.Millisecond {
+				t.Fatalf("Reserve(%s) wait = %s, want about %s", tt.maxWait, wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRejectionTakesNoToken(t *testing.T) {
+	b := NewTokenBucket(1, 1)
+	b.Reserve(0)
+	for range 5 {
+		if _, ok := b.Reserve(0); ok {
+			t.Fatal("Reserve succeeded on an empty bucket")
+		}
+	}
+	b.last = b.last.Add(-time.Second)
+	if _, ok := b.Reserve(0); !ok {
+		t.Fatal("rejected reservations consumed tokens")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// recentDisconnects keeps the most recent disconnects. It is replaced at startup with the configured size.
+var recentDisconnects = NewDisconnectLog(50)
+
+// DisconnectRecord describes a player that disconnected from the proxy.
+type DisconnectRecord struct {
+	Name     string
+	XUID     string
+	Reason   string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// DisconnectLog is a bounded log of the most recent disconnects.
+type DisconnectLog struct {
+	mu      sync.Mutex
+	records []DisconnectRecord
+	next    int
+}
+
+// NewDisconnectLog creates a DisconnectLog keeping the last size disconnects.
+func NewDisconnectLog(size int) *DisconnectLog {
+	return &DisconnectLog{records: make([]DisconnectRecord, 0, max(size, 1))}
+}
+
+// Add records a disconnect, replacing the oldest record if the log is full.
+func (l *DisconnectLog) Add(r DisconnectRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) < cap(l.records) {
+		l.records = append(l.records, r)
+	} else {
+		l.records[l.next] = r
+	}
+	l.next = (l.next + 1) % cap(l.records)
+}
+
+// Records returns the recorded disconnects, from the most recent to the oldest.
+func (l *DisconnectLog) Records() []DisconnectRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := make([]DisconnectRecord, 0, len(l.records))
+	for i := 1; i <= len(l.records); i++ {
+		records = append(records, l.records[(l.next-i+len(l.records))%len(l.records)])
+	}
+	return records
+}
+
+// handleRecentCommand lists the most recent disconnects.
+func handleRecentCommand() {
+	logger := slog.Default()
+	records := recentDisconnects.Records()
+	if len(records) == 0 {
+		logger.Info("No recent disconnects")
+		return
+	}
+
+	logger.Info(fmt.Sprintf("Recent Disconnects (%d)", len(records)))
+	for _, r := range records {
+		reason := r.Reason
+		if reason == "" {
+			reason = "left"
+		}
+		logger.Info(fmt.Sprintf("- %s %s (%s) after %s: %s", r.Time.Format(time.TimeOnly), r.Name, r.XUID, r.Duration.Round(time.Second), reason))
+	}
+}
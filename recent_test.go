@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+)
+
+func TestDisconnectLogCaps(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  []string
+	}{
+		{name: "empty", size: 3},
+		{name: "below the size", size: 3, added: 2, want: []string{"1", "0"}},
+		{name: "full", size: 3, added: 3, want: []string{"2", "1", "0"}},
+		{name: "wrapped", size: 3, added: 5, want: []string{"4", "3", "2"}},
+		{name: "size below one", size: 0, added: 2, want: []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDisconnectLog(tt.size)
+			for i := range tt.added {
+				l.Add(DisconnectRecord{XUID: strconv.Itoa(i)})
+			}
+			var got []string
+			for _, r := range l.Records() {
+				got = append(got, r.XUID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisconnectRecorded(t *testing.T) {
+	tests := []struct {
+		name   string
+		joined bool
+	}{
+		{name: "joined", joined: true},
+		{name: "never joined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+			recent := recentDisconnects
+			t.Cleanup(func() { recentDisconnects = recent })
+			recentDisconnects = NewDisconnectLog(10)
+			s, _ := newTestSession(t, "1", "Steve", &fakeTransport{})
+			p := &TransferProcessor{s: s, conf: &ServerConfig{}, registry: session.NewRegistry(), log: slog.New(slog.DiscardHandler), accepted: time.Now().Add(-time.Minute)}
+			p.joined.Store(tt.joined)
+
+			reason := "timed out"
+			p.ProcessDisconnection(nil, &reason)
+			records := recentDisconnects.Records()
+			if !tt.joined {
+				if len(records) != 0 {
+					t.Fatalf("recorded %+v for a session that never joined", records)
+				}
+				return
+			}
+			if len(records) != 1 {
+				t.Fatalf("recorded %d disconnects, want 1", len(records))
+			}
+			if r := records[0]; r.Name != "Steve" || r.XUID != "1" || r.Reason != reason || r.Duration < time.Minute {
+				t.Fatalf("recorded %+v, want the player, the reason and the session duration", r)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// reconnects holds the slots reserved for recently disconnected players.
+var reconnects = NewReconnectReservations()
+
+// reservation is a slot reserved for a disconnected player.
+type reservation struct {
+	addr    string
+	expires time.Time
+}
+
+// ReconnectReservations keeps the slot and last server of disconnected players for a grace window, so
+// that players reconnecting after a network blip return to where they were and aren't rejected because
+// the proxy or their server filled up in the meantime.
+type ReconnectReservations struct {
+	mu           sync.Mutex
+	reservations map[string]reservation
+}
+
+// NewReconnectReservations creates an empty ReconnectReservations.
+func NewReconnectReservations() *ReconnectReservations {
+	return &ReconnectReservations{reservations: make(map[string]reservation)}
+}
+
+// Reserve reserves a slot for the player with the given XUID, who was on the server with the given
+// address, until the grace window ends.
+func (r *ReconnectReservations) Reserve(xuid, addr string, grace time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reservations[xuid] = reservation{addr: addr, expires: time.Now().Add(grace)}
+}
+
+// Reserved reports if the player with the given XUID has a reserved slot.
+func (r *ReconnectReservations) Reserved(xuid string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	_, ok := r.reservations[xuid]
+	return ok
+}
+
+// Take removes the reservation of the player with the given XUID and returns the address of the server
+// they were on.
+func (r *ReconnectReservations) Take(xuid string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	res, ok := r.reservations[xuid]
+	delete(r.reservations, xuid)
+	return res.addr, ok
+}
+
+// Move makes the reservations of players who were on the server at old return them to new, for servers
+// whose address changed.
+func (r *ReconnectReservations) Move(old, new string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for xuid, res := range r.reservations {
+		if res.addr == old {
+			res.addr = new
+			r.reservations[xuid] = res
+		}
+	}
+}
+
+// Count returns the number of reserved slots.
+func (r *ReconnectReservations) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	return len(r.reservations)
+}
+
+// expire removes all expired reservations. r.mu must be held.
+func (r *ReconnectReservations) expire() {
+	now := time.Now()
+	for xuid, res := range r.reservations {
+		if now.After(res.expires) {
+			delete(r.reservations, xuid)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectReservations(t *testing.T) {
+	tests := []struct {
+		name         string
+		grace        time.Duration
+		elapsed      time.Duration
+		wantReserved bool
+	}{
+		{name: "within the grace window", grace: time.Minute, elapsed: 30 * time.Second, wantReserved: true},
+		{name: "expired", grace: time.Minute, elapsed: 2 * time.Minute, wantReserved: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReconnectReservations()
+			r.Reserve("1", "127.0.0.1:19134", tt.grace)
+			r.Reserve("2", "127.0.0.1:19133", time.Hour)
+			// Move the reservation of 1 back in time instead of waiting.
+			res := r.reservations["1"]
+			res.expires = res.expires.Add(-tt.elapsed)
+			r.reservations["1"] = res
+
+			if got := r.Reserved("1"); got != tt.wantReserved {
+				t.Fatalf("Reserved() = %v, want %v", got, tt.wantReserved)
+			}
+			wantCount := 1
+			if tt.wantReserved {
+				wantCount = 2
+			}
+			if got := r.Count(); got != wantCount {
+				t.Fatalf("Count() = %d, want %d", got, wantCount)
+			}
+
+			addr, ok := r.Take("1")
+			if ok != tt.wantReserved || ok && addr != "127.0.0.1:19134" {
+				t.Fatalf("Take() = %q, %v, want the server of the player if reserved", addr, ok)
+			}
+			if _, ok := r.Take("1"); ok {
+				t.Fatal("a reservation can be taken twice")
+			}
+			if got := r.Count(); got != 1 {
+				t.Fatalf("Count() after Take = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestReconnectReservationsHoldSlots(t *testing.T) {
+	const maxPlayers = 4
+	r := NewReconnectReservations()
+	var slots PlayerSlots
+	slots.Take()
+	r.Reserve("1", "127.0.0.1:19134", time.Minute)
+	r.Reserve("2", "127.0.0.1:19134", time.Minute)
+
+	// New players only get the slots that aren't reserved, as in admitPlayer.
+	if !slots.TryTake(maxPlayers - r.Count()) {
+		t.Fatal("no slot for a new player with one slot left")
+	}
+	if slots.TryTake(maxPlayers - r.Count()) {
+		t.Fatal("a new player took a reserved slot")
+	}
+
+	// Once the reservation is taken by the reconnecting player, they take a slot without a limit.
+	if _, ok := r.Take("1"); !ok {
+		t.Fatal("reservation missing")
+	}
+	slots.Take()
+	if got := slots.Taken() + r.Count(); got != maxPlayers {
+		t.Fatalf("%d slot(s) taken or reserved, want %d", got, maxPlayers)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/cooldogedev/spectrum"
+)
+
+// handleReloadCommand reads the config file again and applies the server list, the shutdown message, the
+// observers, the maintenance whitelist and messages, the command aliases and the debug level. Other settings
+// require a restart.
+func handleReloadCommand(conf *ServerConfig) {
+	logger := slog.Default()
+	newConf, err := loadConfig(false)
+	if err != nil {
+		logger.Error("Failed to read config", "error", err)
+		return
+	}
+	if newConf.BindAddr != conf.BindAddr {
+		logger.Warn(fmt.Sprintf("Ignoring bind_addr change to %s, the listener is already bound to %s", newConf.BindAddr, conf.BindAddr))
+	}
+
+	if err := validateAliases(newConf.Aliases); err != nil {
+		logger.Error("Invalid command aliases", "error", err)
+		return
+	}
+
+	added, removed, changed, err := applyServers(resolveServers(newConf.Servers, logger), newConf.DefaultServer)
+	if err != nil {
+		logger.Error("Failed to reload servers", "error", err)
+		return
+	}
+	setDebug(newConf.Debug)
+	observers.Set(newConf.Observers.XUIDs)
+	conf = updateConfig(func(conf *ServerConfig) {
+		conf.ShutdownMessage = newConf.ShutdownMessage
+		conf.Debug = newConf.Debug
+		conf.Observers = newConf.Observers
+		// The maintenance mode is kept, so that reloading doesn't end maintenance that was turned on with the
+		// maintenance command.
+		newConf.Maintenance.Enabled = conf.Maintenance.Enabled
+		conf.Maintenance = newConf.Maintenance
+		conf.Aliases = newConf.Aliases
+	})
+	maintenance.SetWhitelist(conf.Maintenance.Whitelist)
+	statusProvider.Update(conf)
+
+	logger.Info(fmt.Sprintf("Reloaded config: added %s, removed %s, changed %s", serverList(added), serverList(removed), serverList(changed)))
+}
+
+// applyServers replaces the configured servers and the default server in the server registry at once. It
+// returns the names of the servers that were added, removed and whose address changed.
+func applyServers(servers []Server, defaultServer string) (added, removed, changed []string, err error) {
+	old := serverRegistry.All()
+	if err := serverRegistry.Set(servers, defaultServer); err != nil {
+		return nil, nil, nil, err
+	}
+	updateConfig(func(conf *ServerConfig) {
+		conf.Servers, conf.DefaultServer = serverRegistry.Servers(), defaultServer
+	})
+
+	current := serverRegistry.All()
+	for name, addr := range current {
+		if prev, ok := old[name]; !ok {
+			added = append(added, name)
+		} else if prev != addr {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := current[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+	return added, removed, changed, nil
+}
+
+// serverList formats a list of server names for a log message.
+func serverList(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// shutdownProxy disconnects all players with the configured shutdown message and closes the proxy.
+// Spectrum copies its options when it is created, so players are disconnected here to make sure a
+// reloaded shutdown message is used.
+func shutdownProxy(proxy *spectrum.Spectrum) {
+	conf := currentConfig()
+	proxyClosing.Store(true)
+	// Saving the command history is delayed, make sure the last commands are written before exiting.
+	if commandHistory != nil {
+		if err := commandHistory.Save(); err != nil {
+			slog.Default().Error("Failed to save command history on exit", "error", err)
+		}
+	}
+	for _, s := range proxy.Registry().GetSessions() {
+		s.Disconnect(conf.ShutdownMessage)
+	}
+	proxy.Close()
+	_ = events.Run(EventProxyStop, map[string]string{"address": conf.BindAddr})
+}
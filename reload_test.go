@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+	conf := defaultConfig()
+	conf.Maintenance.Enabled = true
+	useServers(t, conf.Servers...)
+	useConfig(t, conf)
+	provider := statusProvider
+	t.Cleanup(func() {
+		statusProvider = provider
+		observers.Set(nil)
+		maintenance.SetWhitelist(nil)
+		setDebug(false)
+	})
+	statusProvider = NewStatusProvider(conf)
+
+	newConf := defaultConfig()
+	newConf.ShutdownMessage = "Restarting"
+	newConf.Maintenance.Message = "Back soon"
+	newConf.Maintenance.Whitelist = []string{"Steve"}
+	newConf.Observers.XUIDs = []string{"1"}
+	newConf.Aliases = map[string]string{"ls": "servers"}
+	if err := writeConfig(newConf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions and the accept loop read the config while it is reloaded.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				c := currentConfig()
+				_, _, _, _ = c.ShutdownMessage, c.Maintenance.Message, c.Observers.XUIDs, c.Aliases["ls"]
+			}
+		}
+	}()
+	handleReloadCommand(conf)
+	close(done)
+	wg.Wait()
+
+	got := currentConfig()
+	if got.ShutdownMessage != "Restarting" || got.Maintenance.Message != "Back soon" || got.Aliases["ls"] != "servers" {
+		t.Fatalf("reloaded config has shutdown message %q, maintenance message %q and aliases %v", got.ShutdownMessage, got.Maintenance.Message, got.Aliases)
+	}
+	if !got.Maintenance.Enabled {
+		t.Error("reloading turned maintenance mode off")
+	}
+	if !observers.Contains("1") {
+		t.Error("reloaded observers are not applied")
+	}
+	if conf.ShutdownMessage != "Proxy shutdown" || len(conf.Aliases) != 0 {
+		t.Error("reloading modified the config in use before the reload")
+	}
+}
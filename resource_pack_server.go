@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sandertv/gophertunnel/minecraft/resource"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // ResourcePackServer handles serving resource packs over HTTP
@@ -21,6 +28,8 @@ type ResourcePackServer struct {
 	// contentCache is a map of UUID -> cached content
 	contentCache      map[string][]byte
 	contentCacheMutex sync.RWMutex
+	// externalURLs is a map of UUID -> external URL that requests are redirected to
+	externalURLs map[string]string
 	// basePath is the path to the resource packs directory
 	basePath string
 	// logger for the server
@@ -29,10 +38,33 @@ type ResourcePackServer struct {
 	server *http.Server
 	// ready is a channel that signals when the server is ready
 	ready chan struct{}
+	// stats holds the request counters of the server
+	stats cdnCounters
+	// socket holds the socket options applied to accepted connections
+	socket CdnSocket
+	// certs holds the TLS certificate if the server is served over HTTPS, or nil otherwise
+	certs *certReloader
 }
 
-// NewResourcePackServer creates a new resource pack HTTP server
-func NewResourcePackServer(packs []*resource.Pack, port int, logger *slog.Logger) (*ResourcePackServer, error) {
+// cdnCounters holds the counters updated for every request handled by the server
+type cdnCounters struct {
+	requests      atomic.Int64
+	bytesServed   atomic.Int64
+	totalDuration atomic.Int64
+	inFlight      atomic.Int64
+}
+
+// CDNStats is a snapshot of the request counters of a ResourcePackServer
+type CDNStats struct {
+	Requests        int64
+	BytesServed     int64
+	AverageDuration time.Duration
+	InFlight        int64
+}
+
+// NewResourcePackServer creates a new resource pack HTTP server. Requests for packs with an entry in
+// externalURLs are redirected to that URL instead of being served from memory.
+func NewResourcePackServer(packs []*resource.Pack, port int, externalURLs map[string]string, socket CdnSocket, logger *slog.Logger) (*ResourcePackServer, error) {
 	wd, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -49,6 +81,11 @@ func NewResourcePackServer(packs []*resource.Pack, port int, logger *slog.Logger
 		uuid := pack.UUID().String()
 		packMap[uuid] = pack
 
+		// Packs served from an external store don't need to be held in memory
+		if _, ok := externalURLs[uuid]; ok {
+			continue
+		}
+
 		// Pre-load the resource pack content into memory
 		content := make([]byte, pack.Len())
 		_, err := pack.ReadAt(content, 0)
@@ -65,12 +102,14 @@ func NewResourcePackServer(packs []*resource.Pack, port int, logger *slog.Logger
 		packMutex:         sync.RWMutex{},
 		contentCache:      contentCache,
 		contentCacheMutex: sync.RWMutex{},
+		externalURLs:      externalURLs,
 		basePath:          basePath,
 		logger:            logger,
 		server: &http.Server{
 			Addr: fmt.Sprintf(":%d", port),
 		},
-		ready: make(chan struct{}),
+		ready:  make(chan struct{}),
+		socket: socket,
 	}
 
 	// Set up HTTP handler
@@ -86,7 +125,7 @@ func (s *ResourcePackServer) Start() error {
 	s.logger.Info("Starting resource pack HTTP server", "address", s.server.Addr)
 
 	// Start a listener to check if we can bind to the port
-	listener, err := net.Listen("tcp", s.server.Addr)
+	listener, err := s.listen()
 	if err != nil {
 		return err
 	}
@@ -95,9 +134,83 @@ func (s *ResourcePackServer) Start() error {
 	close(s.ready)
 
 	// Use the listener with the HTTP server
+	if s.server.TLSConfig != nil {
+		return s.server.ServeTLS(listener, "", "")
+	}
 	return s.server.Serve(listener)
 }
 
+// EnableTLS makes the server serve HTTPS using the certificate in certFile and keyFile. It must be called
+// before Start.
+func (s *ResourcePackServer) EnableTLS(certFile, keyFile string) error {
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	s.certs = certs
+	s.server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+	return nil
+}
+
+// EnableAutoCert makes the server serve HTTPS using certificates obtained from Let's Encrypt for host,
+// which are cached in cacheDir. It must be called before Start.
+func (s *ResourcePackServer) EnableAutoCert(host, cacheDir string) {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(host),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+	s.server.TLSConfig = m.TLSConfig()
+}
+
+// ReloadCertificate reloads the TLS certificate from disk. The new certificate is used from the next
+// handshake, and the current one is kept if the new one can't be loaded.
+func (s *ResourcePackServer) ReloadCertificate() error {
+	if s.certs == nil && s.server.TLSConfig != nil {
+		return fmt.Errorf("certificates are obtained automatically and can't be reloaded")
+	}
+	if s.certs == nil {
+		return fmt.Errorf("TLS is not enabled")
+	}
+	return s.certs.Reload()
+}
+
+// listen binds the address of the server with the configured socket options.
+func (s *ResourcePackServer) listen() (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: time.Duration(s.socket.KeepAliveSeconds) * time.Second}
+	listener, err := lc.Listen(context.Background(), "tcp", s.server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &socketListener{Listener: listener, socket: s.socket}, nil
+}
+
+// socketListener applies the configured socket options to every accepted TCP connection
+type socketListener struct {
+	net.Listener
+	socket CdnSocket
+}
+
+// Accept accepts a connection and applies the socket options to it
+func (l *socketListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if l.socket.DisableNoDelay {
+			_ = tcp.SetNoDelay(false)
+		}
+		if l.socket.WriteBufferKB > 0 {
+			_ = tcp.SetWriteBuffer(l.socket.WriteBufferKB * 1024)
+		}
+		if l.socket.ReadBufferKB > 0 {
+			_ = tcp.SetReadBuffer(l.socket.ReadBufferKB * 1024)
+		}
+	}
+	return conn, nil
+}
+
 // WaitForReady waits for the server to be ready to accept connections
 func (s *ResourcePackServer) WaitForReady() {
 	<-s.ready
@@ -118,11 +231,161 @@ func (s *ResourcePackServer) UpdatePacks(packs []*resource.Pack) {
 	for _, pack := range packs {
 		packMap[pack.UUID().String()] = pack
 	}
+
+	// Drop cached content of packs that were removed or changed, it is cached again on the next request
+	s.contentCacheMutex.Lock()
+	for uuid := range s.contentCache {
+		if pack, ok := packMap[uuid]; !ok || s.packs[uuid] == nil || pack.Checksum() != s.packs[uuid].Checksum() {
+			delete(s.contentCache, uuid)
+		}
+	}
+	s.contentCacheMutex.Unlock()
 	s.packs = packMap
 }
 
+// Flush drops all cached content and returns the number of packs that were cached.
+func (s *ResourcePackServer) Flush() int {
+	s.contentCacheMutex.Lock()
+	defer s.contentCacheMutex.Unlock()
+	n := len(s.contentCache)
+	s.contentCache = make(map[string][]byte)
+	return n
+}
+
+// Warm loads every pack that is not cached yet into the content cache. It returns the total size of the
+// cached content and the UUIDs of the packs skipped because they are served from an external URL.
+func (s *ResourcePackServer) Warm() (int64, []string, error) {
+	s.packMutex.RLock()
+	packs := make(map[string]*resource.Pack, len(s.packs))
+	for uuid, pack := range s.packs {
+		packs[uuid] = pack
+	}
+	s.packMutex.RUnlock()
+
+	var skipped []string
+	for uuid, pack := range packs {
+		if _, ok := s.externalURLs[uuid]; ok {
+			skipped = append(skipped, uuid)
+			continue
+		}
+		s.contentCacheMutex.RLock()
+		_, cached := s.contentCache[uuid]
+		s.contentCacheMutex.RUnlock()
+		if cached {
+			continue
+		}
+
+		content := make([]byte, pack.Len())
+		if _, err := pack.ReadAt(content, 0); err != nil {
+			return 0, skipped, fmt.Errorf("read resource pack %s: %w", uuid, err)
+		}
+		s.contentCacheMutex.Lock()
+		s.contentCache[uuid] = content
+		s.contentCacheMutex.Unlock()
+	}
+
+	var total int64
+	s.contentCacheMutex.RLock()
+	for _, content := range s.contentCache {
+		total += int64(len(content))
+	}
+	s.contentCacheMutex.RUnlock()
+	return total, skipped, nil
+}
+
+// Recache reads the content of the pack with the given UUID, or of all packs if uuid is empty, into the
+// cache again, replacing the cached content. The packs are read as set by UpdatePacks, so packs changed on
+// disk must be loaded with reloadPacks first. It returns the new cached size of each recached pack.
+func (s *ResourcePackServer) Recache(uuid string) (map[string]int, error) {
+	s.packMutex.RLock()
+	packs := make(map[string]*resource.Pack, len(s.packs))
+	for packUUID, pack := range s.packs {
+		if uuid == "" || packUUID == uuid {
+			packs[packUUID] = pack
+		}
+	}
+	s.packMutex.RUnlock()
+
+	sizes := make(map[string]int)
+	for packUUID, pack := range packs {
+		if _, external := s.externalURLs[packUUID]; external {
+			continue
+		}
+
+		content := make([]byte, pack.Len())
+		if _, err := pack.ReadAt(content, 0); err != nil {
+			return sizes, fmt.Errorf("read resource pack %s: %w", packUUID, err)
+		}
+		s.contentCacheMutex.Lock()
+		s.contentCache[packUUID] = content
+		s.contentCacheMutex.Unlock()
+		sizes[packUUID] = len(content)
+	}
+
+	if uuid != "" && len(sizes) == 0 {
+		return nil, fmt.Errorf("resource pack %s not found or not served by the CDN", uuid)
+	}
+	return sizes, nil
+}
+
+// ReplacePack replaces the served pack with the UUID of pack by pack and caches its content in place of
+// the cached content of the previous pack. The other packs and their cached content are left alone. It
+// returns the new cached size of the pack.
+func (s *ResourcePackServer) ReplacePack(pack *resource.Pack) (int, error) {
+	uuid := pack.UUID().String()
+	if _, external := s.externalURLs[uuid]; external {
+		return 0, fmt.Errorf("resource pack %s is served from an external URL", uuid)
+	}
+	content := make([]byte, pack.Len())
+	if _, err := pack.ReadAt(content, 0); err != nil {
+		return 0, fmt.Errorf("read resource pack %s: %w", uuid, err)
+	}
+
+	s.packMutex.Lock()
+	defer s.packMutex.Unlock()
+	if _, ok := s.packs[uuid]; !ok {
+		return 0, fmt.Errorf("resource pack %s not found", uuid)
+	}
+	s.packs[uuid] = pack
+	s.contentCacheMutex.Lock()
+	s.contentCache[uuid] = content
+	s.contentCacheMutex.Unlock()
+	return len(content), nil
+}
+
+// Stats returns a snapshot of the request counters of the server
+func (s *ResourcePackServer) Stats() CDNStats {
+	stats := CDNStats{
+		Requests:    s.stats.requests.Load(),
+		BytesServed: s.stats.bytesServed.Load(),
+		InFlight:    s.stats.inFlight.Load(),
+	}
+	if stats.Requests > 0 {
+		stats.AverageDuration = time.Duration(s.stats.totalDuration.Load() / stats.Requests)
+	}
+	return stats
+}
+
+// ResetStats resets the request counters of the server. Requests currently in flight are still tracked.
+func (s *ResourcePackServer) ResetStats() {
+	s.stats.requests.Store(0)
+	s.stats.bytesServed.Store(0)
+	s.stats.totalDuration.Store(0)
+}
+
 // handleRequest handles HTTP requests for resource packs
 func (s *ResourcePackServer) handleRequest(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	s.stats.inFlight.Add(1)
+	metricsSink.SetGauge(metricCDNInFlight, float64(s.stats.inFlight.Load()))
+	defer func() {
+		s.stats.inFlight.Add(-1)
+		s.stats.requests.Add(1)
+		metricsSink.AddCounter(metricCDNRequests, 1)
+		metricsSink.SetGauge(metricCDNInFlight, float64(s.stats.inFlight.Load()))
+		s.stats.totalDuration.Add(int64(time.Since(start)))
+	}()
+
 	// Get the UUID from the path
 	path := strings.TrimPrefix(r.URL.Path, "/")
 
@@ -150,6 +413,22 @@ func (s *ResourcePackServer) handleRequest(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if url, ok := s.externalURLs[path]; ok {
+		s.logger.Debug("Redirecting resource pack request", "uuid", path, "url", url)
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+
+	// The checksum is the SHA-256 of the archive that is served, so it identifies the content exactly.
+	checksum := pack.Checksum()
+	etag := fmt.Sprintf("\"%x\"", checksum[:])
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		s.logger.Debug("Resource pack not modified", "uuid", path)
+		return
+	}
+
 	s.contentCacheMutex.RLock()
 	content, ok := s.contentCache[path]
 	s.contentCacheMutex.RUnlock()
@@ -172,9 +451,22 @@ func (s *ResourcePackServer) handleRequest(w http.ResponseWriter, r *http.Reques
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.mcpack", path))
 	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	body := content
+	if start, end, ok := parseRange(r.Header.Get("Range"), len(content)); ok {
+		body = content[start : end+1]
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+	}
 
-	if _, err := w.Write(content); err != nil {
+	n, err := w.Write(body)
+	s.stats.bytesServed.Add(int64(n))
+	metricsSink.AddCounter(metricCDNBytesServed, int64(n))
+	if err != nil {
 		s.logger.Error("Failed to write resource pack to response", "uuid", path, "error", err)
 		return
 	}
@@ -182,19 +474,113 @@ func (s *ResourcePackServer) handleRequest(w http.ResponseWriter, r *http.Reques
 	s.logger.Debug("Served resource pack", "uuid", path, "size", len(content))
 }
 
-// ModifyResourcePackForCDN modifies resource packs to use HTTP URLs instead of direct content
-func ModifyResourcePackForCDN(packs []*resource.Pack, baseURL string) []*resource.Pack {
+// etagMatches reports if the If-None-Match header matches etag, comparing weakly as required for GET.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a Range header with a single byte range against content of the given size and returns
+// the first and last byte of the range. Ranges that are absent, malformed, unsatisfiable or consist of
+// multiple ranges are rejected, in which case the full content is served.
+func parseRange(header string, size int) (int, int, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// A suffix range such as bytes=-500 requests the last bytes of the content.
+		n, err := strconv.Atoi(last)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.Atoi(last); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// ModifyResourcePackForCDN modifies resource packs to use HTTP URLs instead of direct content. It returns an
+// error if a pack can't be downloaded from the CDN.
+func ModifyResourcePackForCDN(packs []*resource.Pack, baseURL string) ([]*resource.Pack, error) {
 	modifiedPacks := make([]*resource.Pack, len(packs))
 
 	for i, pack := range packs {
 		// Create URL based on the pack's UUID
-		url := fmt.Sprintf("%s/%s", baseURL, pack.UUID().String())
+		url := packURL(baseURL, pack)
 
-		// Create a modified pack with the URL
-		modifiedPack := resource.MustReadURL(url)
+		// Create a modified pack with the URL. The CDN serves the pack still encrypted, so the client needs
+		// the content key of the original pack to decrypt it.
+		modifiedPack, err := resource.ReadURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("pack %s (%s): %w", pack.Name(), pack.UUID(), err)
+		}
+		if pack.Encrypted() {
+			modifiedPack = modifiedPack.WithContentKey(pack.ContentKey())
+		}
 
 		modifiedPacks[i] = modifiedPack
 	}
 
-	return modifiedPacks
+	return modifiedPacks, nil
+}
+
+// packURL returns the CDN download URL of the pack for the given base URL.
+func packURL(baseURL string, pack *resource.Pack) string {
+	return fmt.Sprintf("%s/%s", baseURL, pack.UUID().String())
+}
+
+// SelfTestCDN downloads every pack from its CDN URL and checks that it is served completely.
+// It returns an error for every pack that could not be downloaded as expected.
+func SelfTestCDN(packs []*resource.Pack, baseURL string) []error {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var errs []error
+	for _, pack := range packs {
+		if err := testPackURL(client, packURL(baseURL, pack), pack.Len()); err != nil {
+			errs = append(errs, fmt.Errorf("pack %s (%s): %w", pack.Name(), pack.UUID(), err))
+		}
+	}
+	return errs
+}
+
+// testPackURL requests url and checks that it responds with status 200 and exactly size bytes.
+func testPackURL(client *http.Client, url string, size int) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", url, err)
+	}
+	if n != int64(size) {
+		return fmt.Errorf("expected %d bytes from %s, got %d", size, url, n)
+	}
+	return nil
 }
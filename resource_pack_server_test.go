@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+// newTestPackServer returns a ResourcePackServer serving a single pack of about size bytes, and that pack.
+func newTestPackServer(t *testing.T, size int) (*ResourcePackServer, *resource.Pack) {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestPack(t, dir, "pack", size)
+	pack, err := resource.ReadPath(filepath.Join(dir, "resource_packs", "pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewResourcePackServer([]*resource.Pack{pack}, 0, nil, CdnSocket{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, pack
+}
+
+// getPack requests the pack from s with the given request headers.
+func getPack(t *testing.T, s *ResourcePackServer, pack *resource.Pack, header map[string]string) *http.Response {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/"+pack.UUID().String(), nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.handleRequest(w, r)
+	return w.Result()
+}
+
+func TestResourcePackServerRange(t *testing.T) {
+	s, pack := newTestPackServer(t, 1000)
+	content := make([]byte, pack.Len())
+	if _, err := pack.ReadAt(content, 0); err != nil {
+		t.Fatal(err)
+	}
+	size := len(content)
+
+	tests := []struct {
+		name       string
+		rangeValue string
+		wantStatus int
+		start, end int
+	}{
+		{name: "no range", wantStatus: http.StatusOK, start: 0, end: size - 1},
+		{name: "bounded", rangeValue: "bytes=10-19", wantStatus: http.StatusPartialContent, start: 10, end: 19},
+		{name: "open-ended", rangeValue: "bytes=100-", wantStatus: http.StatusPartialContent, start: 100, end: size - 1},
+		{name: "suffix", rangeValue: "bytes=-50", wantStatus: http.StatusPartialContent, start: size - 50, end: size - 1},
+		{name: "end past the content", rangeValue: fmt.Sprintf("bytes=5-%d", size+100), wantStatus: http.StatusPartialContent, start: 5, end: size - 1},
+		{name: "single byte", rangeValue: "bytes=0-0", wantStatus: http.StatusPartialContent, start: 0, end: 0},
+		{name: "unsatisfiable", rangeValue: fmt.Sprintf("bytes=%d-", size), wantStatus: http.StatusOK, start: 0, end: size - 1},
+		{name: "end before start", rangeValue: "bytes=20-10", wantStatus: http.StatusOK, start: 0, end: size - 1},
+		{name: "multiple ranges", rangeValue: "bytes=0-1,5-6", wantStatus: http.StatusOK, start: 0, end: size - 1},
+		{name: "malformed", rangeValue: "bytes=a-b", wantStatus: http.StatusOK, start: 0, end: size - 1},
+		{name: "other unit", rangeValue: "items=0-1", wantStatus: http.StatusOK, start: 0, end: size - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]string{}
+			if tt.rangeValue != "" {
+				header["Range"] = tt.rangeValue
+			}
+			resp := getPack(t, s, pack, header)
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+				t.Errorf("Accept-Ranges = %q, want bytes", got)
+			}
+			wantRange := ""
+			if tt.wantStatus == http.StatusPartialContent {
+				wantRange = fmt.Sprintf("bytes %d-%d/%d", tt.start, tt.end, size)
+			}
+			if got := resp.Header.Get("Content-Range"); got != wantRange {
+				t.Errorf("Content-Range = %q, want %q", got, wantRange)
+			}
+			if string(body) != string(content[tt.start:tt.end+1]) {
+				t.Errorf("body is %d bytes, want bytes %d-%d of the pack", len(body), tt.start, tt.end)
+			}
+			if got := resp.Header.Get("Content-Length"); got != fmt.Sprint(len(body)) {
+				t.Errorf("Content-Length = %s, want %d", got, len(body))
+			}
+		})
+	}
+}
+
+func TestResourcePackServerConditionalGet(t *testing.T) {
+	s, pack := newTestPackServer(t, 1000)
+	checksum := pack.Checksum()
+	etag := fmt.Sprintf("\"%x\"", checksum[:])
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "no condition", wantStatus: http.StatusOK},
+		{name: "matching", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak match", ifNoneMatch: "W/" + etag, wantStatus: http.StatusNotModified},
+		{name: "one of several", ifNoneMatch: "\"stale\", " + etag, wantStatus: http.StatusNotModified},
+		{name: "any", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "not matching", ifNoneMatch: "\"stale\"", wantStatus: http.StatusOK},
+		{name: "unquoted checksum", ifNoneMatch: etag[1 : len(etag)-1], wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]string{}
+			if tt.ifNoneMatch != "" {
+				header["If-None-Match"] = tt.ifNoneMatch
+			}
+			resp := getPack(t, s, pack, header)
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			wantLen := pack.Len()
+			if tt.wantStatus == http.StatusNotModified {
+				wantLen = 0
+			}
+			if len(body) != wantLen {
+				t.Errorf("body is %d bytes, want %d", len(body), wantLen)
+			}
+		})
+	}
+}
+
+// blockingWriter is a http.ResponseWriter whose Write blocks until release is closed.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	writing, release chan struct{}
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestResourcePackServerStats(t *testing.T) {
+	s, pack := newTestPackServer(t, 1000)
+	size := int64(pack.Len())
+
+	getPack(t, s, pack, nil)
+	getPack(t, s, pack, map[string]string{"Range": "bytes=0-9"})
+	getPack(t, s, pack, map[string]string{"If-None-Match": "*"})
+	w := httptest.NewRecorder()
+	s.handleRequest(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	stats := s.Stats()
+	if stats.Requests != 4 || stats.BytesServed != size+10 || stats.InFlight != 0 {
+		t.Fatalf("stats = %+v, want 4 requests, %d bytes served and none in flight", stats, size+10)
+	}
+	if stats.AverageDuration <= 0 {
+		t.Errorf("average duration = %s, want the time taken by the requests", stats.AverageDuration)
+	}
+
+	// A download that is still being written is in flight and not counted as a finished request yet.
+	bw := &blockingWriter{ResponseRecorder: httptest.NewRecorder(), writing: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handleRequest(bw, httptest.NewRequest(http.MethodGet, "/"+pack.UUID().String(), nil))
+	}()
+	<-bw.writing
+	if stats := s.Stats(); stats.InFlight != 1 || stats.Requests != 4 {
+		t.Errorf("stats = %+v during a download, want 1 in flight and 4 requests", stats)
+	}
+	close(bw.release)
+	<-done
+	if stats := s.Stats(); stats.InFlight != 0 || stats.Requests != 5 || stats.BytesServed != 2*size+10 {
+		t.Errorf("stats = %+v after the download, want none in flight, 5 requests and %d bytes served", stats, 2*size+10)
+	}
+
+	s.ResetStats()
+	if stats := s.Stats(); stats != (CDNStats{}) {
+		t.Fatalf("stats = %+v after a reset, want zero", stats)
+	}
+}
+
+func TestResourcePackServerRedirect(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPack(t, dir, "local", 1000)
+	writeTestPack(t, dir, "external", 1000)
+	var packs []*resource.Pack
+	for _, name := range []string{"local", "external"} {
+		pack, err := resource.ReadPath(filepath.Join(dir, "resource_packs", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		packs = append(packs, pack)
+	}
+	local, external := packs[0], packs[1]
+	const url = "https://packs.example.com/external.mcpack"
+	s, err := NewResourcePackServer(packs, 0, map[string]string{external.UUID().String(): url}, CdnSocket{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := getPack(t, s, external, nil)
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != url {
+		t.Errorf("external pack got status %d to %q, want a redirect to %s", resp.StatusCode, resp.Header.Get("Location"), url)
+	}
+	if _, ok := s.contentCache[external.UUID().String()]; ok {
+		t.Error("the content of the external pack is held in memory")
+	}
+
+	resp = getPack(t, s, local, nil)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || len(body) != local.Len() {
+		t.Errorf("local pack got status %d with %d bytes, want it served with %d bytes", resp.StatusCode, len(body), local.Len())
+	}
+}
+
+func TestResourcePackServerListen(t *testing.T) {
+	tests := []struct {
+		name   string
+		socket CdnSocket
+	}{
+		{name: "defaults"},
+		{name: "tuned", socket: CdnSocket{DisableNoDelay: true, WriteBufferKB: 512, ReadBufferKB: 64, KeepAliveSeconds: 30}},
+		{name: "keep-alive disabled", socket: CdnSocket{KeepAliveSeconds: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, pack := newTestPackServer(t, 1000)
+			s.socket = tt.socket
+			s.server.Addr = "127.0.0.1:0"
+			l, err := s.listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = l.Close() })
+			if sl, ok := l.(*socketListener); !ok || sl.socket != tt.socket {
+				t.Fatalf("listener is %T, want a socketListener with the configured socket options", l)
+			}
+			go func() { _ = s.server.Serve(l) }()
+
+			resp, err := http.Get(fmt.Sprintf("http://%s/%s", l.Addr(), pack.UUID()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || len(body) != pack.Len() {
+				t.Fatalf("got status %d with %d bytes, want the pack served over the tuned socket", resp.StatusCode, len(body))
+			}
+		})
+	}
+
+	s, _ := newTestPackServer(t, 1000)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s.server.Addr = l.Addr().String()
+	if _, err := s.listen(); err == nil {
+		t.Error("listening on an address in use succeeded")
+	}
+}
+
+func TestResourcePackServerWarm(t *testing.T) {
+	dir := t.TempDir()
+	var packs []*resource.Pack
+	for _, name := range []string{"first", "second", "external"} {
+		writeTestPack(t, dir, name, 1000)
+		pack, err := resource.ReadPath(filepath.Join(dir, "resource_packs", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		packs = append(packs, pack)
+	}
+	external := packs[2].UUID().String()
+	s, err := NewResourcePackServer(packs, 0, map[string]string{external: "https://packs.example.com/external.mcpack"}, CdnSocket{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Flush()
+
+	total, skipped, err := s.Warm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pack := range packs[:2] {
+		if content, ok := s.contentCache[pack.UUID().String()]; !ok || len(content) != pack.Len() {
+			t.Errorf("pack %s is not cached after warming", pack.Name())
+		}
+	}
+	if _, ok := s.contentCache[external]; ok {
+		t.Error("the pack served from an external URL was cached")
+	}
+	if want := int64(packs[0].Len() + packs[1].Len()); total != want {
+		t.Errorf("warming reported %d bytes cached, want %d", total, want)
+	}
+	if !slices.Equal(skipped, []string{external}) {
+		t.Errorf("warming skipped %v, want the external pack", skipped)
+	}
+}
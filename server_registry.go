@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// serverRegistry holds the configured backend servers. It is filled from the config at startup and
+// updated by the server and reload commands.
+var serverRegistry = NewServerRegistry()
+
+// ServerRegistry is a concurrency-safe set of backend servers, indexed by both name and address. It also
+// keeps track of which server is the default (lobby) server.
+type ServerRegistry struct {
+	mu            sync.RWMutex
+	servers       []Server
+	byName        map[string]string
+	byAddr        map[string]string
+	defaultServer string
+
+	// lobbies holds the default server and the servers marked as lobby, and lobbyWeight the sum of their
+	// weights. lobbyTurn is advanced for every player sent to a lobby.
+	lobbies     []Server
+	lobbyWeight int
+	lobbyTurn   atomic.Uint64
+}
+
+// NewServerRegistry creates a new, empty ServerRegistry.
+func NewServerRegistry() *ServerRegistry {
+	return &ServerRegistry{byName: make(map[string]string), byAddr: make(map[string]string)}
+}
+
+// Lookup returns the address of the server with the given name.
+func (r *ServerRegistry) Lookup(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	addr, ok := r.byName[name]
+	return addr, ok
+}
+
+// Name returns the name of the server with the given address.
+func (r *ServerRegistry) Name(addr string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.byAddr[addr]
+	return name, ok
+}
+
+// Get returns the configuration of the server with the given name.
+func (r *ServerRegistry) Get(name string) (Server, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i := slices.IndexFunc(r.servers, func(srv Server) bool { return srv.Name == name })
+	if i == -1 {
+		return Server{}, false
+	}
+	return r.servers[i], true
+}
+
+// All returns a copy of the server name to address mapping.
+func (r *ServerRegistry) All() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.byName)
+}
+
+// Servers returns a copy of the configuration of all servers, in the order they were added.
+func (r *ServerRegistry) Servers() []Server {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.servers)
+}
+
+// Lobby returns the name and address of the default server.
+func (r *ServerRegistry) Lobby() (string, string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultServer, r.byName[r.defaultServer]
+}
+
+// NextLobby returns the address of the next lobby in weighted round-robin order. The turns of lobbies for
+// which usable returns false are spread over the usable lobbies by their weight. If no lobby is usable,
+// the address of the default server is returned.
+func (r *ServerRegistry) NextLobby(usable func(addr string) bool) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.lobbyWeight == 0 {
+		return r.byName[r.defaultServer]
+	}
+	turn := int(r.lobbyTurn.Add(1) - 1)
+	if srv := lobbyAt(r.lobbies, turn%r.lobbyWeight); usable(srv.Addr) {
+		return srv.Addr
+	}
+
+	var (
+		usableLobbies []Server
+		usableWeight  int
+	)
+	for _, srv := range r.lobbies {
+		if usable(srv.Addr) {
+			usableLobbies = append(usableLobbies, srv)
+			usableWeight += lobbyWeight(srv)
+		}
+	}
+	if usableWeight == 0 {
+		return r.byName[r.defaultServer]
+	}
+	return lobbyAt(usableLobbies, turn%usableWeight).Addr
+}
+
+// lobbyAt returns the lobby whose share of the total weight of lobbies contains pos.
+func lobbyAt(lobbies []Server, pos int) Server {
+	for _, srv := range lobbies {
+		if pos < lobbyWeight(srv) {
+			return srv
+		}
+		pos -= lobbyWeight(srv)
+	}
+	return lobbies[len(lobbies)-1]
+}
+
+// lobbyWeight returns the weight of a lobby server.
+func lobbyWeight(srv Server) int {
+	return max(srv.Weight, 1)
+}
+
+// Set replaces all servers and the default server at once.
+func (r *ServerRegistry) Set(servers []Server, defaultServer string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.set(slices.Clone(servers), defaultServer)
+}
+
+// Add adds a new server.
+func (r *ServerRegistry) Add(srv Server) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byName[srv.Name]; ok {
+		return fmt.Errorf("server %q already exists", srv.Name)
+	}
+	if other, ok := r.byAddr[srv.Addr]; ok {
+		return fmt.Errorf("address %s is already used by server %q", srv.Addr, other)
+	}
+	return r.set(append(slices.Clone(r.servers), srv), r.defaultServer)
+}
+
+// Remove removes the named server and returns its address. The default server cannot be removed.
+func (r *ServerRegistry) Remove(name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == r.defaultServer {
+		return "", fmt.Errorf("cannot remove the default server")
+	}
+	addr, ok := r.byName[name]
+	if !ok {
+		return "", fmt.Errorf("server %q not found", name)
+	}
+	servers := slices.DeleteFunc(slices.Clone(r.servers), func(srv Server) bool { return srv.Name == name })
+	return addr, r.set(servers, r.defaultServer)
+}
+
+// SetAddr changes the address of the named server and returns the previous address. The new address is
+// used as is, even if the previous one was resolved through SRV.
+func (r *ServerRegistry) SetAddr(name, addr string) (string, error) {
+	return r.setAddr(name, addr, false)
+}
+
+// Resolve changes the address of the named server to the address its SRV record resolved to.
+func (r *ServerRegistry) Resolve(name, addr string) error {
+	_, err := r.setAddr(name, addr, true)
+	return err
+}
+
+// setAddr changes the address of the named server and returns the previous address. If resolved is
+// false, the server is no longer resolved through SRV.
+func (r *ServerRegistry) setAddr(name, addr string, resolved bool) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.byName[name]
+	if !ok {
+		return "", fmt.Errorf("server %q not found", name)
+	}
+	if other, ok := r.byAddr[addr]; ok && other != name {
+		return "", fmt.Errorf("address %s is already used by server %q", addr, other)
+	}
+	servers := slices.Clone(r.servers)
+	for i := range servers {
+		if servers[i].Name == name {
+			servers[i].Addr = addr
+			if !resolved {
+				servers[i].SRV, servers[i].host = false, ""
+			}
+		}
+	}
+	return old, r.set(servers, r.defaultServer)
+}
+
+// Rename changes the name of a server without changing its address.
+func (r *ServerRegistry) Rename(old, new string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byName[old]; !ok {
+		return fmt.Errorf("server %q not found", old)
+	}
+	if _, ok := r.byName[new]; ok {
+		return fmt.Errorf("server %q already exists", new)
+	}
+	servers := slices.Clone(r.servers)
+	for i := range servers {
+		if servers[i].Name == old {
+			servers[i].Name = new
+		}
+	}
+	defaultServer := r.defaultServer
+	if defaultServer == old {
+		defaultServer = new
+	}
+	return r.set(servers, defaultServer)
+}
+
+// set validates the servers and replaces the current ones with them. r.mu must be held.
+func (r *ServerRegistry) set(servers []Server, defaultServer string) error {
+	byName := make(map[string]string, len(servers))
+	byAddr := make(map[string]string, len(servers))
+	for _, srv := range servers {
+		if _, ok := byName[srv.Name]; ok {
+			return fmt.Errorf("server %q is configured more than once", srv.Name)
+		}
+		if other, ok := byAddr[srv.Addr]; ok {
+			return fmt.Errorf("address %s is used by both %q and %q", srv.Addr, other, srv.Name)
+		}
+		byName[srv.Name] = srv.Addr
+		byAddr[srv.Addr] = srv.Name
+	}
+	if _, ok := byName[defaultServer]; !ok {
+		return fmt.Errorf("default server %q is not configured", defaultServer)
+	}
+	r.servers, r.byName, r.byAddr, r.defaultServer = servers, byName, byAddr, defaultServer
+	r.lobbies, r.lobbyWeight = nil, 0
+	for _, srv := range servers {
+		if srv.Lobby || srv.Name == defaultServer {
+			r.lobbies = append(r.lobbies, srv)
+			r.lobbyWeight += lobbyWeight(srv)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+// TestServerRegistryConcurrentAccess hammers lookups while servers are added, removed, renamed and moved.
+// Run it with -race.
+func TestServerRegistryConcurrentAccess(t *testing.T) {
+	r := NewServerRegistry()
+	if err := r.Set([]Server{{Name: "lobby", Addr: "127.0.0.1:19133", Lobby: true}}, "lobby"); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		writers    = 4
+		readers    = 8
+		iterations = 500
+	)
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				name := fmt.Sprintf("server-%d-%d", w, i)
+				addr := fmt.Sprintf("10.0.%d.%d:19132", w, i%250)
+				if err := r.Add(Server{Name: name, Addr: addr, Lobby: i%2 == 0}); err != nil {
+					continue
+				}
+				_, _ = r.SetAddr(name, fmt.Sprintf("10.1.%d.%d:19132", w, i%250))
+				_ = r.Rename(name, name+"-renamed")
+				if _, err := r.Remove(name + "-renamed"); err != nil {
+					t.Errorf("remove %s: %v", name, err)
+				}
+			}
+		}()
+	}
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				if addr, ok := r.Lookup("lobby"); !ok || addr != "127.0.0.1:19133" {
+					t.Errorf("Lookup(lobby) = %q, %v while other servers changed", addr, ok)
+				}
+				if name, ok := r.Name("127.0.0.1:19133"); !ok || name != "lobby" {
+					t.Errorf("Name(127.0.0.1:19133) = %q, %v while other servers changed", name, ok)
+				}
+				for name, addr := range r.All() {
+					_, _ = r.Get(name)
+					_, _ = r.Name(addr)
+				}
+				_ = r.Servers()
+				_, _ = r.Lobby()
+				_ = r.NextLobby(func(string) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if servers := r.Servers(); len(servers) != 1 {
+		t.Fatalf("%d server(s) left after all changes were undone, want 1", len(servers))
+	}
+}
+
+func TestNextLobbyDistribution(t *testing.T) {
+	const calls = 10000
+	tests := []struct {
+		name    string
+		servers []Server
+		usable  func(addr string) bool
+		want    map[string]float64
+	}{
+		{
+			name: "weighted",
+			servers: []Server{
+				{Name: "lobby", Addr: "lobby:19132", Weight: 1},
+				{Name: "lobby2", Addr: "lobby2:19132", Lobby: true, Weight: 3},
+				{Name: "island", Addr: "island:19132"},
+			},
+			want: map[string]float64{"lobby:19132": 0.25, "lobby2:19132": 0.75},
+		},
+		{
+			name: "zero weight counts as one",
+			servers: []Server{
+				{Name: "lobby", Addr: "lobby:19132"},
+				{Name: "lobby2", Addr: "lobby2:19132", Lobby: true},
+				{Name: "lobby3", Addr: "lobby3:19132", Lobby: true, Weight: 2},
+			},
+			want: map[string]float64{"lobby:19132": 0.25, "lobby2:19132": 0.25, "lobby3:19132": 0.5},
+		},
+		{
+			name: "unusable lobby is passed over",
+			servers: []Server{
+				{Name: "lobby", Addr: "lobby:19132", Weight: 2},
+				{Name: "lobby2", Addr: "lobby2:19132", Lobby: true, Weight: 1},
+				{Name: "lobby3", Addr: "lobby3:19132", Lobby: true, Weight: 1},
+			},
+			usable: func(addr string) bool { return addr != "lobby:19132" },
+			want:   map[string]float64{"lobby2:19132": 0.5, "lobby3:19132": 0.5},
+		},
+		{
+			name: "default server if no lobby is usable",
+			servers: []Server{
+				{Name: "lobby", Addr: "lobby:19132"},
+				{Name: "lobby2", Addr: "lobby2:19132", Lobby: true},
+			},
+			usable: func(string) bool { return false },
+			want:   map[string]float64{"lobby:19132": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewServerRegistry()
+			if err := r.Set(tt.servers, tt.servers[0].Name); err != nil {
+				t.Fatal(err)
+			}
+			usable := tt.usable
+			if usable == nil {
+				usable = func(string) bool { return true }
+			}
+
+			counts := make(map[string]int)
+			for range calls {
+				counts[r.NextLobby(usable)]++
+			}
+			for addr, n := range counts {
+				if _, ok := tt.want[addr]; !ok {
+					t.Errorf("%d player(s) sent to %s, want none", n, addr)
+				}
+			}
+			for addr, share := range tt.want {
+				if got := float64(counts[addr]) / calls; math.Abs(got-share) > 0.01 {
+					t.Errorf("%.3f of players sent to %s, want %.3f", got, addr, share)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+const serverCommandUsage = "Usage: server <add|remove|set-addr|rename> ..."
+
+// handleServerCommand processes the subcommands of the server command.
+func handleServerCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if len(args) == 0 {
+		logger.Info(serverCommandUsage)
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			logger.Info("Usage: server add <name> <host:port>")
+			return
+		}
+
+		name := args[1]
+		addr := args[2]
+		if err := addServer(name, addr); err != nil {
+			logger.Error("Failed to add server", "server", name, "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Added server %s (%s)", name, addr))
+		logger.Info("Run save-config to persist this change")
+
+	case "remove":
+		if len(args) < 2 || len(args) >= 3 && args[2] != "move" {
+			logger.Info("Usage: server remove <name> [move [server]]")
+			return
+		}
+
+		name := args[1]
+		move := len(args) >= 3
+		// Players are moved to the lobby unless another server is given.
+		target, targetAddr := serverRegistry.Lobby()
+		if len(args) >= 4 {
+			target = args[3]
+			if target == name {
+				logger.Info("Players can't be moved to the server that is removed")
+				return
+			}
+			addr, ok := serverRegistry.Lookup(target)
+			if !ok {
+				logger.Info(fmt.Sprintf("Server '%s' not found", target))
+				return
+			}
+			targetAddr = addr
+		}
+		addr, err := removeServer(name)
+		if err != nil {
+			logger.Error("Failed to remove server", "server", name, "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Removed server %s (%s)", name, addr))
+
+		if remaining := serverTracker.Count(addr); remaining > 0 {
+			if move {
+				moveToServer(sessionsOnServer(proxy, addr), target, targetAddr, logger)
+			} else {
+				logger.Warn(fmt.Sprintf("%d player(s) are still connected to %s and will stay there until they leave", remaining, name))
+				logger.Warn(fmt.Sprintf("Use 'server remove %s move [server]' to move players to the lobby or another server", name))
+			}
+		}
+		logger.Info("Run save-config to persist this change")
+
+	case "set-addr":
+		if len(args) < 3 {
+			logger.Info("Usage: server set-addr <name> <host:port>")
+			return
+		}
+
+		name := args[1]
+		addr := args[2]
+		old, err := setServerAddr(name, addr)
+		if err != nil {
+			logger.Error("Failed to update server address", "server", name, "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Updated address of %s from %s to %s", name, old, addr))
+		logger.Info("Run save-config to persist this change")
+
+	case "rename":
+		if len(args) < 3 {
+			logger.Info("Usage: server rename <old> <new>")
+			return
+		}
+
+		if err := renameServer(args[1], args[2]); err != nil {
+			logger.Error("Failed to rename server", "server", args[1], "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Renamed server %s to %s", args[1], args[2]))
+		logger.Info("Run save-config to persist this change")
+
+	default:
+		logger.Info(fmt.Sprintf("Unknown server subcommand: %s", args[0]))
+		logger.Info(serverCommandUsage)
+	}
+}
+
+// addServer registers a new server with the given name and address, making it immediately
+// available for transfers. The server is also added to the live config so that it can be persisted.
+func addServer(name, addr string) error {
+	if err := validateAddr(addr); err != nil {
+		return err
+	}
+	if err := serverRegistry.Add(Server{Name: name, Addr: addr}); err != nil {
+		return err
+	}
+	updateConfig(func(conf *ServerConfig) { conf.Servers = serverRegistry.Servers() })
+	return nil
+}
+
+// removeServer unregisters the named server and returns its address. The default server
+// cannot be removed since new players would have nowhere to go, and neither can the lobby failover
+// fallback. The server is removed from the server groups and the GeoIP lobbies it is part of.
+func removeServer(name string) (string, error) {
+	if currentConfig().LobbyFailover.Fallback == name {
+		return "", fmt.Errorf("%s is the lobby failover fallback, change it before removing the server", name)
+	}
+	addr, err := serverRegistry.Remove(name)
+	if err != nil {
+		return "", err
+	}
+	updateConfig(func(conf *ServerConfig) {
+		conf.Servers = serverRegistry.Servers()
+		// The groups and lobbies are shared with the previous config, which may still be read, so they are
+		// replaced instead of being modified.
+		groups := make(map[string][]string, len(conf.ServerGroups))
+		for group, members := range conf.ServerGroups {
+			groups[group] = slices.DeleteFunc(slices.Clone(members), func(member string) bool { return member == name })
+		}
+		conf.ServerGroups = groups
+		lobbies := make(map[string]string, len(conf.GeoIP.Lobbies))
+		for region, lobby := range conf.GeoIP.Lobbies {
+			if lobby != name {
+				lobbies[region] = lobby
+			}
+		}
+		conf.GeoIP.Lobbies = lobbies
+	})
+	geoRouter.RemoveLobby(name)
+	return addr, nil
+}
+
+// setServerAddr changes the address of the named server and returns the previous address.
+// The change is mirrored into the live config so that it can be persisted with save-config.
+func setServerAddr(name, addr string) (string, error) {
+	if err := validateAddr(addr); err != nil {
+		return "", err
+	}
+	old, err := serverRegistry.SetAddr(name, addr)
+	if err != nil {
+		return "", err
+	}
+	moveServerState(old, addr)
+	updateConfig(func(conf *ServerConfig) { conf.Servers = serverRegistry.Servers() })
+	return old, nil
+}
+
+// moveServerState moves everything keyed by the address of a server from old to new after its address
+// changed, so that the players on it are still found and counted and its health is kept.
+func moveServerState(old, new string) {
+	if old == new {
+		return
+	}
+	serverTracker.Move(old, new)
+	reconnects.Move(old, new)
+	if healthChecker != nil {
+		healthChecker.Move(old, new)
+	}
+}
+
+// renameServer changes the name of a server without changing its address. Everything referring to the
+// server by name (the default server, server groups, the lobby failover fallback, the GeoIP lobbies and the
+// join queue) is updated to use the new name. The rename is rejected if console aliases refer to the server,
+// as the commands of aliases can't be rewritten reliably.
+func renameServer(old, new string) error {
+	if aliases := aliasesReferring(currentConfig().Aliases, old); len(aliases) > 0 {
+		return fmt.Errorf("the aliases %s refer to %s, update them before renaming it", strings.Join(aliases, ", "), old)
+	}
+	if err := serverRegistry.Rename(old, new); err != nil {
+		return err
+	}
+	updateConfig(func(conf *ServerConfig) {
+		conf.Servers = serverRegistry.Servers()
+		conf.DefaultServer, _ = serverRegistry.Lobby()
+		// The groups and lobbies are shared with the previous config, which may still be read, so they are
+		// replaced instead of being modified.
+		groups := make(map[string][]string, len(conf.ServerGroups))
+		for group, members := range conf.ServerGroups {
+			groups[group] = slices.Clone(members)
+			for i, member := range members {
+				if member == old {
+					groups[group][i] = new
+				}
+			}
+		}
+		conf.ServerGroups = groups
+		if conf.LobbyFailover.Fallback == old {
+			conf.LobbyFailover.Fallback = new
+		}
+		lobbies := make(map[string]string, len(conf.GeoIP.Lobbies))
+		for region, lobby := range conf.GeoIP.Lobbies {
+			if lobby == old {
+				lobby = new
+			}
+			lobbies[region] = lobby
+		}
+		conf.GeoIP.Lobbies = lobbies
+	})
+	geoRouter.RenameLobby(old, new)
+	joinQueue.Rename(old, new)
+	return nil
+}
+
+// sessionsOnServer returns all sessions currently connected to the server with the given address.
+func sessionsOnServer(proxy *spectrum.Spectrum, addr string) []*session.Session {
+	var sessions []*session.Session
+	for _, xuid := range serverTracker.Players(addr) {
+		if s := proxy.Registry().GetSession(xuid); s != nil {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// moveToLobby transfers the given sessions to the lobby server.
+func moveToLobby(sessions []*session.Session, logger *slog.Logger) {
+	lobbyName, lobby := serverRegistry.Lobby()
+	moveToServer(sessions, lobbyName, lobby, logger)
+}
+
+// moveToServer transfers the given sessions to the named server at addr.
+func moveToServer(sessions []*session.Session, server, addr string, logger *slog.Logger) {
+	for _, s := range sessions {
+		go func(s *session.Session) {
+			name := s.Client().IdentityData().DisplayName
+			if err := transferSession(s, server, addr); err != nil {
+				logger.Error("Failed to move player", "player", name, "server", server, "error", err)
+				return
+			}
+			logger.Info(fmt.Sprintf("Moved %s to %s", name, server))
+		}(s)
+	}
+}
+
+// validateAddr checks that addr is a valid host:port pair.
+func validateAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host in address %s", addr)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port in address %s", addr)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum"
+)
+
+// useServers replaces the server registry, the server tracker and the reconnect reservations with ones
+// holding only servers for the duration of the test. The first server is the default server.
+func useServers(t *testing.T, servers ...Server) {
+	t.Helper()
+	registry, tracker, reservations := serverRegistry, serverTracker, reconnects
+	t.Cleanup(func() { serverRegistry, serverTracker, reconnects = registry, tracker, reservations })
+
+	serverRegistry, serverTracker, reconnects = NewServerRegistry(), NewServerTracker(), NewReconnectReservations()
+	if err := serverRegistry.Set(servers, servers[0].Name); err != nil {
+		t.Fatalf("set servers: %v", err)
+	}
+	useConfig(t, &ServerConfig{Servers: servers, DefaultServer: servers[0].Name})
+}
+
+// useConfig makes conf the live config for the duration of the test.
+func useConfig(t *testing.T, conf *ServerConfig) {
+	t.Helper()
+	previous := liveConfig.Load()
+	t.Cleanup(func() { liveConfig.Store(previous) })
+	liveConfig.Store(conf)
+}
+
+func TestSetServerAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string
+		addr    string
+		wantErr bool
+	}{
+		{name: "new address", server: "island", addr: "10.0.0.2:19134"},
+		{name: "same address", server: "island", addr: "127.0.0.1:19134"},
+		{name: "unknown server", server: "missing", addr: "10.0.0.2:19134", wantErr: true},
+		{name: "address of another server", server: "island", addr: "127.0.0.1:19133", wantErr: true},
+		{name: "missing port", server: "island", addr: "10.0.0.2", wantErr: true},
+		{name: "invalid port", server: "island", addr: "10.0.0.2:99999", wantErr: true},
+		{name: "missing host", server: "island", addr: ":19134", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+			old, err := setServerAddr(tt.server, tt.addr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("setServerAddr(%q, %q) succeeded, want an error", tt.server, tt.addr)
+				}
+				if addr, _ := serverRegistry.Lookup("island"); addr != "127.0.0.1:19134" {
+					t.Fatalf("address of island changed to %s after a failed update", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setServerAddr(%q, %q) = %v", tt.server, tt.addr, err)
+			}
+			if old != "127.0.0.1:19134" {
+				t.Errorf("setServerAddr returned previous address %s, want 127.0.0.1:19134", old)
+			}
+			if addr, _ := serverRegistry.Lookup(tt.server); addr != tt.addr {
+				t.Errorf("Lookup(%q) = %s, want %s", tt.server, addr, tt.addr)
+			}
+			if name, ok := serverRegistry.Name(tt.addr); !ok || name != tt.server {
+				t.Errorf("Name(%q) = %q, %v, want %q", tt.addr, name, ok, tt.server)
+			}
+			if old != tt.addr {
+				if name, ok := serverRegistry.Name(old); ok {
+					t.Errorf("the previous address still resolves to %q", name)
+				}
+			}
+			if servers := currentConfig().Servers; len(servers) != 2 || servers[1].Addr != tt.addr {
+				t.Errorf("conf.Servers = %+v, want the new address mirrored", servers)
+			}
+		})
+	}
+}
+
+func TestSetServerAddrMovesState(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+	serverTracker.Set("1", "127.0.0.1:19134")
+	serverTracker.Set("2", "127.0.0.1:19133")
+	reconnects.Reserve("3", "127.0.0.1:19134", time.Minute)
+
+	if _, err := setServerAddr("island", "10.0.0.2:19134"); err != nil {
+		t.Fatal(err)
+	}
+	if got := serverTracker.Count("10.0.0.2:19134"); got != 1 {
+		t.Errorf("%d player(s) tracked on the new address, want 1", got)
+	}
+	if got := serverTracker.Count("127.0.0.1:19134"); got != 0 {
+		t.Errorf("%d player(s) still tracked on the previous address, want 0", got)
+	}
+	if addr, _ := serverTracker.Server("2"); addr != "127.0.0.1:19133" {
+		t.Errorf("player on another server moved to %s", addr)
+	}
+	if addr, ok := reconnects.Take("3"); !ok || addr != "10.0.0.2:19134" {
+		t.Errorf("reconnect reservation returns to %s, %v, want 10.0.0.2:19134", addr, ok)
+	}
+}
+
+// captureLogs makes the default logger write to the returned buffer for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	logger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	buf := &bytes.Buffer{}
+	slog.SetDefault(slog.New(slog.NewTextHandler(buf, nil)))
+	return buf
+}
+
+func TestAddServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string
+		addr    string
+		wantErr bool
+	}{
+		{name: "new server", server: "island", addr: "127.0.0.1:19134"},
+		{name: "name taken", server: "lobby", addr: "127.0.0.1:19134", wantErr: true},
+		{name: "address taken", server: "island", addr: "127.0.0.1:19133", wantErr: true},
+		{name: "invalid address", server: "island", addr: "island", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+			err := addServer(tt.server, tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addServer(%q, %q) = %v, want error %v", tt.server, tt.addr, err, tt.wantErr)
+			}
+			want := 2
+			if tt.wantErr {
+				want = 1
+			}
+			if got := len(serverRegistry.Servers()); got != want {
+				t.Fatalf("%d server(s) registered, want %d", got, want)
+			}
+			if !tt.wantErr {
+				if addr, _ := serverRegistry.Lookup(tt.server); addr != tt.addr {
+					t.Errorf("Lookup(%q) = %s, want %s", tt.server, addr, tt.addr)
+				}
+				if servers := currentConfig().Servers; len(servers) != 2 {
+					t.Errorf("conf.Servers = %+v, want the server mirrored", servers)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string
+		wantErr bool
+	}{
+		{name: "server", server: "island"},
+		{name: "default server", server: "lobby", wantErr: true},
+		{name: "unknown server", server: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+			addr, err := removeServer(tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("removeServer(%q) = %v, want error %v", tt.server, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got := len(serverRegistry.Servers()); got != 2 {
+					t.Fatalf("%d server(s) registered after a failed removal, want 2", got)
+				}
+				return
+			}
+			if addr != "127.0.0.1:19134" {
+				t.Errorf("removeServer returned %s, want 127.0.0.1:19134", addr)
+			}
+			if _, ok := serverRegistry.Lookup(tt.server); ok {
+				t.Errorf("%s is still registered", tt.server)
+			}
+			if _, ok := serverRegistry.Name(addr); ok {
+				t.Errorf("%s still resolves to a server", addr)
+			}
+			if servers := currentConfig().Servers; len(servers) != 1 {
+				t.Errorf("conf.Servers = %+v, want the removal mirrored", servers)
+			}
+		})
+	}
+}
+
+func TestRemoveServerWarnsAboutPlayers(t *testing.T) {
+	tests := []struct {
+		name    string
+		players int
+		want    bool
+	}{
+		{name: "empty", players: 0, want: false},
+		{name: "players present", players: 2, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "island", Addr: "127.0.0.1:19134"})
+			for i := range tt.players {
+				serverTracker.Set(strconv.Itoa(i), "127.0.0.1:19134")
+			}
+			logs := captureLogs(t)
+
+			handleServerCommand([]string{"remove", "island"}, nil, &ServerConfig{})
+			if got := strings.Contains(logs.String(), "still connected to island"); got != tt.want {
+				t.Fatalf("warned about players = %v, want %v, logs:\n%s", got, tt.want, logs)
+			}
+		})
+	}
+}
+
+func TestRemoveServerReferences(t *testing.T) {
+	servers := []Server{{Name: "lobby", Addr: "127.0.0.1:19133"}, {Name: "island", Addr: "127.0.0.1:19134"}, {Name: "arena", Addr: "127.0.0.1:19135"}}
+	useServers(t, servers...)
+	groups := map[string][]string{"games": {"island", "arena"}, "solo": {"island"}}
+	lobbies := map[string]string{"EU": "island", "NA": "lobby"}
+	useConfig(t, &ServerConfig{Servers: servers, DefaultServer: "lobby", ServerGroups: groups, GeoIP: GeoIP{Lobbies: lobbies}})
+
+	if _, err := removeServer("island"); err != nil {
+		t.Fatal(err)
+	}
+	conf := currentConfig()
+	if want := map[string][]string{"games": {"arena"}, "solo": {}}; !reflect.DeepEqual(conf.ServerGroups, want) {
+		t.Errorf("conf.ServerGroups = %v, want %v", conf.ServerGroups, want)
+	}
+	if want := map[string]string{"NA": "lobby"}; !reflect.DeepEqual(conf.GeoIP.Lobbies, want) {
+		t.Errorf("conf.GeoIP.Lobbies = %v, want %v", conf.GeoIP.Lobbies, want)
+	}
+	// The previous config may still be read, so it must not change.
+	if !slices.Equal(groups["games"], []string{"island", "arena"}) || lobbies["EU"] != "island" {
+		t.Errorf("the previous config was modified: groups %v, lobbies %v", groups, lobbies)
+	}
+}
+
+func TestRemoveServerFailoverFallback(t *testing.T) {
+	servers := []Server{{Name: "lobby", Addr: "127.0.0.1:19133"}, {Name: "hub", Addr: "127.0.0.1:19134"}}
+	useServers(t, servers...)
+	useConfig(t, &ServerConfig{Servers: servers, DefaultServer: "lobby", LobbyFailover: LobbyFailover{Fallback: "hub"}})
+	if _, err := removeServer("hub"); err == nil {
+		t.Fatal("removeServer removed the lobby failover fallback")
+	}
+	if _, ok := serverRegistry.Lookup("hub"); !ok {
+		t.Fatal("the lobby failover fallback was unregistered")
+	}
+}
+
+func TestRemoveServerMove(t *testing.T) {
+	const lobby, island, arena = "127.0.0.1:19133", "127.0.0.1:19134", "127.0.0.1:19135"
+	tests := []struct {
+		name        string
+		args        []string
+		wantRemoved bool
+		wantDial    string
+	}{
+		{name: "to the lobby", args: []string{"remove", "island", "move"}, wantRemoved: true, wantDial: lobby},
+		{name: "to another server", args: []string{"remove", "island", "move", "arena"}, wantRemoved: true, wantDial: arena},
+		{name: "to an unknown server", args: []string{"remove", "island", "move", "missing"}},
+		{name: "to the removed server", args: []string{"remove", "island", "move", "island"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: lobby}, Server{Name: "island", Addr: island}, Server{Name: "arena", Addr: arena})
+			useTransferHooks(t)
+			transport := &fakeTransport{}
+			proxy := spectrum.NewSpectrum(LobbyDiscovery{}, slog.New(slog.DiscardHandler), nil, transport)
+			s, _ := newTestSession(t, "1", "Steve", transport)
+			proxy.Registry().AddSession("1", s)
+			serverTracker.Set("1", island)
+
+			handleServerCommand(tt.args, proxy, currentConfig())
+			if _, ok := serverRegistry.Lookup("island"); ok == tt.wantRemoved {
+				t.Fatalf("island registered = %v after the command, want %v", ok, !tt.wantRemoved)
+			}
+			if tt.wantDial != "" {
+				completePendingTransfer(t, s, tt.wantDial)
+			}
+			if got := transport.dialed(); tt.wantDial == "" && len(got) != 0 || tt.wantDial != "" && !slices.Equal(got, []string{tt.wantDial}) {
+				t.Fatalf("dialed %v, want %q", got, tt.wantDial)
+			}
+		})
+	}
+}
+
+func TestRenameServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		aliases map[string]string
+		wantErr bool
+	}{
+		{name: "rename", old: "island", new: "skyblock"},
+		{name: "name taken", old: "island", new: "lobby", wantErr: true},
+		{name: "unknown server", old: "missing", new: "skyblock", wantErr: true},
+		{name: "referred to by an alias", old: "island", new: "skyblock", aliases: map[string]string{"is": "transfer island"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := []Server{{Name: "lobby", Addr: "127.0.0.1:19133"}, {Name: "island", Addr: "127.0.0.1:19134"}}
+			useServers(t, servers...)
+			conf := &ServerConfig{
+				Servers:       servers,
+				DefaultServer: "lobby",
+				ServerGroups:  map[string][]string{"games": {"island"}},
+				LobbyFailover: LobbyFailover{Fallback: "island"},
+				GeoIP:         GeoIP{Lobbies: map[string]string{"EU": "island"}},
+				Aliases:       tt.aliases,
+			}
+			useConfig(t, conf)
+
+			// Sessions pick group members while the server is renamed.
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						_, _, _ = selectGroupServer("games")
+						_, _ = lobbyFailoverAddr()
+					}
+				}
+			}()
+			err := renameServer(tt.old, tt.new)
+			close(done)
+			wg.Wait()
+
+			want := "island"
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("renameServer(%q, %q) succeeded, want an error", tt.old, tt.new)
+				}
+				if currentConfig() != conf {
+					t.Fatal("the config changed after a failed rename")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("renameServer(%q, %q) = %v", tt.old, tt.new, err)
+				}
+				want = tt.new
+			}
+
+			got := currentConfig()
+			if got.ServerGroups["games"][0] != want || got.LobbyFailover.Fallback != want || got.GeoIP.Lobbies["EU"] != want {
+				t.Errorf("group member %s, fallback %s and GeoIP lobby %s after the rename, want %s", got.ServerGroups["games"][0], got.LobbyFailover.Fallback, got.GeoIP.Lobbies["EU"], want)
+			}
+			if name, addr, err := selectGroupServer("games"); err != nil || name != want || addr != "127.0.0.1:19134" {
+				t.Errorf("selectGroupServer(games) = %s, %s, %v, want %s", name, addr, err, want)
+			}
+			if conf.ServerGroups["games"][0] != "island" || conf.GeoIP.Lobbies["EU"] != "island" || conf.LobbyFailover.Fallback != "island" {
+				t.Error("renaming modified the config in use before the rename")
+			}
+		})
+	}
+}
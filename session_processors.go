@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+const sessionCommandUsage = "Usage: session processors <player>"
+
+// attachedProcessors records the processors set on each session. Spectrum only keeps the processor itself,
+// so this is the only way to tell which processors a session has.
+var attachedProcessors = NewProcessorRegistry()
+
+// ProcessorRegistry keeps track of the processor of each session.
+type ProcessorRegistry struct {
+	mu         sync.RWMutex
+	processors map[*session.Session]session.Processor
+}
+
+// NewProcessorRegistry creates a new, empty ProcessorRegistry.
+func NewProcessorRegistry() *ProcessorRegistry {
+	return &ProcessorRegistry{processors: make(map[*session.Session]session.Processor)}
+}
+
+// Set records p as the processor of s.
+func (r *ProcessorRegistry) Set(s *session.Session, p session.Processor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processors[s] = p
+}
+
+// Remove forgets the processor of s.
+func (r *ProcessorRegistry) Remove(s *session.Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.processors, s)
+}
+
+// Names returns the type names of the processors of s in the order they are called, with processor chains
+// expanded. It returns false if no processor was recorded for s.
+func (r *ProcessorRegistry) Names(s *session.Session) ([]string, bool) {
+	r.mu.RLock()
+	p, ok := r.processors[s]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return processorNames(p), true
+}
+
+// processorNames returns the type names of p, or of the processors in it if it is a ProcessorChain.
+func processorNames(p session.Processor) []string {
+	chain, ok := p.(*ProcessorChain)
+	if !ok {
+		return []string{fmt.Sprintf("%T", p)}
+	}
+	var names []string
+	for _, p := range chain.processors {
+		names = append(names, processorNames(p)...)
+	}
+	return names
+}
+
+// setProcessor sets the processor of s and records it in attachedProcessors.
+func setProcessor(s *session.Session, p session.Processor) {
+	s.SetProcessor(p)
+	attachedProcessors.Set(s, p)
+}
+
+// handleSessionCommand processes the subcommands of the session command.
+func handleSessionCommand(args []string, proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	if len(args) < 2 || args[0] != "processors" {
+		logger.Info(sessionCommandUsage)
+		return
+	}
+
+	s := findSession(proxy, args[1])
+	if s == nil {
+		logger.Info(fmt.Sprintf("Player '%s' not found", args[1]))
+		return
+	}
+	names, ok := attachedProcessors.Names(s)
+	if !ok {
+		logger.Info(fmt.Sprintf("%s has no processors yet", args[1]))
+		return
+	}
+	logger.Info(fmt.Sprintf("Processors of %s: %s", args[1], strings.Join(names, " -> ")))
+}
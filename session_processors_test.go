@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+func TestProcessorRegistryNames(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+	s, _ := newTestSession(t, "1", "Steve", &fakeTransport{})
+	registry := NewProcessorRegistry()
+	if _, ok := registry.Names(s); ok {
+		t.Fatal("Names() reported processors for a session without any")
+	}
+
+	transfer := &TransferProcessor{s: s}
+	registry.Set(s, transfer)
+	if got, _ := registry.Names(s); !slices.Equal(got, []string{"*main.TransferProcessor"}) {
+		t.Fatalf("Names() = %v for a single processor", got)
+	}
+
+	// Chains are expanded, including chains nested in other chains.
+	chain := NewProcessorChain(NewChatLimitProcessor(s, ChatRate{}), NewProcessorChain(transfer, session.NopProcessor{}))
+	registry.Set(s, chain)
+	want := []string{"*main.ChatLimitProcessor", "*main.TransferProcessor", "session.NopProcessor"}
+	if got, _ := registry.Names(s); !slices.Equal(got, want) {
+		t.Fatalf("Names() = %v, want %v", got, want)
+	}
+
+	registry.Remove(s)
+	if _, ok := registry.Names(s); ok {
+		t.Fatal("Names() reported processors for a removed session")
+	}
+}
+
+func TestSessionProcessorsCommand(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"})
+	transport := &fakeTransport{}
+	proxy := spectrum.NewSpectrum(LobbyDiscovery{}, slog.New(slog.DiscardHandler), nil, transport)
+	s, _ := newTestSession(t, "1", "Steve", transport)
+	proxy.Registry().AddSession("1", s)
+	t.Cleanup(func() { attachedProcessors.Remove(s) })
+
+	tests := []struct {
+		name string
+		args []string
+		set  session.Processor
+		want string
+	}{
+		{name: "usage", args: []string{"processors"}, want: sessionCommandUsage},
+		{name: "unknown player", args: []string{"processors", "Alex"}, want: "Player 'Alex' not found"},
+		{name: "no processors", args: []string{"processors", "Steve"}, want: "Steve has no processors yet"},
+		{
+			name: "processors",
+			args: []string{"processors", "Steve"},
+			set:  NewProcessorChain(NewChatLimitProcessor(s, ChatRate{}), &TransferProcessor{s: s}),
+			want: "Processors of Steve: *main.ChatLimitProcessor -> *main.TransferProcessor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.set != nil {
+				setProcessor(s, tt.set)
+			}
+			logs := captureLogs(t)
+			handleSessionCommand(tt.args, proxy)
+			if !strings.Contains(logs.String(), tt.want) {
+				t.Fatalf("output does not contain %q:\n%s", tt.want, logs)
+			}
+		})
+	}
+}
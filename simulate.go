@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+const simulateCommandUsage = "Usage: simulate disconnect <player> (testing only)"
+
+// errSimulatedDisconnect is the error the backend connection is closed with by 'simulate disconnect'.
+var errSimulatedDisconnect = errors.New("simulated disconnect")
+
+// findSession returns the session of the online player with the given display name, or nil if there is
+// no such player.
+func findSession(proxy *spectrum.Spectrum, name string) *session.Session {
+	for _, s := range proxy.Registry().GetSessions() {
+		if s.Client().IdentityData().DisplayName == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// handleSimulateCommand processes the subcommands of the simulate command. It is meant for testing how the
+// proxy handles failures and should not be used on players that aren't aware of it.
+func handleSimulateCommand(args []string, proxy *spectrum.Spectrum) {
+	logger := slog.Default()
+	if len(args) < 2 || args[0] != "disconnect" {
+		logger.Info(simulateCommandUsage)
+		return
+	}
+
+	s := findSession(proxy, args[1])
+	if s == nil {
+		logger.Info(fmt.Sprintf("Player '%s' not found", args[1]))
+		return
+	}
+	if err := simulateDisconnect(s); err != nil {
+		logger.Error("Failed to simulate disconnect", "player", args[1], "error", err)
+		return
+	}
+	logger.Info(fmt.Sprintf("Closed the backend connection of %s, the player should fall back to the lobby", args[1]))
+}
+
+// simulateDisconnect closes the connection between the proxy and the backend of s, the same way a backend
+// crash or network failure would. Spectrum then moves the player to the fallback server.
+func simulateDisconnect(s *session.Session) error {
+	conn := s.Server()
+	if conn == nil {
+		return fmt.Errorf("session has no server connection")
+	}
+	conn.CloseWithError(errSimulatedDisconnect)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SlowMode configures the delay added to logins while the default server is busy.
+type SlowMode struct {
+	// HighWater is the number of players on the default server at which slow mode engages. Zero disables
+	// slow mode.
+	HighWater int `toml:"high_water"`
+	// LowWater is the number of players on the default server at which slow mode disengages again.
+	LowWater int `toml:"low_water"`
+	// DelayMillis is how long logins are held back while slow mode is engaged.
+	DelayMillis int `toml:"delay_millis"`
+}
+
+// loginSlowdown tracks whether slow mode is engaged. It is nil if slow mode is disabled.
+var loginSlowdown *SlowModeState
+
+// SlowModeState engages slow mode when the player count reaches the high-water mark and disengages it
+// once the count dropped to the low-water mark, so that it doesn't flap around a single threshold.
+type SlowModeState struct {
+	conf SlowMode
+	log  *slog.Logger
+
+	mu      sync.Mutex
+	engaged bool
+}
+
+// NewSlowModeState creates a SlowModeState for the configuration.
+func NewSlowModeState(conf SlowMode, log *slog.Logger) *SlowModeState {
+	return &SlowModeState{conf: conf, log: log}
+}
+
+// Update updates the state for the given number of players on the default server and returns whether
+// slow mode is engaged.
+func (s *SlowModeState) Update(players int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.engaged && players >= s.conf.HighWater:
+		s.engaged = true
+		s.log.Warn("Slow mode engaged, delaying logins", "players", players, "delay", s.delay())
+	case s.engaged && players <= s.conf.LowWater:
+		s.engaged = false
+		s.log.Info("Slow mode disengaged", "players", players)
+	}
+	return s.engaged
+}
+
+// Delay returns how long a new login should be held back, based on the current number of players on the
+// default server.
+func (s *SlowModeState) Delay() time.Duration {
+	if s == nil {
+		return 0
+	}
+	_, lobby := serverRegistry.Lobby()
+	if !s.Update(serverTracker.Count(lobby)) {
+		return 0
+	}
+	return s.delay()
+}
+
+func (s *SlowModeState) delay() time.Duration {
+	return time.Duration(s.conf.DelayMillis) * time.Millisecond
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowModeThresholds(t *testing.T) {
+	logs := captureLogs(t)
+	state := NewSlowModeState(SlowMode{HighWater: 10, LowWater: 5, DelayMillis: 500}, slog.Default())
+	steps := []struct {
+		players int
+		want    bool
+	}{
+		{players: 9, want: false},
+		{players: 10, want: true},
+		{players: 7, want: true},
+		{players: 6, want: true},
+		{players: 5, want: false},
+		{players: 8, want: false},
+		{players: 12, want: true},
+	}
+	for _, step := range steps {
+		if got := state.Update(step.players); got != step.want {
+			t.Fatalf("Update(%d) = %v, want %v", step.players, got, step.want)
+		}
+	}
+	if n := strings.Count(logs.String(), "Slow mode engaged"); n != 2 {
+		t.Fatalf("slow mode engaged %d times, want 2:\n%s", n, logs)
+	}
+	if n := strings.Count(logs.String(), "Slow mode disengaged"); n != 1 {
+		t.Fatalf("slow mode disengaged %d times, want 1:\n%s", n, logs)
+	}
+}
+
+func TestSlowModeDelay(t *testing.T) {
+	useServers(t, Server{Name: "lobby", Addr: "127.0.0.1:19133"}, Server{Name: "survival", Addr: "127.0.0.1:19134"})
+	state := NewSlowModeState(SlowMode{HighWater: 2, LowWater: 1, DelayMillis: 500}, slog.New(slog.DiscardHandler))
+	if got := state.Delay(); got != 0 {
+		t.Fatalf("Delay() = %v with an empty lobby, want 0", got)
+	}
+
+	// Players on other servers don't count towards the lobby's load.
+	for i := range 3 {
+		serverTracker.Set(strconv.Itoa(i), "127.0.0.1:19134")
+	}
+	if got := state.Delay(); got != 0 {
+		t.Fatalf("Delay() = %v with players on another server, want 0", got)
+	}
+
+	serverTracker.Set("10", "127.0.0.1:19133")
+	serverTracker.Set("11", "127.0.0.1:19133")
+	if got := state.Delay(); got != 500*time.Millisecond {
+		t.Fatalf("Delay() = %v with a busy lobby, want 500ms", got)
+	}
+	serverTracker.Remove("11")
+	if got := state.Delay(); got != 0 {
+		t.Fatalf("Delay() = %v after the lobby dropped to the low-water mark, want 0", got)
+	}
+
+	var disabled *SlowModeState
+	if got := disabled.Delay(); got != 0 {
+		t.Fatalf("Delay() = %v with slow mode disabled, want 0", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultBedrockPort is the port used for server addresses without a port whose SRV lookup failed.
+const defaultBedrockPort = "19132"
+
+// needsSRV reports if the address of srv is resolved through an SRV record, which is the case if it is
+// flagged as such or if its address has no port.
+func needsSRV(srv Server) bool {
+	if srv.SRV || srv.host != "" {
+		return true
+	}
+	_, _, err := net.SplitHostPort(srv.Addr)
+	return err != nil
+}
+
+// lookupSRV resolves the _minecraft._udp SRV record of host and returns the address of its preferred
+// target.
+func lookupSRV(host string) (string, error) {
+	_, records, err := net.LookupSRV("minecraft", "udp", host)
+	if err != nil {
+		return "", err
+	}
+	// The records are sorted by priority and randomized by weight, so the first one is preferred.
+	target := strings.TrimSuffix(records[0].Target, ".")
+	return net.JoinHostPort(target, strconv.Itoa(int(records[0].Port))), nil
+}
+
+// resolveServer resolves the address of srv through its SRV record if needed. If the lookup fails, the
+// configured address is used as is, with the default port if it has none.
+func resolveServer(srv Server, logger *slog.Logger) Server {
+	if !needsSRV(srv) {
+		return srv
+	}
+	if srv.host == "" {
+		srv.host = srv.Addr
+	}
+	host := srv.host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	addr, err := lookupSRV(host)
+	if err != nil {
+		addr = srv.host
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, defaultBedrockPort)
+		}
+		logger.Warn("SRV lookup failed, using the configured address", "server", srv.Name, "host", host, "address", addr, "error", err)
+	} else {
+		logger.Debug("Resolved SRV record", "server", srv.Name, "host", host, "address", addr)
+	}
+	srv.Addr = addr
+	return srv
+}
+
+// resolveServers resolves the addresses of the servers that need an SRV lookup.
+func resolveServers(servers []Server, logger *slog.Logger) []Server {
+	resolved := make([]Server, len(servers))
+	for i, srv := range servers {
+		resolved[i] = resolveServer(srv, logger)
+	}
+	return resolved
+}
+
+// configServers returns the servers as they are written to the config file, with the configured rather
+// than the resolved address of servers resolved through SRV.
+func configServers(servers []Server) []Server {
+	servers = slices.Clone(servers)
+	for i := range servers {
+		if servers[i].host != "" {
+			servers[i].Addr = servers[i].host
+		}
+	}
+	return servers
+}
+
+// refreshSRV resolves the SRV records of the servers in the registry again at the given interval until
+// ctx is done, so that servers moved behind DNS are followed.
+func refreshSRV(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, srv := range serverRegistry.Servers() {
+			if srv.host == "" {
+				continue
+			}
+			resolved := resolveServer(srv, logger)
+			if resolved.Addr == srv.Addr {
+				continue
+			}
+			if err := serverRegistry.Resolve(srv.Name, resolved.Addr); err != nil {
+				logger.Error("Failed to update the address of a server", "server", srv.Name, "error", err)
+				continue
+			}
+			moveServerState(srv.Addr, resolved.Addr)
+			logger.Info("Server address changed", "server", srv.Name, "old", srv.Addr, "new", resolved.Addr)
+		}
+	}
+}
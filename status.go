@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// Motd configures a server list entry that changes with the state of the proxy. The placeholders
+// {online}, {max} and {servers} are replaced with the number of players online, the maximum number of
+// players and the number of configured servers on every ping.
+type Motd struct {
+	// Text is shown as the name in the server list instead of Name if set.
+	Text string `toml:"text"`
+	// SubTitles are shown in turn as the sub name instead of SubName if set.
+	SubTitles []string `toml:"sub_titles"`
+	// RotateSeconds is how long each sub title is shown.
+	RotateSeconds int `toml:"rotate_seconds"`
+}
+
+// statusProvider provides the status shown in the server list. It can be updated at runtime with the
+// status reload command.
+var statusProvider *StatusProvider
+
+// StatusProvider implements minecraft.ServerStatusProvider with values that can be updated while the
+// proxy is running.
+type StatusProvider struct {
+	mu       sync.RWMutex
+	name     string
+	subNames []string
+	rotate   time.Duration
+	// maintenanceMotd is shown as the sub name while maintenance mode is on, if not empty.
+	maintenanceMotd string
+	maxPlayers      int
+	online          func() int
+}
+
+// NewStatusProvider creates a StatusProvider showing the status configured in conf.
+func NewStatusProvider(conf *ServerConfig) *StatusProvider {
+	p := &StatusProvider{}
+	p.Update(conf)
+	return p
+}
+
+// Update applies the status configured in conf.
+func (p *StatusProvider) Update(conf *ServerConfig) {
+	name := conf.Name
+	if conf.Motd.Text != "" {
+		name = conf.Motd.Text
+	}
+	subNames := conf.Motd.SubTitles
+	if len(subNames) == 0 && conf.SubName != "" {
+		subNames = []string{conf.SubName}
+	} else if len(subNames) == 0 {
+		subNames = []string{conf.Name}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.name, p.subNames, p.maxPlayers = name, subNames, conf.MaxPlayers
+	p.maintenanceMotd = conf.Maintenance.Motd
+	p.rotate = time.Duration(max(conf.Motd.RotateSeconds, 1)) * time.Second
+}
+
+// SetOnline makes the status show the player count returned by online instead of the listener's.
+func (p *StatusProvider) SetOnline(online func() int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.online = online
+}
+
+// ServerStatus returns the status shown in the server list. The configured maximum number of players is
+// shown if set, otherwise the listener's.
+func (p *StatusProvider) ServerStatus(playerCount, maxPlayers int) minecraft.ServerStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.maxPlayers > 0 {
+		maxPlayers = p.maxPlayers
+	}
+	if p.online != nil {
+		playerCount = p.online()
+	}
+	subName := p.subNames[int(time.Now().UnixNano()/int64(p.rotate))%len(p.subNames)]
+	if maintenance.Enabled() && p.maintenanceMotd != "" {
+		subName = p.maintenanceMotd
+	}
+
+	placeholders := strings.NewReplacer(
+		"{online}", strconv.Itoa(playerCount),
+		"{max}", strconv.Itoa(maxPlayers),
+		"{servers}", strconv.Itoa(len(serverRegistry.All())),
+	)
+	return minecraft.ServerStatus{
+		ServerName:    placeholders.Replace(p.name),
+		ServerSubName: placeholders.Replace(subName),
+		PlayerCount:   playerCount,
+		MaxPlayers:    maxPlayers,
+	}
+}
+
+// handleStatusCommand processes the subcommands of the status command.
+func handleStatusCommand(args []string) {
+	logger := slog.Default()
+	if len(args) == 0 || args[0] != "reload" {
+		logger.Info("Usage: status reload")
+		return
+	}
+
+	newConf, err := loadConfig(false)
+	if err != nil {
+		logger.Error("Failed to read config", "error", err)
+		return
+	}
+	conf := updateConfig(func(conf *ServerConfig) {
+		conf.Name, conf.SubName, conf.MaxPlayers, conf.Motd = newConf.Name, newConf.SubName, newConf.MaxPlayers, newConf.Motd
+	})
+	statusProvider.Update(conf)
+	logger.Info(fmt.Sprintf("Reloaded status: name=%q, max players=%d", conf.Name, conf.MaxPlayers))
+}
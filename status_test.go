@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStatusReload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	conf := defaultConfig()
+	useServers(t, conf.Servers...)
+	useConfig(t, conf)
+	provider := statusProvider
+	t.Cleanup(func() { statusProvider = provider })
+	statusProvider = NewStatusProvider(conf)
+
+	newConf := defaultConfig()
+	newConf.Name = "Network"
+	newConf.MaxPlayers = 50
+	newConf.Motd = Motd{Text: "{online}/{max} online", SubTitles: []string{"Play now"}}
+	if err := writeConfig(newConf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The listener answers pings while the status is reloaded.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				statusProvider.ServerStatus(3, 100)
+				_ = currentConfig().MaxPlayers
+			}
+		}
+	}()
+	handleStatusCommand([]string{"reload"})
+	close(done)
+	wg.Wait()
+
+	status := statusProvider.ServerStatus(3, 100)
+	if status.ServerName != "3/50 online" || status.ServerSubName != "Play now" || status.MaxPlayers != 50 {
+		t.Fatalf("status provider shows %+v, want the reloaded values", status)
+	}
+	if got := currentConfig(); got.Name != "Network" || got.MaxPlayers != 50 || got.Motd.Text != newConf.Motd.Text {
+		t.Errorf("live config has name %q, max players %d and motd %q, want the reloaded values", got.Name, got.MaxPlayers, got.Motd.Text)
+	}
+	if conf.Name != "Spectrum Proxy" || conf.MaxPlayers != 0 {
+		t.Error("reloading the status modified the config in use before the reload")
+	}
+}
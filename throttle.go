@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConnectionThrottle limits how often a single IP may connect to the proxy.
+type ConnectionThrottle struct {
+	// MaxConnections is the number of connections an IP may make per window. Zero disables the throttle.
+	MaxConnections int `toml:"max_connections"`
+	// WindowSeconds is the length of the window connections are counted in.
+	WindowSeconds int `toml:"window_seconds"`
+	// Message is the disconnect message shown to throttled players. {cooldown} is replaced with the
+	// number of seconds until they may connect again.
+	Message string `toml:"message"`
+}
+
+// IPThrottle counts the connections of each IP in fixed windows starting at the first connection.
+type IPThrottle struct {
+	max    int
+	window time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*throttleWindow
+	lastPrune time.Time
+}
+
+// throttleWindow is the window of a single IP.
+type throttleWindow struct {
+	start time.Time
+	count int
+}
+
+// NewIPThrottle creates an IPThrottle allowing max connections per IP within window.
+func NewIPThrottle(max int, window time.Duration) *IPThrottle {
+	return &IPThrottle{max: max, window: window, windows: make(map[string]*throttleWindow), lastPrune: time.Now()}
+}
+
+// Allow counts a connection of ip at now. If the IP has used up its connections, false is returned with
+// the time remaining until its window ends.
+func (t *IPThrottle) Allow(ip string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.lastPrune) >= t.window {
+		t.prune(now)
+	}
+
+	w, ok := t.windows[ip]
+	if !ok || now.Sub(w.start) >= t.window {
+		t.windows[ip] = &throttleWindow{start: now, count: 1}
+		return 0, true
+	}
+	if w.count >= t.max {
+		return w.start.Add(t.window).Sub(now), false
+	}
+	w.count++
+	return 0, true
+}
+
+// prune removes the windows that have ended. t.mu must be held.
+func (t *IPThrottle) prune(now time.Time) {
+	for ip, w := range t.windows {
+		if now.Sub(w.start) >= t.window {
+			delete(t.windows, ip)
+		}
+	}
+	t.lastPrune = now
+}
+
+// cooldownSeconds formats the remaining cooldown as whole seconds, rounded up so that players retrying
+// after the given time are never rejected again.
+func cooldownSeconds(remaining time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(remaining.Seconds())))
+}
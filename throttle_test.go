@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPThrottleCooldown(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name         string
+		attempts     []time.Duration
+		wantAllowed  bool
+		wantCooldown time.Duration
+	}{
+		{name: "within the limit", attempts: []time.Duration{0, time.Second}, wantAllowed: true},
+		{name: "over the limit", attempts: []time.Duration{0, time.Second, 4 * time.Second}, wantCooldown: 6 * time.Second},
+		{name: "end of the window", attempts: []time.Duration{0, time.Second, 9500 * time.Millisecond}, wantCooldown: 500 * time.Millisecond},
+		{name: "new window", attempts: []time.Duration{0, time.Second, 10 * time.Second}, wantAllowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewIPThrottle(2, 10*time.Second)
+			var (
+				cooldown time.Duration
+				allowed  bool
+			)
+			for _, at := range tt.attempts {
+				cooldown, allowed = throttle.Allow("127.0.0.1", start.Add(at))
+			}
+			if allowed != tt.wantAllowed || cooldown != tt.wantCooldown {
+				t.Fatalf("last attempt allowed: %v with cooldown %s, want %v with %s", allowed, cooldown, tt.wantAllowed, tt.wantCooldown)
+			}
+			if _, ok := throttle.Allow("127.0.0.2", start.Add(tt.attempts[len(tt.attempts)-1])); !ok {
+				t.Error("another IP was throttled")
+			}
+		})
+	}
+}
+
+func TestCooldownSeconds(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      string
+	}{
+		{remaining: 6 * time.Second, want: "6"},
+		{remaining: 5*time.Second + time.Millisecond, want: "6"},
+		{remaining: 500 * time.Millisecond, want: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remaining.String(), func(t *testing.T) {
+			if got := cooldownSeconds(tt.remaining); got != tt.want {
+				t.Fatalf("cooldownSeconds(%s) = %s, want %s", tt.remaining, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// serverTracker tracks the backend server each session is currently connected to.
+var serverTracker = NewServerTracker()
+
+// ServerTracker keeps track of the backend server address of each session, keyed by XUID.
+type ServerTracker struct {
+	mu      sync.RWMutex
+	servers map[string]string
+}
+
+// NewServerTracker creates a new, empty ServerTracker.
+func NewServerTracker() *ServerTracker {
+	return &ServerTracker{servers: make(map[string]string)}
+}
+
+// Set records that the session with the given XUID is connected to addr.
+func (t *ServerTracker) Set(xuid, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.servers[xuid] = addr
+}
+
+// Remove forgets the session with the given XUID.
+func (t *ServerTracker) Remove(xuid string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.servers, xuid)
+}
+
+// Server returns the address of the server the session with the given XUID is connected to.
+func (t *ServerTracker) Server(xuid string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	addr, ok := t.servers[xuid]
+	return addr, ok
+}
+
+// Move records that all sessions connected to the server at old are now connected to new, for servers
+// whose address changed.
+func (t *ServerTracker) Move(old, new string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for xuid, addr := range t.servers {
+		if addr == old {
+			t.servers[xuid] = new
+		}
+	}
+}
+
+// Count returns the number of sessions connected to addr.
+func (t *ServerTracker) Count(addr string) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	n := 0
+	for _, a := range t.servers {
+		if a == addr {
+			n++
+		}
+	}
+	return n
+}
+
+// Players returns the XUIDs of the sessions connected to addr, in sorted order.
+func (t *ServerTracker) Players(addr string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var xuids []string
+	for xuid, a := range t.servers {
+		if a == addr {
+			xuids = append(xuids, xuid)
+		}
+	}
+	slices.Sort(xuids)
+	return xuids
+}
+
+// Addresses returns the distinct addresses of all servers that have at least one session connected.
+func (t *ServerTracker) Addresses() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	seen := make(map[string]struct{})
+	var addrs []string
+	for _, a := range t.servers {
+		if _, ok := seen[a]; !ok {
+			seen[a] = struct{}{}
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
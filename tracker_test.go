@@ -0,0 +1,37 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestServerTrackerPlayers(t *testing.T) {
+	tracker := NewServerTracker()
+	tracker.Set("3", "127.0.0.1:19134")
+	tracker.Set("1", "127.0.0.1:19134")
+	tracker.Set("2", "127.0.0.1:19133")
+	tracker.Set("4", "127.0.0.1:19133")
+	tracker.Set("4", "127.0.0.1:19134")
+	tracker.Set("5", "127.0.0.1:19134")
+	tracker.Remove("5")
+
+	tests := []struct {
+		name string
+		addr string
+		want []string
+	}{
+		{name: "players on the server only", addr: "127.0.0.1:19134", want: []string{"1", "3", "4"}},
+		{name: "transferred players are gone", addr: "127.0.0.1:19133", want: []string{"2"}},
+		{name: "empty server", addr: "127.0.0.1:19135", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tracker.Players(tt.addr); !slices.Equal(got, tt.want) {
+				t.Fatalf("Players(%q) = %v, want %v", tt.addr, got, tt.want)
+			}
+			if got := tracker.Count(tt.addr); got != len(tt.want) {
+				t.Fatalf("Count(%q) = %d, want %d", tt.addr, got, len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// PreTransferHook is called before a session is transferred to the named server. Returning an error
+// cancels the transfer.
+type PreTransferHook func(s *session.Session, server string) error
+
+// PostTransferHook is called after a session was successfully transferred to the named server.
+type PostTransferHook func(s *session.Session, server string)
+
+// TransferEventHandler observes the transfers of all players, e.g. to log them to an external service.
+// from and to are server names, from is empty if the current server of the player is unknown.
+type TransferEventHandler interface {
+	// OnPreTransfer is called before a transfer, after the pre-transfer hooks. Returning false cancels it.
+	OnPreTransfer(s *session.Session, from, to string) bool
+	// OnPostTransfer is called after a successful transfer, once the player spawned on the server and after
+	// the post-transfer hooks. It is also called for transfers started by Spectrum itself, such as moving
+	// a player to a fallback server, for which OnPreTransfer is not called.
+	OnPostTransfer(s *session.Session, from, to string)
+	// OnTransferFailed is called when a transfer failed with err, also if it failed after connecting to the
+	// server. Like OnPostTransfer, it is also called for transfers started by Spectrum itself.
+	OnTransferFailed(s *session.Session, from, to string, err error)
+}
+
+// NopTransferEventHandler is a TransferEventHandler that allows all transfers and ignores all events.
+type NopTransferEventHandler struct{}
+
+func (NopTransferEventHandler) OnPreTransfer(*session.Session, string, string) bool { return true }
+
+func (NopTransferEventHandler) OnPostTransfer(*session.Session, string, string) {}
+
+func (NopTransferEventHandler) OnTransferFailed(*session.Session, string, string, error) {}
+
+var (
+	// errTransferVetoed is returned by transfers cancelled by the transfer event handler.
+	errTransferVetoed = errors.New("transfer vetoed by the event handler")
+	// errTransferInProgress is returned by transfers of sessions that are already being transferred.
+	errTransferInProgress = errors.New("the player is already being transferred")
+	// errTransferFailed is returned by transfers that failed while logging in to or spawning on the
+	// server. Spectrum doesn't report the cause of these failures.
+	errTransferFailed = errors.New("connection sequence with the server failed")
+)
+
+var (
+	transferHooksMu   sync.RWMutex
+	preTransferHooks  []PreTransferHook
+	postTransferHooks []PostTransferHook
+	transferEvents    TransferEventHandler = NopTransferEventHandler{}
+
+	// transferSlots limits the number of transfers in progress at the same time. It is nil if transfers
+	// are not limited.
+	transferSlots chan struct{}
+	// pendingTransfers holds the transfers started by transferSession that have not completed yet.
+	pendingTransfersMu sync.Mutex
+	pendingTransfers   = make(map[*session.Session]*pendingTransfer)
+	// transferTimeout is how long a transfer may take from dialing the server to spawning on it before
+	// it is abandoned. It must be set before any transfers are started.
+	transferTimeout = 10 * time.Second
+)
+
+// setMaxConcurrentTransfers limits the number of transfers in progress at the same time to n. Transfers
+// started while the limit is reached wait for a slot, so bulk operations are paced automatically. If n is
+// 0 or less, transfers are not limited. It must be called before any transfers are started.
+func setMaxConcurrentTransfers(n int) {
+	if n <= 0 {
+		transferSlots = nil
+		return
+	}
+	transferSlots = make(chan struct{}, n)
+}
+
+// RegisterPreTransferHook registers a hook that is called before every transfer. Hooks run in the order
+// they were registered, after the built-in checks (the server exists and is not full), and the first
+// hook returning an error cancels the transfer without running the remaining hooks.
+func RegisterPreTransferHook(h PreTransferHook) {
+	transferHooksMu.Lock()
+	defer transferHooksMu.Unlock()
+	preTransferHooks = append(preTransferHooks, h)
+}
+
+// RegisterPostTransferHook registers a hook that is called after every successful transfer, once the player
+// spawned on the server. Hooks run in the order they were registered, on the packet loop of the session, so
+// they must not block.
+func RegisterPostTransferHook(h PostTransferHook) {
+	transferHooksMu.Lock()
+	defer transferHooksMu.Unlock()
+	postTransferHooks = append(postTransferHooks, h)
+}
+
+// SetTransferEventHandler sets the handler notified of all transfers. It replaces the previous handler, a
+// nil handler resets it to a NopTransferEventHandler.
+func SetTransferEventHandler(h TransferEventHandler) {
+	if h == nil {
+		h = NopTransferEventHandler{}
+	}
+	transferHooksMu.Lock()
+	defer transferHooksMu.Unlock()
+	transferEvents = h
+}
+
+// pendingTransfer is a transfer started by transferSession. Spectrum's TransferTimeout only dials the
+// server and starts the connection sequence, the transfer completes when the TransferProcessor of the
+// session is notified through ProcessPostTransfer or ProcessTransferFailure.
+type pendingTransfer struct {
+	// from is the name of the server the session is transferred from, or empty if it is unknown.
+	from string
+	// name and addr are the name and address of the server the session is transferred to.
+	name, addr string
+	// started is set once TransferTimeout returned. A failure reported before is recorded in failed and
+	// handled by transferSession, so that the error returned by TransferTimeout isn't lost.
+	started, failed bool
+	// release releases the transfer slot held by the transfer, if any.
+	release func()
+	// done receives the result of the transfer.
+	done chan error
+}
+
+// transferSession transfers the session to the server with the given name and address, running the
+// registered transfer hooks and the transfer event handler around the transfer. It returns once the player
+// spawned on the server or the transfer failed. It must not be called from the packet loops of the session,
+// as the connection sequence with the server is driven by them.
+func transferSession(s *session.Session, name, addr string) error {
+	transferHooksMu.RLock()
+	pre, handler := preTransferHooks, transferEvents
+	transferHooksMu.RUnlock()
+
+	for _, h := range pre {
+		if err := h(s, name); err != nil {
+			return fmt.Errorf("transfer cancelled: %w", err)
+		}
+	}
+	from := currentServerName(s.Client().IdentityData().XUID)
+	if !handler.OnPreTransfer(s, from, name) {
+		return errTransferVetoed
+	}
+	return startTransfer(s, from, name, addr)
+}
+
+// startTransfer transfers the session to the server once a transfer slot is available and waits for the
+// transfer to complete. Transfers that don't complete within transferTimeout are abandoned.
+func startTransfer(s *session.Session, from, name, addr string) error {
+	t := &pendingTransfer{from: from, name: name, addr: addr, done: make(chan error, 1)}
+	pendingTransfersMu.Lock()
+	if _, ok := pendingTransfers[s]; ok {
+		pendingTransfersMu.Unlock()
+		reportTransfer(s, from, name, errTransferInProgress)
+		return errTransferInProgress
+	}
+	pendingTransfers[s] = t
+	pendingTransfersMu.Unlock()
+
+	release, err := acquireTransferSlot(s.Context())
+	if err != nil {
+		completeTransfer(s, addr, err)
+		return <-t.done
+	}
+	pendingTransfersMu.Lock()
+	t.release = release
+	pendingTransfersMu.Unlock()
+
+	// The timeout covers the whole transfer up to spawning on the server, not just dialing it.
+	ctx, cancel := context.WithTimeout(s.Context(), transferTimeout)
+	defer cancel()
+	err = s.TransferContext(ctx, addr)
+	pendingTransfersMu.Lock()
+	t.started = true
+	if err == nil && t.failed {
+		err = errTransferFailed
+	}
+	pendingTransfersMu.Unlock()
+	if err != nil {
+		completeTransfer(s, addr, err)
+	}
+
+	select {
+	case err := <-t.done:
+		return err
+	case <-ctx.Done():
+		if completeTransfer(s, addr, ctx.Err()) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// Close the abandoned connection so that the player doesn't show up on the server later.
+			if conn := s.Server(); conn != nil {
+				conn.CloseWithError(fmt.Errorf("transfer to %s timed out", addr))
+			}
+		}
+		return <-t.done
+	}
+}
+
+// failTransfer is called when the transfer of the session from origin to addr failed. Failures of
+// transfers that were not started by transferSession are only reported to the transfer event handler.
+func failTransfer(s *session.Session, origin, addr string) {
+	pendingTransfersMu.Lock()
+	if t, ok := pendingTransfers[s]; ok && t.addr == addr && !t.started {
+		t.failed = true
+		pendingTransfersMu.Unlock()
+		return
+	}
+	pendingTransfersMu.Unlock()
+	if !completeTransfer(s, addr, errTransferFailed) {
+		from, _ := serverRegistry.Name(origin)
+		to, _ := serverRegistry.Name(addr)
+		reportTransfer(s, from, to, errTransferFailed)
+	}
+}
+
+// completeTransfer completes the pending transfer of the session to addr with err, which is nil if the
+// player spawned on the server. The transfer slot is released, the transfer is counted in the metrics, the
+// post-transfer hooks are run for successful transfers and the transfer event handler is notified. It
+// returns false if no transfer of the session to addr is pending.
+func completeTransfer(s *session.Session, addr string, err error) bool {
+	pendingTransfersMu.Lock()
+	t, ok := pendingTransfers[s]
+	if !ok || t.addr != addr {
+		pendingTransfersMu.Unlock()
+		return false
+	}
+	delete(pendingTransfers, s)
+	release := t.release
+	pendingTransfersMu.Unlock()
+	if release != nil {
+		release()
+	}
+
+	if err != nil {
+		class := classifyTransferError(err)
+		proxyCounters.failedTransfers.Add(1)
+		proxyCounters.transferErrors[class].Add(1)
+		metricsSink.AddCounter(metricFailedTransfers, 1)
+		metricsSink.AddCounter(fmt.Sprintf(metricTransferErrorsFormat, transferErrorNames[class]), 1)
+	} else {
+		proxyCounters.transfers.Add(1)
+		metricsSink.AddCounter(metricTransfers, 1)
+		transferHooksMu.RLock()
+		post := postTransferHooks
+		transferHooksMu.RUnlock()
+		for _, h := range post {
+			h(s, t.name)
+		}
+	}
+	reportTransfer(s, t.from, t.name, err)
+	t.done <- err
+	return true
+}
+
+// reportTransfer notifies the transfer event handler of the result of a transfer from and to the named
+// servers.
+func reportTransfer(s *session.Session, from, to string, err error) {
+	transferHooksMu.RLock()
+	handler := transferEvents
+	transferHooksMu.RUnlock()
+	if err != nil {
+		handler.OnTransferFailed(s, from, to, err)
+		return
+	}
+	handler.OnPostTransfer(s, from, to)
+}
+
+const (
+	// transferErrorTimeout is the class of transfers that didn't complete in time.
+	transferErrorTimeout = iota
+	// transferErrorCancelled is the class of transfers cancelled because the session closed.
+	transferErrorCancelled
+	// transferErrorOther is the class of all other transfer failures, such as unreachable servers.
+	transferErrorOther
+	transferErrorClasses
+)
+
+// transferErrorNames are the names of the transfer error classes used in metrics.
+var transferErrorNames = [transferErrorClasses]string{"timeout", "cancelled", "other"}
+
+// classifyTransferError returns the class of the transfer error err.
+func classifyTransferError(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return transferErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return transferErrorCancelled
+	default:
+		return transferErrorOther
+	}
+}
+
+// retryableTransferError reports if a transfer that failed with err may succeed when retried. Transfers
+// that were denied or vetoed, clashed with another transfer or failed because the session closed, are not
+// retried.
+func retryableTransferError(err error) bool {
+	return !errors.Is(err, errTransferDenied) && !errors.Is(err, errTransferVetoed) &&
+		!errors.Is(err, errTransferInProgress) && classifyTransferError(err) != transferErrorCancelled
+}
+
+// acquireTransferSlot waits until a transfer slot is available or ctx is done. The slot is held until the
+// returned function is called.
+func acquireTransferSlot(ctx context.Context) (func(), error) {
+	slots := transferSlots
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TransferMetadata is sent to the backend a player was transferred to, so that it knows where the player
+// came from.
+type TransferMetadata struct {
+	// Player is the display name of the transferred player.
+	Player string `json:"player"`
+	// XUID is the XUID of the transferred player.
+	XUID string `json:"xuid"`
+	// PreviousServer is the name of the server the player was transferred from, or empty if unknown.
+	PreviousServer string `json:"previous_server"`
+	// Tags are the tags configured on the proxy.
+	Tags map[string]string `json:"tags"`
+}
+
+// sendTransferMetadata sends the transfer metadata of the session to its current backend as a
+// packet.ScriptMessage with the configured identifier. Spectrum forwards the client's original login to
+// backends unchanged, so a script message sent right after spawning is the only way to attach extra data.
+func sendTransferMetadata(s *session.Session, conf TransferMetadataConfig, previousServer string) error {
+	pk, err := transferMetadataMessage(s.Client().IdentityData(), conf, previousServer)
+	if err != nil {
+		return err
+	}
+	conn := s.Server()
+	if conn == nil {
+		return fmt.Errorf("session has no server connection")
+	}
+	return conn.WritePacket(pk)
+}
+
+// transferMetadataMessage returns the script message holding the transfer metadata of the player with the
+// given identity.
+func transferMetadataMessage(identity login.IdentityData, conf TransferMetadataConfig, previousServer string) (*packet.ScriptMessage, error) {
+	data, err := json.Marshal(TransferMetadata{
+		Player:         identity.DisplayName,
+		XUID:           identity.XUID,
+		PreviousServer: previousServer,
+		Tags:           conf.Tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &packet.ScriptMessage{Identifier: conf.Identifier, Data: data}, nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+)
+
+// useMaxConcurrentTransfers limits concurrent transfers to n for the duration of the test.
+func useMaxConcurrentTransfers(t *testing.T, n int) {
+	t.Helper()
+	slots := transferSlots
+	t.Cleanup(func() { transferSlots = slots })
+	setMaxConcurrentTransfers(n)
+}
+
+func TestAcquireTransferSlotLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		transfers int
+		want      int
+	}{
+		{name: "limited", limit: 3, transfers: 50, want: 3},
+		{name: "single slot", limit: 1, transfers: 20, want: 1},
+		{name: "unlimited", limit: 0, transfers: 20, want: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMaxConcurrentTransfers(t, tt.limit)
+
+			var (
+				active, peak atomic.Int32
+				wg           sync.WaitGroup
+				// hold keeps unlimited transfers in progress until all of them have started.
+				hold = make(chan struct{})
+			)
+			for range tt.transfers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					release, err := acquireTransferSlot(context.Background())
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					defer release()
+					n := active.Add(1)
+					for {
+						p := peak.Load()
+						if n <= p || peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					if tt.limit == 0 {
+						<-hold
+					} else {
+						time.Sleep(time.Millisecond)
+					}
+					active.Add(-1)
+				}()
+			}
+			if tt.limit == 0 {
+				for active.Load() < int32(tt.transfers) {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			close(hold)
+			wg.Wait()
+
+			if got := int(peak.Load()); got > tt.want || tt.limit == 0 && got != tt.want {
+				t.Fatalf("%d transfers were in progress at once, want at most %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcquireTransferSlotCanceled(t *testing.T) {
+	useMaxConcurrentTransfers(t, 1)
+	release, err := acquireTransferSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := acquireTransferSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquireTransferSlot while the limit is reached = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	release()
+	release, err = acquireTransferSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireTransferSlot after a slot was released = %v", err)
+	}
+	release()
+}
+
+// useTransferHooks removes the registered transfer hooks for the duration of the test.
+func useTransferHooks(t *testing.T) {
+	t.Helper()
+	transferHooksMu.Lock()
+	pre, post := preTransferHooks, postTransferHooks
+	preTransferHooks, postTransferHooks = nil, nil
+	transferHooksMu.Unlock()
+	t.Cleanup(func() {
+		transferHooksMu.Lock()
+		defer transferHooksMu.Unlock()
+		preTransferHooks, postTransferHooks = pre, post
+	})
+}
+
+func TestPreTransferHookCancels(t *testing.T) {
+	useTransferHooks(t)
+	errVeto := errors.New("vetoed")
+	var ran []string
+	RegisterPreTransferHook(func(_ *session.Session, server string) error {
+		ran = append(ran, "first "+server)
+		return nil
+	})
+	RegisterPreTransferHook(func(_ *session.Session, server string) error {
+		ran = append(ran, "veto "+server)
+		return errVeto
+	})
+	RegisterPreTransferHook(func(*session.Session, string) error {
+		ran = append(ran, "after veto")
+		return nil
+	})
+	RegisterPostTransferHook(func(*session.Session, string) {
+		ran = append(ran, "post")
+	})
+
+	// The transfer is cancelled before the session is used, so no session is needed.
+	if err := transferSession(nil, "island", "127.0.0.1:19134"); !errors.Is(err, errVeto) {
+		t.Fatalf("transferSession() = %v, want the error of the hook", err)
+	}
+	if want := []string{"first island", "veto island"}; !slices.Equal(ran, want) {
+		t.Fatalf("hooks ran %v, want %v", ran, want)
+	}
+}
+
+func TestPostTransferHookNotified(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{name: "transfer succeeded", want: []string{"first island", "second island"}},
+		{name: "transfer failed", err: errTransferFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTransferHooks(t)
+			var notified []string
+			RegisterPostTransferHook(func(_ *session.Session, server string) { notified = append(notified, "first "+server) })
+			RegisterPostTransferHook(func(_ *session.Session, server string) { notified = append(notified, "second "+server) })
+
+			pending := &pendingTransfer{name: "island", addr: "127.0.0.1:19134", done: make(chan error, 1)}
+			pendingTransfersMu.Lock()
+			pendingTransfers[nil] = pending
+			pendingTransfersMu.Unlock()
+			if !completeTransfer(nil, "127.0.0.1:19134", tt.err) {
+				t.Fatal("completeTransfer() found no pending transfer")
+			}
+			if err := <-pending.done; !errors.Is(err, tt.err) {
+				t.Fatalf("transfer completed with %v, want %v", err, tt.err)
+			}
+			if !slices.Equal(notified, tt.want) {
+				t.Fatalf("post-transfer hooks notified %v, want %v", notified, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferMetadataMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		tags     map[string]string
+	}{
+		{name: "previous server and tags", previous: "lobby", tags: map[string]string{"region": "eu"}},
+		{name: "unknown previous server", tags: map[string]string{"region": "eu"}},
+		{name: "no tags", previous: "lobby"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := TransferMetadataConfig{Enabled: true, Identifier: "spectrum:transfer", Tags: tt.tags}
+			pk, err := transferMetadataMessage(login.IdentityData{XUID: "1", DisplayName: "Steve"}, conf, tt.previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pk.Identifier != conf.Identifier {
+				t.Errorf("identifier = %q, want %q", pk.Identifier, conf.Identifier)
+			}
+			var got TransferMetadata
+			if err := json.Unmarshal(pk.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			want := TransferMetadata{Player: "Steve", XUID: "1", PreviousServer: tt.previous, Tags: tt.tags}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("metadata = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestPostTransferSendsMetadata(t *testing.T) {
+	const lobby, island = "127.0.0.1:19133", "127.0.0.1:19134"
+	tests := []struct {
+		name     string
+		enabled  bool
+		wantSent bool
+	}{
+		{name: "enabled", enabled: true, wantSent: true},
+		{name: "disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useServers(t, Server{Name: "lobby", Addr: lobby}, Server{Name: "island", Addr: island})
+			s, _ := newTestSession(t, "1", "Steve", &fakeTransport{})
+			logs := captureLogs(t)
+			p := &TransferProcessor{
+				s:        s,
+				conf:     &ServerConfig{TransferMetadata: TransferMetadataConfig{Enabled: tt.enabled, Identifier: "spectrum:transfer"}},
+				registry: session.NewRegistry(),
+				log:      slog.Default(),
+			}
+			origin, target := lobby, island
+			p.ProcessPostTransfer(nil, &origin, &target)
+
+			// The session was never logged in to a backend, so sending the metadata fails once it is attempted.
+			if sent := strings.Contains(logs.String(), "failed to send transfer metadata"); sent != tt.wantSent {
+				t.Fatalf("metadata sent on transfer: %v, want %v", sent, tt.wantSent)
+			}
+		})
+	}
+}
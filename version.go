@@ -0,0 +1,116 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// unsupportedProtocolWindow is how many protocol versions below and above the current one are accepted
+// only to be disconnected with the unsupported version message. Clients much further away usually can't
+// complete the login with the current login and resource pack packets anyway.
+const unsupportedProtocolWindow = 150
+
+// UnsupportedVersion configures how clients on a protocol version other than the supported one are turned
+// away.
+type UnsupportedVersion struct {
+	// Enabled lets clients on nearby unsupported versions log in just to be disconnected with Message,
+	// instead of seeing the generic "outdated client/server" screen of the game.
+	Enabled bool `toml:"enabled"`
+	// Message is the disconnect message. {client} is replaced with the game version of the client and
+	// {required} with the supported game version.
+	Message string `toml:"message"`
+}
+
+// unsupportedProtocol is a Protocol using the packets of the current version for a different protocol ID.
+// It only needs to get a client far enough to be disconnected with a readable message.
+type unsupportedProtocol struct {
+	minecraft.Protocol
+	id int32
+}
+
+func (p unsupportedProtocol) ID() int32 {
+	return p.id
+}
+
+func (p unsupportedProtocol) Ver() string {
+	return "unsupported"
+}
+
+// unsupportedProtocols returns the protocols accepted in addition to the current one so that clients on
+// these versions can be told which version to use.
+func unsupportedProtocols() []minecraft.Protocol {
+	protocols := make([]minecraft.Protocol, 0, 2*unsupportedProtocolWindow)
+	for id := int32(protocol.CurrentProtocol - unsupportedProtocolWindow); id <= protocol.CurrentProtocol+unsupportedProtocolWindow; id++ {
+		if id != protocol.CurrentProtocol {
+			protocols = append(protocols, unsupportedProtocol{Protocol: minecraft.DefaultProtocol, id: id})
+		}
+	}
+	return protocols
+}
+
+// supportedProtocol reports if conn uses the protocol version supported by the proxy.
+func supportedProtocol(conn *minecraft.Conn) bool {
+	return conn.Proto().ID() == protocol.CurrentProtocol
+}
+
+// rejectedVersions records the clients turned away for their protocol version. Only clients on versions
+// accepted through unsupportedProtocols get far enough to be recorded.
+var rejectedVersions = NewVersionRejections()
+
+// VersionRejection is the number of clients on a protocol version that were turned away.
+type VersionRejection struct {
+	Protocol int32
+	// Version is the game version the last of these clients reported.
+	Version string
+	Count   int
+	Last    time.Time
+}
+
+// VersionRejections counts the clients turned away per protocol version.
+type VersionRejections struct {
+	mu         sync.Mutex
+	rejections map[int32]VersionRejection
+}
+
+// NewVersionRejections creates an empty VersionRejections.
+func NewVersionRejections() *VersionRejections {
+	return &VersionRejections{rejections: make(map[int32]VersionRejection)}
+}
+
+// Record counts a client on the protocol and game version turned away at t.
+func (r *VersionRejections) Record(proto int32, version string, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rejection := r.rejections[proto]
+	rejection.Protocol, rejection.Version, rejection.Last = proto, version, t
+	rejection.Count++
+	r.rejections[proto] = rejection
+}
+
+// All returns the rejections ordered by protocol version.
+func (r *VersionRejections) All() []VersionRejection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make([]VersionRejection, 0, len(r.rejections))
+	for _, rejection := range r.rejections {
+		all = append(all, rejection)
+	}
+	slices.SortFunc(all, func(a, b VersionRejection) int { return int(a.Protocol - b.Protocol) })
+	return all
+}
+
+// versionMismatch describes how the protocol version proto differs from the supported one. It returns an
+// empty string if proto is supported.
+func versionMismatch(proto int32) string {
+	switch {
+	case proto > protocol.CurrentProtocol:
+		return "newer than the proxy, the proxy needs to be updated"
+	case proto < protocol.CurrentProtocol:
+		return "older than the proxy, the players need to update their game"
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+func TestVersionMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		proto int32
+		want  string
+	}{
+		{name: "supported", proto: protocol.CurrentProtocol, want: ""},
+		{name: "newer client", proto: protocol.CurrentProtocol + 1, want: "newer than the proxy, the proxy needs to be updated"},
+		{name: "older client", proto: protocol.CurrentProtocol - 1, want: "older than the proxy, the players need to update their game"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := versionMismatch(tt.proto); got != tt.want {
+				t.Fatalf("versionMismatch(%d) = %q, want %q", tt.proto, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionRejections(t *testing.T) {
+	start := time.Unix(0, 0)
+	r := NewVersionRejections()
+	r.Record(900, "1.99.0", start)
+	r.Record(100, "1.0.0", start)
+	r.Record(900, "1.99.1", start.Add(time.Minute))
+
+	want := []VersionRejection{
+		{Protocol: 100, Version: "1.0.0", Count: 1, Last: start},
+		{Protocol: 900, Version: "1.99.1", Count: 2, Last: start.Add(time.Minute)},
+	}
+	got := r.All()
+	if len(got) != len(want) {
+		t.Fatalf("All() returned %d rejections, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("All()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cooldogedev/spectrum"
+	"github.com/cooldogedev/spectrum/session"
+)
+
+// WhitelistConfig configures the whitelist of players that may join the proxy.
+type WhitelistConfig struct {
+	// Enabled only lets players on the whitelist join.
+	Enabled bool `toml:"enabled"`
+	// File is the JSON file the whitelist is stored in. It is managed with the whitelist command.
+	File string `toml:"file"`
+	// Message is the disconnect message shown to players that are not on the whitelist.
+	Message string `toml:"message"`
+}
+
+// whitelist holds the players on the whitelist. It is nil if no whitelist file is configured.
+var whitelist *Whitelist
+
+// WhitelistEntry is a player on the whitelist. Either field may be empty, a player matches an entry if
+// their XUID or name matches.
+type WhitelistEntry struct {
+	XUID string `json:"xuid,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// Whitelist is a list of players stored in a JSON file. The file is read when the Whitelist is created
+// and written after every change.
+type Whitelist struct {
+	filePath string
+
+	mu      sync.RWMutex
+	entries []WhitelistEntry
+}
+
+// NewWhitelist creates a Whitelist stored in the file at path, loading the entries in it if it exists.
+func NewWhitelist(path string) (*Whitelist, error) {
+	w := &Whitelist{filePath: path}
+	if err := w.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Load reads the entries from the file.
+func (w *Whitelist) Load() error {
+	b, err := os.ReadFile(w.filePath)
+	if err != nil {
+		return err
+	}
+	var entries []WhitelistEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return fmt.Errorf("%s: %w", w.filePath, err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries = entries
+	return nil
+}
+
+// save writes the entries to the file. w.mu must be held.
+func (w *Whitelist) save() error {
+	b, err := json.MarshalIndent(w.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.filePath, append(b, '\n'), 0644)
+}
+
+// Contains reports if the player with the given XUID and name is on the whitelist. Names are compared
+// case-insensitively.
+func (w *Whitelist) Contains(xuid, name string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.contains(xuid, name)
+}
+
+// contains reports if the player with the given XUID and name is on the whitelist. w.mu must be held.
+func (w *Whitelist) contains(xuid, name string) bool {
+	return slices.IndexFunc(w.entries, func(e WhitelistEntry) bool {
+		return (e.XUID != "" && e.XUID == xuid) || (e.Name != "" && strings.EqualFold(e.Name, name))
+	}) != -1
+}
+
+// Add adds an entry to the whitelist and saves it. It returns false if a player matching the entry is
+// already on the whitelist.
+func (w *Whitelist) Add(entry WhitelistEntry) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.contains(entry.XUID, entry.Name) {
+		return false, nil
+	}
+	w.entries = append(w.entries, entry)
+	return true, w.save()
+}
+
+// Remove removes all entries with the given XUID or name and saves the whitelist. It returns the number
+// of entries removed.
+func (w *Whitelist) Remove(player string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	before := len(w.entries)
+	w.entries = slices.DeleteFunc(w.entries, func(e WhitelistEntry) bool {
+		return e.XUID == player || strings.EqualFold(e.Name, player)
+	})
+	removed := before - len(w.entries)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, w.save()
+}
+
+// Entries returns a copy of the entries on the whitelist.
+func (w *Whitelist) Entries() []WhitelistEntry {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return slices.Clone(w.entries)
+}
+
+// whitelisted reports if the player of s may join while the whitelist is enabled. Observers can always
+// join.
+func whitelisted(s *session.Session) bool {
+	if whitelist == nil || isObserver(s) {
+		return true
+	}
+	identity := s.Client().IdentityData()
+	return whitelist.Contains(identity.XUID, identity.DisplayName)
+}
+
+// handleWhitelistCommand processes the subcommands of the whitelist command. Players are added by XUID
+// if the argument is numeric and by name otherwise. Players that are online are added with both.
+func handleWhitelistCommand(args []string, proxy *spectrum.Spectrum, conf *ServerConfig) {
+	logger := slog.Default()
+	if whitelist == nil {
+		logger.Info("The whitelist is disabled, set whitelist.file to manage it")
+		return
+	}
+	if len(args) == 0 {
+		logger.Info("Usage: whitelist <add|remove|list> [player|xuid]")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		entries := whitelist.Entries()
+		state := "disabled"
+		if conf.Whitelist.Enabled {
+			state = "enabled"
+		}
+		logger.Info(fmt.Sprintf("Whitelisted players (%d, %s)", len(entries), state))
+		for _, e := range entries {
+			switch {
+			case e.Name != "" && e.XUID != "":
+				logger.Info(fmt.Sprintf("- %s (%s)", e.Name, e.XUID))
+			case e.Name != "":
+				logger.Info(fmt.Sprintf("- %s", e.Name))
+			default:
+				logger.Info(fmt.Sprintf("- %s", e.XUID))
+			}
+		}
+	case "add":
+		if len(args) < 2 {
+			logger.Info("Usage: whitelist add <player|xuid>")
+			return
+		}
+		entry := WhitelistEntry{Name: args[1]}
+		if s := findSession(proxy, args[1]); s != nil {
+			entry.XUID = s.Client().IdentityData().XUID
+		} else if _, err := strconv.ParseUint(args[1], 10, 64); err == nil {
+			entry = WhitelistEntry{XUID: args[1]}
+		}
+		added, err := whitelist.Add(entry)
+		if err != nil {
+			logger.Error("Failed to save the whitelist", "error", err)
+			return
+		}
+		if !added {
+			logger.Info(fmt.Sprintf("%s is already whitelisted", args[1]))
+			return
+		}
+		logger.Info(fmt.Sprintf("Added %s to the whitelist", args[1]))
+	case "remove":
+		if len(args) < 2 {
+			logger.Info("Usage: whitelist remove <player|xuid>")
+			return
+		}
+		removed, err := whitelist.Remove(args[1])
+		if err != nil {
+			logger.Error("Failed to save the whitelist", "error", err)
+			return
+		}
+		if removed == 0 {
+			logger.Info(fmt.Sprintf("%s is not whitelisted", args[1]))
+			return
+		}
+		logger.Info(fmt.Sprintf("Removed %s from the whitelist", args[1]))
+	default:
+		logger.Info(fmt.Sprintf("Unknown whitelist subcommand: %s", args[0]))
+		logger.Info("Usage: whitelist <add|remove|list> [player|xuid]")
+	}
+}
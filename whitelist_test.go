@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWhitelistAddRemove(t *testing.T) {
+	tests := []struct {
+		name        string
+		add         []WhitelistEntry
+		wantAdded   []bool
+		remove      string
+		wantRemoved int
+		want        []WhitelistEntry
+	}{
+		{
+			name:      "add",
+			add:       []WhitelistEntry{{XUID: "1", Name: "Steve"}, {Name: "Alex"}},
+			wantAdded: []bool{true, true},
+			want:      []WhitelistEntry{{XUID: "1", Name: "Steve"}, {Name: "Alex"}},
+		},
+		{
+			name:      "duplicate XUID",
+			add:       []WhitelistEntry{{XUID: "1", Name: "Steve"}, {XUID: "1", Name: "Renamed"}},
+			wantAdded: []bool{true, false},
+			want:      []WhitelistEntry{{XUID: "1", Name: "Steve"}},
+		},
+		{
+			name:      "duplicate name in another case",
+			add:       []WhitelistEntry{{Name: "Steve"}, {Name: "steve"}},
+			wantAdded: []bool{true, false},
+			want:      []WhitelistEntry{{Name: "Steve"}},
+		},
+		{
+			name:        "remove by XUID",
+			add:         []WhitelistEntry{{XUID: "1", Name: "Steve"}, {XUID: "2", Name: "Alex"}},
+			wantAdded:   []bool{true, true},
+			remove:      "1",
+			wantRemoved: 1,
+			want:        []WhitelistEntry{{XUID: "2", Name: "Alex"}},
+		},
+		{
+			name:        "remove by name",
+			add:         []WhitelistEntry{{XUID: "1", Name: "Steve"}, {Name: "Alex"}},
+			wantAdded:   []bool{true, true},
+			remove:      "ALEX",
+			wantRemoved: 1,
+			want:        []WhitelistEntry{{XUID: "1", Name: "Steve"}},
+		},
+		{
+			name:      "remove unknown player",
+			add:       []WhitelistEntry{{XUID: "1", Name: "Steve"}},
+			wantAdded: []bool{true},
+			remove:    "Alex",
+			want:      []WhitelistEntry{{XUID: "1", Name: "Steve"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "whitelist.json")
+			w, err := NewWhitelist(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, entry := range tt.add {
+				added, err := w.Add(entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if added != tt.wantAdded[i] {
+					t.Fatalf("Add(%+v) = %v, want %v", entry, added, tt.wantAdded[i])
+				}
+			}
+			if tt.remove != "" {
+				removed, err := w.Remove(tt.remove)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if removed != tt.wantRemoved {
+					t.Fatalf("Remove(%q) = %d, want %d", tt.remove, removed, tt.wantRemoved)
+				}
+			}
+			if got := w.Entries(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Entries() = %+v, want %+v", got, tt.want)
+			}
+
+			// The changes are saved and survive a restart.
+			reloaded, err := NewWhitelist(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reloaded.Entries(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Entries() after reloading = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhitelistContains(t *testing.T) {
+	w, err := NewWhitelist(filepath.Join(t.TempDir(), "whitelist.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add(WhitelistEntry{XUID: "1"})
+	w.Add(WhitelistEntry{Name: "Alex"})
+
+	tests := []struct {
+		name       string
+		xuid, user string
+		want       bool
+	}{
+		{name: "XUID", xuid: "1", user: "Steve", want: true},
+		{name: "name", xuid: "2", user: "alex", want: true},
+		{name: "neither", xuid: "3", user: "Notch", want: false},
+		{name: "empty XUID matches no XUID-less entry", xuid: "", user: "Notch", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.Contains(tt.xuid, tt.user); got != tt.want {
+				t.Fatalf("Contains(%q, %q) = %v, want %v", tt.xuid, tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWhitelistFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "missing file"},
+		{name: "entries", content: `[{"xuid": "1"}, {"name": "Alex"}]`},
+		{name: "corrupt file", content: `[{"xuid": `, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "whitelist.json")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := NewWhitelist(path); (err != nil) != tt.wantErr {
+				t.Fatalf("NewWhitelist() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}